@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidCredentials and others are errors returned when a peer's credentials cannot be verified
+var (
+	ErrInvalidCredentials  = errors.New("credentials are invalid")
+	ErrExpiredCredentials  = errors.New("credentials have expired")
+	ErrReplayedCredentials = errors.New("credentials have already been used")
+	ErrMissingChallenge    = errors.New("credentials are not bound to a challenge")
+)
+
+// defaultMaxAge is how long credentials are valid for after being issued
+const defaultMaxAge = time.Second * 30
+
+// sign computes an HMAC-SHA256 over the provided parts
+func sign(key []byte, parts ...string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.Join(parts, "|")))
+
+	return mac.Sum(nil)
+}
+
+// checkIssuedAt ensures that credentials issued at the provided unix time are still fresh
+func checkIssuedAt(issuedAt int64, maxAge time.Duration) error {
+	age := time.Since(time.Unix(issuedAt, 0))
+	if age > maxAge || age < -maxAge {
+		return ErrExpiredCredentials
+	}
+
+	return nil
+}
+
+// replayCache remembers the challenges that have been used recently so that captured
+// credentials cannot be replayed while they are still fresh
+type replayCache struct {
+	seen   map[string]time.Time
+	maxAge time.Duration
+	lock   sync.Mutex
+}
+
+func newReplayCache(maxAge time.Duration) *replayCache {
+	r := &replayCache{
+		seen:   map[string]time.Time{},
+		maxAge: maxAge,
+		lock:   sync.Mutex{},
+	}
+
+	return r
+}
+
+// add records the challenge and returns false if it has already been seen
+func (r *replayCache) add(challenge string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+
+	// credentials are valid for maxAge in either direction, so keep challenges around for twice as long
+	for c, seenAt := range r.seen {
+		if now.Sub(seenAt) > r.maxAge*2 {
+			delete(r.seen, c)
+		}
+	}
+
+	if _, exists := r.seen[challenge]; exists {
+		return false
+	}
+
+	r.seen[challenge] = now
+
+	return true
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/suborbital/grav/grav"
+)
+
+func testAuthenticator(t *testing.T, a, b, wrongKey grav.Authenticator, identity string) {
+	creds, err := a.Credentials("node-a", "challenge-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id, err := b.Verify("node-a", "challenge-1", creds); err != nil {
+		t.Errorf("expected credentials to verify, got %s", err)
+	} else if id != identity {
+		t.Errorf("expected identity %s, got %s", identity, id)
+	}
+
+	if _, err := b.Verify("node-a", "challenge-1", creds); err != ErrReplayedCredentials {
+		t.Errorf("expected ErrReplayedCredentials, got %v", err)
+	}
+
+	creds, err = a.Credentials("node-a", "challenge-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.Verify("node-b", "challenge-2", creds); err != ErrInvalidCredentials {
+		t.Errorf("expected ErrInvalidCredentials for wrong UUID, got %v", err)
+	}
+
+	if _, err := b.Verify("node-a", "challenge-3", creds); err != ErrInvalidCredentials {
+		t.Errorf("expected ErrInvalidCredentials for wrong challenge, got %v", err)
+	}
+
+	if _, err := wrongKey.Verify("node-a", "challenge-2", creds); err != ErrInvalidCredentials {
+		t.Errorf("expected ErrInvalidCredentials for wrong key, got %v", err)
+	}
+
+	if _, err := b.Verify("node-a", "", creds); err != ErrMissingChallenge {
+		t.Errorf("expected ErrMissingChallenge, got %v", err)
+	}
+}
+
+func TestPSK(t *testing.T) {
+	key := []byte("super-secret-key")
+
+	testAuthenticator(t, NewPSK(key, "billing"), NewPSK(key, "other"), NewPSK([]byte("wrong"), "billing"), "billing")
+}
+
+func TestToken(t *testing.T) {
+	key := []byte("super-secret-key")
+
+	testAuthenticator(t, NewToken(key, "billing"), NewToken(key, "other"), NewToken([]byte("wrong"), "billing"), "billing")
+}
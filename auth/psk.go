@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PSK is a grav Authenticator that performs HMAC challenge-response using a pre-shared key
+type PSK struct {
+	key      []byte
+	identity string
+	maxAge   time.Duration
+	replay   *replayCache
+}
+
+// NewPSK creates a new PSK authenticator. Every node in the mesh must be configured with the same key.
+// The identity is sent to peers, who will receive it from Verify once the credentials have been validated.
+// It is asserted by the node itself, so any node holding the key can claim any identity: it names a group of
+// nodes sharing the key, not an individual node.
+func NewPSK(key []byte, identity string) *PSK {
+	p := &PSK{
+		key:      key,
+		identity: identity,
+		maxAge:   defaultMaxAge,
+		replay:   newReplayCache(defaultMaxAge),
+	}
+
+	return p
+}
+
+// Credentials returns an HMAC of the node's UUID, the challenge, the identity and the current time
+func (p *PSK) Credentials(nodeUUID, challenge string) (string, error) {
+	if challenge == "" {
+		return "", ErrMissingChallenge
+	}
+
+	issuedAt := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := sign(p.key, "grav-psk", nodeUUID, challenge, p.identity, issuedAt)
+
+	credentials := strings.Join([]string{
+		base64.RawURLEncoding.EncodeToString([]byte(p.identity)),
+		issuedAt,
+		base64.RawURLEncoding.EncodeToString(mac),
+	}, ".")
+
+	return credentials, nil
+}
+
+// Verify checks that the credentials were produced with the same key for the peer and challenge
+func (p *PSK) Verify(peerUUID, challenge, credentials string) (string, error) {
+	if challenge == "" {
+		return "", ErrMissingChallenge
+	}
+
+	parts := strings.Split(credentials, ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidCredentials
+	}
+
+	identity, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrInvalidCredentials
+	}
+
+	issuedAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", ErrInvalidCredentials
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrInvalidCredentials
+	}
+
+	expected := sign(p.key, "grav-psk", peerUUID, challenge, string(identity), parts[1])
+	if !hmac.Equal(mac, expected) {
+		return "", ErrInvalidCredentials
+	}
+
+	if err := checkIssuedAt(issuedAt, p.maxAge); err != nil {
+		return "", err
+	}
+
+	if !p.replay.add(challenge) {
+		return "", ErrReplayedCredentials
+	}
+
+	return string(identity), nil
+}
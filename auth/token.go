@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// tokenHeader is the fixed JWT header used for all tokens
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Token is a grav Authenticator that exchanges short-lived JWT-style tokens signed using HMAC-SHA256.
+// Each token names the subject (the identity of the node), the node's UUID, and the challenge it answers.
+type Token struct {
+	key     []byte
+	subject string
+	maxAge  time.Duration
+	replay  *replayCache
+}
+
+// tokenClaims are the claims contained in a token
+type tokenClaims struct {
+	Subject   string `json:"sub"`
+	Node      string `json:"node"`
+	Nonce     string `json:"nonce"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// NewToken creates a new Token authenticator. Every node in the mesh must be configured with the same signing key.
+// The subject is placed in each token, and is returned from Verify once a peer's token has been validated.
+// Since every node signs its own tokens, any node holding the key can claim any subject.
+func NewToken(key []byte, subject string) *Token {
+	t := &Token{
+		key:     key,
+		subject: subject,
+		maxAge:  defaultMaxAge,
+		replay:  newReplayCache(defaultMaxAge),
+	}
+
+	return t
+}
+
+// Credentials returns a signed token for the node's UUID and the challenge
+func (t *Token) Credentials(nodeUUID, challenge string) (string, error) {
+	if challenge == "" {
+		return "", ErrMissingChallenge
+	}
+
+	now := time.Now()
+
+	claims := tokenClaims{
+		Subject:   t.subject,
+		Node:      nodeUUID,
+		Nonce:     challenge,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(t.maxAge).Unix(),
+	}
+
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to Marshal claims")
+	}
+
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	signature := base64.RawURLEncoding.EncodeToString(sign(t.key, unsigned))
+
+	return unsigned + "." + signature, nil
+}
+
+// Verify checks the token's signature and ensures that its claims match the peer and challenge
+func (t *Token) Verify(peerUUID, challenge, credentials string) (string, error) {
+	if challenge == "" {
+		return "", ErrMissingChallenge
+	}
+
+	parts := strings.Split(credentials, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return "", ErrInvalidCredentials
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrInvalidCredentials
+	}
+
+	if !hmac.Equal(signature, sign(t.key, parts[0]+"."+parts[1])) {
+		return "", ErrInvalidCredentials
+	}
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrInvalidCredentials
+	}
+
+	claims := tokenClaims{}
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return "", ErrInvalidCredentials
+	}
+
+	if claims.Node != peerUUID || claims.Nonce != challenge {
+		return "", ErrInvalidCredentials
+	}
+
+	if time.Now().Unix() > claims.ExpiresAt {
+		return "", ErrExpiredCredentials
+	}
+
+	if err := checkIssuedAt(claims.IssuedAt, t.maxAge); err != nil {
+		return "", err
+	}
+
+	if !t.replay.add(challenge) {
+		return "", ErrReplayedCredentials
+	}
+
+	return claims.Subject, nil
+}
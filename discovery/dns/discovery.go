@@ -0,0 +1,167 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+// defaultInterval is how often the name is resolved
+const defaultInterval = time.Second * 10
+
+// lookupTimeout bounds each lookup
+const lookupTimeout = time.Second * 5
+
+// Resolver resolves DNS records. It is satisfied by *net.Resolver, and can be replaced to use a particular nameserver or in tests.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// Options are the options for DNS discovery
+type Options struct {
+	// Name is the name to resolve, such as a Kubernetes headless service. When SRV is set it is the full
+	// record name (such as _grav._tcp.grav.default.svc.cluster.local) and is looked up without a service or proto.
+	Name string
+	// SRV resolves SRV records rather than A/AAAA records, taking the port of each peer from its record
+	SRV bool
+	// Port is the transport port of peers found with A/AAAA records, defaulting to this node's transport port
+	Port string
+	// Path is the transport path of each peer, defaulting to this node's transport URI
+	Path string
+	// Interval is how often the name is resolved, defaulting to 10s
+	Interval time.Duration
+	// Resolver defaults to net.DefaultResolver
+	Resolver Resolver
+}
+
+// Discovery is a grav Discovery plugin that periodically resolves a DNS name and connects to the addresses it returns.
+// DNS does not provide the UUID of each peer, so it is learned during the connection handshake, and this node's own
+// address is discarded once the handshake reveals it.
+type Discovery struct {
+	opts     *grav.DiscoveryOpts
+	log      *vlog.Logger
+	dnsOpts  Options
+	stopChan chan struct{}
+
+	discoveryFunc grav.DiscoveryFunc
+}
+
+// New creates a new DNS discovery plugin
+func New(opts Options) *Discovery {
+	if opts.Interval == 0 {
+		opts.Interval = defaultInterval
+	}
+
+	if opts.Resolver == nil {
+		opts.Resolver = net.DefaultResolver
+	}
+
+	d := &Discovery{
+		dnsOpts:  opts,
+		stopChan: make(chan struct{}, 1),
+	}
+
+	return d
+}
+
+// Start starts discovery
+func (d *Discovery) Start(opts *grav.DiscoveryOpts, discoveryFunc grav.DiscoveryFunc) error {
+	d.opts = opts
+	d.log = opts.Logger
+	d.discoveryFunc = discoveryFunc
+
+	if d.dnsOpts.Port == "" {
+		d.dnsOpts.Port = opts.TransportPort
+	}
+
+	if d.dnsOpts.Path == "" {
+		d.dnsOpts.Path = opts.TransportURI
+	}
+
+	d.log.Debug("[discovery-dns] starting discovery, resolving", d.dnsOpts.Name)
+
+	ticker := time.NewTicker(d.dnsOpts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.resolve(); err != nil {
+			d.log.Error(errors.Wrap(err, "[discovery-dns] failed to resolve"))
+		}
+
+		select {
+		case <-d.stopChan:
+			return nil
+		case <-ticker.C:
+			// continue
+		}
+	}
+}
+
+// resolve looks up the name and reports every endpoint to Grav, so that endpoints which could not be reached, or whose
+// connections were lost, are connected to again. Grav is responsible for ensuring uniqueness of the connections.
+func (d *Discovery) resolve() error {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	endpoints, err := d.lookup(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, endpoint := range endpoints {
+		d.log.Debug("[discovery-dns] potential peer found:", endpoint)
+
+		d.discoveryFunc(endpoint, "")
+	}
+
+	return nil
+}
+
+// lookup returns the endpoints for the records currently returned for the name
+func (d *Discovery) lookup(ctx context.Context) ([]string, error) {
+	endpoints := []string{}
+
+	if d.dnsOpts.SRV {
+		_, records, err := d.dnsOpts.Resolver.LookupSRV(ctx, "", "", d.dnsOpts.Name)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to LookupSRV")
+		}
+
+		for _, record := range records {
+			host := strings.TrimSuffix(record.Target, ".")
+			endpoints = append(endpoints, d.endpoint(host, strconv.Itoa(int(record.Port))))
+		}
+
+		return endpoints, nil
+	}
+
+	addrs, err := d.dnsOpts.Resolver.LookupIPAddr(ctx, d.dnsOpts.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to LookupIPAddr")
+	}
+
+	for _, addr := range addrs {
+		endpoints = append(endpoints, d.endpoint(addr.IP.String(), d.dnsOpts.Port))
+	}
+
+	return endpoints, nil
+}
+
+func (d *Discovery) endpoint(host, port string) string {
+	return fmt.Sprintf("%s%s", net.JoinHostPort(host, port), d.dnsOpts.Path)
+}
+
+// Stop stops Discovery
+func (d *Discovery) Stop() error {
+	d.stopChan <- struct{}{}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+// stubResolver answers lookups from records that can be changed during a test
+type stubResolver struct {
+	addrs []net.IPAddr
+	srvs  []*net.SRV
+	names []string
+
+	lock sync.Mutex
+}
+
+func (s *stubResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.names = append(s.names, host)
+
+	return s.addrs, nil
+}
+
+func (s *stubResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.names = append(s.names, name)
+
+	return name, s.srvs, nil
+}
+
+func (s *stubResolver) setAddrs(ips ...string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.addrs = []net.IPAddr{}
+	for _, ip := range ips {
+		s.addrs = append(s.addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+}
+
+func startDiscovery(t *testing.T, opts Options) chan string {
+	t.Helper()
+
+	found := make(chan string, 100)
+
+	opts.Interval = time.Millisecond * 20
+
+	d := New(opts)
+
+	dOpts := &grav.DiscoveryOpts{
+		NodeUUID:      "self",
+		TransportPort: "8080",
+		TransportURI:  "/meta/message",
+		Logger:        vlog.Default(vlog.Level(vlog.LogLevelNull)),
+	}
+
+	go d.Start(dOpts, func(endpoint, uuid string) {
+		if uuid != "" {
+			t.Errorf("expected empty UUID, got %s", uuid)
+		}
+
+		// endpoints are reported on every lookup, so reports are dropped while the test isn't reading them
+		select {
+		case found <- endpoint:
+		default:
+		}
+	})
+
+	t.Cleanup(func() { d.Stop() })
+
+	return found
+}
+
+// expectFound waits for the endpoints reported over several lookups to be exactly those wanted
+func expectFound(t *testing.T, found chan string, want ...string) {
+	t.Helper()
+
+	wanted := map[string]bool{}
+	for _, w := range want {
+		wanted[w] = true
+	}
+
+	reported := map[string]bool{}
+
+	deadline := time.Now().Add(time.Second * 2)
+	for time.Now().Before(deadline) {
+		reported = map[string]bool{}
+
+		window := time.After(time.Millisecond * 100)
+
+	collect:
+		for {
+			select {
+			case got := <-found:
+				reported[got] = true
+			case <-window:
+				break collect
+			}
+		}
+
+		if reflect.DeepEqual(reported, wanted) {
+			return
+		}
+	}
+
+	t.Fatalf("expected %v to be reported, got %v", want, reported)
+}
+
+func TestAddressRecords(t *testing.T) {
+	resolver := &stubResolver{}
+	resolver.setAddrs("10.0.0.2", "fd00::3")
+
+	found := startDiscovery(t, Options{Name: "grav.default.svc", Resolver: resolver})
+
+	expectFound(t, found, "10.0.0.2:8080/meta/message", "[fd00::3]:8080/meta/message")
+
+	// addresses are reported on every lookup while they are returned, and removed addresses are reported again when they return
+	resolver.setAddrs("10.0.0.4")
+	expectFound(t, found, "10.0.0.4:8080/meta/message")
+
+	resolver.setAddrs("10.0.0.2", "10.0.0.4")
+	expectFound(t, found, "10.0.0.2:8080/meta/message", "10.0.0.4:8080/meta/message")
+
+	resolver.lock.Lock()
+	defer resolver.lock.Unlock()
+
+	if resolver.names[0] != "grav.default.svc" {
+		t.Errorf("expected grav.default.svc to be resolved, got %s", resolver.names[0])
+	}
+}
+
+func TestSRVRecords(t *testing.T) {
+	resolver := &stubResolver{
+		srvs: []*net.SRV{
+			{Target: "grav-0.grav.default.svc.", Port: 9000},
+			{Target: "grav-1.grav.default.svc.", Port: 9001},
+		},
+	}
+
+	found := startDiscovery(t, Options{Name: "_grav._tcp.grav.default.svc", SRV: true, Path: "/mesh", Resolver: resolver})
+
+	expectFound(t, found, "grav-0.grav.default.svc:9000/mesh", "grav-1.grav.default.svc:9001/mesh")
+}
@@ -0,0 +1,182 @@
+package file
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultInterval is how often the file is checked for changes
+const defaultInterval = time.Second * 2
+
+// Peer is a peer listed in the discovery file. UUID is optional, and is learned during the connection handshake if empty.
+type Peer struct {
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	UUID     string `json:"uuid,omitempty" yaml:"uuid,omitempty"`
+}
+
+// peerFile is the contents of the discovery file
+type peerFile struct {
+	Peers []Peer `json:"peers" yaml:"peers"`
+}
+
+// Discovery is a grav Discovery plugin that reads peers from a JSON or YAML file, which is watched for peers being added and removed.
+// Files ending in .json are parsed as JSON, and any others as YAML.
+type Discovery struct {
+	opts     *grav.DiscoveryOpts
+	log      *vlog.Logger
+	path     string
+	interval time.Duration
+	stopChan chan struct{}
+
+	checksum []byte
+	known    map[string]Peer
+
+	discoveryFunc grav.DiscoveryFunc
+	lostFunc      grav.LostFunc
+}
+
+// New creates a new file discovery plugin that watches the file at path
+func New(path string) *Discovery {
+	d := &Discovery{
+		path:     path,
+		interval: defaultInterval,
+		stopChan: make(chan struct{}, 1),
+		known:    map[string]Peer{},
+	}
+
+	return d
+}
+
+// Start starts discovery
+func (d *Discovery) Start(opts *grav.DiscoveryOpts, discoveryFunc grav.DiscoveryFunc) error {
+	d.opts = opts
+	d.log = opts.Logger
+	d.discoveryFunc = discoveryFunc
+
+	d.log.Debug("[discovery-file] starting discovery, watching", d.path)
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.check(); err != nil {
+			d.log.Error(errors.Wrap(err, "[discovery-file] failed to check"))
+		}
+
+		select {
+		case <-d.stopChan:
+			return nil
+		case <-ticker.C:
+			// continue
+		}
+	}
+}
+
+// check reads the file if it has been modified, reporting peers that were removed to Grav, and then reports every peer
+// in the file so that peers which could not be reached, or whose connections were lost, are connected to again.
+// Grav is responsible for ensuring uniqueness of the connections.
+func (d *Discovery) check() error {
+	if err := d.reload(); err != nil {
+		return err
+	}
+
+	for _, peer := range d.known {
+		d.discoveryFunc(peer.Endpoint, peer.UUID)
+	}
+
+	return nil
+}
+
+// reload reads the file and updates the known peers if its contents have changed. The contents are compared rather than
+// the modification time, which may not change when the file is rewritten within the filesystem's timestamp resolution.
+func (d *Discovery) reload() error {
+	data, err := os.ReadFile(d.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return errors.Wrap(err, "failed to ReadFile")
+	}
+
+	sum := sha256.Sum256(data)
+	if bytes.Equal(sum[:], d.checksum) {
+		return nil
+	}
+
+	peers, err := d.parse(data)
+	if err != nil {
+		return err
+	}
+
+	d.checksum = sum[:]
+
+	listed := map[string]bool{}
+
+	for _, peer := range peers {
+		if peer.Endpoint == "" {
+			continue
+		}
+
+		listed[peer.Endpoint] = true
+
+		if known, exists := d.known[peer.Endpoint]; !exists || known.UUID != peer.UUID {
+			d.log.Debug("[discovery-file] peer added:", peer.Endpoint)
+		}
+
+		d.known[peer.Endpoint] = peer
+	}
+
+	for endpoint, peer := range d.known {
+		if !listed[endpoint] {
+			d.log.Debug("[discovery-file] peer removed:", endpoint)
+
+			delete(d.known, endpoint)
+
+			if d.lostFunc != nil {
+				d.lostFunc(peer.Endpoint, peer.UUID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// UseLostFunc sets the function to be used when a peer is removed from the file
+func (d *Discovery) UseLostFunc(lFunc grav.LostFunc) {
+	d.lostFunc = lFunc
+}
+
+// parse parses the peers in the file's contents
+func (d *Discovery) parse(data []byte) ([]Peer, error) {
+	file := peerFile{}
+
+	if strings.EqualFold(filepath.Ext(d.path), ".json") {
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, errors.Wrap(err, "failed to json.Unmarshal")
+		}
+	} else {
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return nil, errors.Wrap(err, "failed to yaml.Unmarshal")
+		}
+	}
+
+	return file.Peers, nil
+}
+
+// Stop stops Discovery
+func (d *Discovery) Stop() error {
+	d.stopChan <- struct{}{}
+
+	return nil
+}
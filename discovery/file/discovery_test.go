@@ -0,0 +1,199 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+type discovered struct {
+	endpoint string
+	uuid     string
+}
+
+func startDiscovery(t *testing.T, path string) (chan discovered, chan discovered) {
+	t.Helper()
+
+	found := make(chan discovered, 100)
+	lost := make(chan discovered, 10)
+
+	d := New(path)
+	d.interval = time.Millisecond * 20
+
+	d.UseLostFunc(func(endpoint, uuid string) {
+		lost <- discovered{endpoint, uuid}
+	})
+
+	opts := &grav.DiscoveryOpts{
+		NodeUUID: "self",
+		Logger:   vlog.Default(vlog.Level(vlog.LogLevelNull)),
+	}
+
+	go d.Start(opts, func(endpoint, uuid string) {
+		// peers are reported on every check, so reports are dropped while the test isn't reading them
+		select {
+		case found <- discovered{endpoint, uuid}:
+		default:
+		}
+	})
+
+	t.Cleanup(func() { d.Stop() })
+
+	return found, lost
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectFound(t *testing.T, found chan discovered, want discovered) {
+	t.Helper()
+
+	select {
+	case got := <-found:
+		if got != want {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for %v", want)
+	}
+}
+
+func expectNoneFound(t *testing.T, found chan discovered) {
+	t.Helper()
+
+	select {
+	case got := <-found:
+		t.Errorf("expected nothing, got %v", got)
+	case <-time.After(time.Millisecond * 200):
+	}
+}
+
+// expectReported waits for the peers reported over several checks to be exactly those wanted
+func expectReported(t *testing.T, found chan discovered, want ...discovered) {
+	t.Helper()
+
+	wanted := map[discovered]bool{}
+	for _, w := range want {
+		wanted[w] = true
+	}
+
+	reported := map[discovered]bool{}
+
+	deadline := time.Now().Add(time.Second * 2)
+	for time.Now().Before(deadline) {
+		reported = map[discovered]bool{}
+
+		window := time.After(time.Millisecond * 100)
+
+	collect:
+		for {
+			select {
+			case got := <-found:
+				reported[got] = true
+			case <-window:
+				break collect
+			}
+		}
+
+		if reflect.DeepEqual(reported, wanted) {
+			return
+		}
+	}
+
+	t.Fatalf("expected %v to be reported, got %v", want, reported)
+}
+
+func TestYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.yaml")
+
+	writeFile(t, path, `
+peers:
+  - endpoint: 10.0.0.2:8080/meta/message
+  - endpoint: 10.0.0.3:8080/meta/message
+    uuid: b
+`)
+
+	found, lost := startDiscovery(t, path)
+
+	expectReported(t, found, discovered{"10.0.0.2:8080/meta/message", ""}, discovered{"10.0.0.3:8080/meta/message", "b"})
+
+	// the added peer is reported, and the removed peer is reported lost and no longer reported
+	writeFile(t, path, `
+peers:
+  - endpoint: 10.0.0.2:8080/meta/message
+  - endpoint: 10.0.0.4:8080/meta/message
+`)
+
+	expectFound(t, lost, discovered{"10.0.0.3:8080/meta/message", "b"})
+	expectNoneFound(t, lost)
+
+	expectReported(t, found, discovered{"10.0.0.2:8080/meta/message", ""}, discovered{"10.0.0.4:8080/meta/message", ""})
+
+	// a removed peer is reported again when it returns
+	writeFile(t, path, `
+peers:
+  - endpoint: 10.0.0.2:8080/meta/message
+  - endpoint: 10.0.0.3:8080/meta/message
+    uuid: b
+  - endpoint: 10.0.0.4:8080/meta/message
+`)
+
+	expectReported(t, found,
+		discovered{"10.0.0.2:8080/meta/message", ""},
+		discovered{"10.0.0.3:8080/meta/message", "b"},
+		discovered{"10.0.0.4:8080/meta/message", ""},
+	)
+}
+
+func TestJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+
+	writeFile(t, path, `{"peers": [{"endpoint": "10.0.0.2:8080/meta/message", "uuid": "a"}]}`)
+
+	found, _ := startDiscovery(t, path)
+
+	expectReported(t, found, discovered{"10.0.0.2:8080/meta/message", "a"})
+}
+
+func TestUnchangedModTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.yaml")
+
+	// every write keeps the same modification time, as happens when the file is rewritten within the same second
+	modTime := time.Now().Truncate(time.Second)
+
+	write := func(contents string) {
+		writeFile(t, path, contents)
+
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`
+peers:
+  - endpoint: 10.0.0.2:8080/meta/message
+`)
+
+	found, lost := startDiscovery(t, path)
+
+	expectReported(t, found, discovered{"10.0.0.2:8080/meta/message", ""})
+
+	write(`
+peers:
+  - endpoint: 10.0.0.3:8080/meta/message
+`)
+
+	expectFound(t, lost, discovered{"10.0.0.2:8080/meta/message", ""})
+
+	expectReported(t, found, discovered{"10.0.0.3:8080/meta/message", ""})
+}
@@ -0,0 +1,474 @@
+package gossip
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+// ErrNoConnect is returned from Start if the Grav instance did not provide a way to connect to the bus
+var ErrNoConnect = errors.New("discovery options do not include Connect")
+
+// msgTypePrefix is shared by the types of all gossip messages. They are internal messages, so application pods don't receive them.
+const msgTypePrefix = grav.MsgTypeInternalPrefix + "gossip."
+
+// MsgTypePing and others are the types of the messages exchanged between members over the mesh
+const (
+	MsgTypePing    = msgTypePrefix + "ping"
+	MsgTypePingReq = msgTypePrefix + "pingreq"
+	MsgTypeAck     = msgTypePrefix + "ack"
+	MsgTypeSync    = msgTypePrefix + "sync"
+)
+
+const (
+	defaultProbeInterval    = time.Second
+	defaultProbeTimeout     = time.Millisecond * 300
+	defaultIndirectProbes   = 3
+	defaultSuspicionTimeout = time.Second * 5
+	defaultSyncInterval     = time.Second * 30
+
+	// maxPiggyback is the number of membership updates attached to each ping and ack
+	maxPiggyback = 8
+	// retransmitMult scales the number of times each update is piggybacked by the log of the cluster size
+	retransmitMult = 3
+	// reapTimeout is how long dead members are remembered
+	reapTimeout = time.Minute
+)
+
+// Options are the options for gossip discovery
+type Options struct {
+	// Seeds are the endpoints of known members, connected to when joining the cluster
+	Seeds []string
+	// Advertise is the endpoint other members use to connect to this node, defaulting to this node's first
+	// non-loopback IPv4 address with its transport port and URI
+	Advertise string
+	// ProbeInterval is how often a member is probed, defaulting to 1s
+	ProbeInterval time.Duration
+	// ProbeTimeout is how long to wait for an ack to a direct probe, defaulting to 300ms. Indirect probes are waited for
+	// until the end of the probe interval.
+	ProbeTimeout time.Duration
+	// IndirectProbes is the number of members asked to probe a member that did not answer a direct probe, defaulting to 3
+	IndirectProbes int
+	// SuspicionTimeout is how long a member can be suspect before it is declared dead, defaulting to 5s
+	SuspicionTimeout time.Duration
+	// SyncInterval is how often this node's full member list is sent to its peers, defaulting to 30s
+	SyncInterval time.Duration
+}
+
+// Discovery is a grav Discovery plugin implementing SWIM-style gossip membership. Nodes join through seed endpoints,
+// exchange membership over the mesh itself, and detect failed members with direct and indirect probes. Members that
+// join are connected to, and members that die or leave are reported lost.
+type Discovery struct {
+	opts       *grav.DiscoveryOpts
+	log        *vlog.Logger
+	gossipOpts Options
+	pod        *grav.Pod
+	members    *memberList
+	stopChan   chan struct{}
+
+	// acks holds the channels of probes waiting for an ack, keyed by sequence number
+	seq  uint64
+	acks map[uint64]chan struct{}
+	lock sync.Mutex
+
+	discoveryFunc grav.DiscoveryFunc
+	lostFunc      grav.LostFunc
+	peerFunc      grav.PeerFunc
+}
+
+// gossipMsg is the payload of each gossip message
+type gossipMsg struct {
+	From    string   `json:"from"`
+	Target  string   `json:"target,omitempty"`
+	Seq     uint64   `json:"seq,omitempty"`
+	Helpers []string `json:"helpers,omitempty"`
+	Updates []Member `json:"updates,omitempty"`
+}
+
+// New creates a new gossip discovery plugin
+func New(opts Options) *Discovery {
+	if opts.ProbeInterval == 0 {
+		opts.ProbeInterval = defaultProbeInterval
+	}
+
+	if opts.ProbeTimeout == 0 {
+		opts.ProbeTimeout = defaultProbeTimeout
+	}
+
+	if opts.IndirectProbes == 0 {
+		opts.IndirectProbes = defaultIndirectProbes
+	}
+
+	if opts.SuspicionTimeout == 0 {
+		opts.SuspicionTimeout = defaultSuspicionTimeout
+	}
+
+	if opts.SyncInterval == 0 {
+		opts.SyncInterval = defaultSyncInterval
+	}
+
+	d := &Discovery{
+		gossipOpts: opts,
+		stopChan:   make(chan struct{}, 1),
+		acks:       map[uint64]chan struct{}{},
+		lock:       sync.Mutex{},
+	}
+
+	return d
+}
+
+// Start starts discovery
+func (d *Discovery) Start(opts *grav.DiscoveryOpts, discoveryFunc grav.DiscoveryFunc) error {
+	d.opts = opts
+	d.log = opts.Logger
+	d.discoveryFunc = discoveryFunc
+
+	if opts.Connect == nil {
+		return ErrNoConnect
+	}
+
+	advertise := d.gossipOpts.Advertise
+	if advertise == "" {
+		var err error
+		advertise, err = advertiseEndpoint(opts)
+		if err != nil {
+			return errors.Wrap(err, "failed to advertiseEndpoint")
+		}
+	}
+
+	d.log.Debug("[discovery-gossip] starting discovery, advertising endpoint", advertise)
+
+	d.lock.Lock()
+	d.members = newMemberList(Member{
+		UUID:      opts.NodeUUID,
+		Endpoint:  advertise,
+		State:     StateAlive,
+		BelongsTo: opts.BelongsTo,
+		Interests: opts.Interests,
+		Version:   opts.Version,
+		Labels:    opts.Labels,
+	})
+	d.pod = opts.Connect()
+	d.lock.Unlock()
+
+	d.pod.On(d.handleMsg)
+
+	d.join()
+
+	probeTicker := time.NewTicker(d.gossipOpts.ProbeInterval)
+	defer probeTicker.Stop()
+
+	syncTicker := time.NewTicker(d.gossipOpts.SyncInterval)
+	defer syncTicker.Stop()
+
+	for {
+		select {
+		case <-d.stopChan:
+			return nil
+		case <-probeTicker.C:
+			d.probe()
+		case <-syncTicker.C:
+			// a node that has lost every member joins through the seeds again, such as after a partition heals
+			live := d.members.live()
+			if len(live) == 0 {
+				d.join()
+				continue
+			}
+
+			d.sendSync()
+
+			// live members are reported again so that lost connections to them are re-established
+			for _, m := range live {
+				if m.State == StateAlive {
+					d.report(m)
+				}
+			}
+		}
+	}
+}
+
+// UsePeerFunc sets the function to be used when a member joins, which receives the metadata it advertised
+func (d *Discovery) UsePeerFunc(pFunc grav.PeerFunc) {
+	d.peerFunc = pFunc
+}
+
+// UseLostFunc sets the function to be used when a member dies or leaves
+func (d *Discovery) UseLostFunc(lFunc grav.LostFunc) {
+	d.lostFunc = lFunc
+}
+
+// Members returns this node's view of the cluster, including itself
+func (d *Discovery) Members() []Member {
+	d.lock.Lock()
+	members := d.members
+	d.lock.Unlock()
+
+	if members == nil {
+		return []Member{}
+	}
+
+	return members.all()
+}
+
+// join connects to the seeds and sends them this node's member list, to which they reply with their own
+func (d *Discovery) join() {
+	for _, seed := range d.gossipOpts.Seeds {
+		d.discoveryFunc(seed, "")
+	}
+
+	d.sendSync()
+}
+
+// probe checks the next member directly, then through other members, and suspects it if neither is acknowledged
+func (d *Discovery) probe() {
+	for _, m := range d.members.expiredSuspects(d.gossipOpts.SuspicionTimeout) {
+		m.State = StateDead
+		d.apply(m)
+	}
+
+	d.members.reap(reapTimeout)
+
+	target, ok := d.members.next()
+	if !ok {
+		return
+	}
+
+	seq, ackChan := d.expectAck()
+	defer d.forgetAck(seq)
+
+	d.send(MsgTypePing, gossipMsg{Target: target.UUID, Seq: seq})
+
+	if waitAck(ackChan, d.gossipOpts.ProbeTimeout) {
+		return
+	}
+
+	helpers := d.members.helpers(target.UUID, d.gossipOpts.IndirectProbes)
+	if len(helpers) > 0 {
+		d.send(MsgTypePingReq, gossipMsg{Target: target.UUID, Seq: seq, Helpers: helpers})
+
+		if waitAck(ackChan, d.indirectTimeout()) {
+			return
+		}
+	}
+
+	d.log.Debug("[discovery-gossip] no ack from", target.UUID, "suspecting")
+
+	target.State = StateSuspect
+	d.apply(target)
+}
+
+// indirectTimeout is how long to wait for an ack from indirect probes, which is the rest of the probe interval
+func (d *Discovery) indirectTimeout() time.Duration {
+	if remaining := d.gossipOpts.ProbeInterval - d.gossipOpts.ProbeTimeout; remaining > d.gossipOpts.ProbeTimeout {
+		return remaining
+	}
+
+	return d.gossipOpts.ProbeTimeout
+}
+
+// probeFor probes a member on behalf of another, and relays the ack if one is received
+func (d *Discovery) probeFor(req gossipMsg) {
+	seq, ackChan := d.expectAck()
+	defer d.forgetAck(seq)
+
+	d.send(MsgTypePing, gossipMsg{Target: req.Target, Seq: seq})
+
+	if waitAck(ackChan, d.gossipOpts.ProbeTimeout) {
+		d.send(MsgTypeAck, gossipMsg{Target: req.From, Seq: req.Seq})
+	}
+}
+
+// handleMsg handles gossip messages from other members. Since the mesh delivers every message to every
+// connected peer, messages meant for a particular member name it as the target.
+func (d *Discovery) handleMsg(msg grav.Message) error {
+	if !strings.HasPrefix(msg.Type(), msgTypePrefix) {
+		return nil
+	}
+
+	gm := gossipMsg{}
+	if err := json.Unmarshal(msg.Data(), &gm); err != nil {
+		d.log.Debug("[discovery-gossip] message did not contain correct payload, discarding")
+		return nil
+	}
+
+	if gm.From == d.opts.NodeUUID {
+		return nil
+	}
+
+	known := d.members.has(gm.From)
+
+	for _, m := range gm.Updates {
+		d.apply(m)
+	}
+
+	switch msg.Type() {
+	case MsgTypePing:
+		if gm.Target == d.opts.NodeUUID {
+			d.send(MsgTypeAck, gossipMsg{Target: gm.From, Seq: gm.Seq})
+		}
+	case MsgTypePingReq:
+		if gm.Target != d.opts.NodeUUID && contains(gm.Helpers, d.opts.NodeUUID) {
+			go d.probeFor(gm)
+		}
+	case MsgTypeAck:
+		if gm.Target == d.opts.NodeUUID {
+			d.ack(gm.Seq)
+		}
+	case MsgTypeSync:
+		// a member that was not known is joining, and needs the rest of the member list
+		if !known {
+			d.sendSync()
+		}
+	}
+
+	return nil
+}
+
+// apply merges a membership update and reports joins and deaths to Grav
+func (d *Discovery) apply(m Member) {
+	switch d.members.apply(m) {
+	case eventJoin:
+		d.log.Debug("[discovery-gossip] member joined:", m.UUID)
+
+		d.report(m)
+	case eventSuspect:
+		d.log.Debug("[discovery-gossip] member suspected:", m.UUID)
+	case eventDead:
+		d.log.Debug("[discovery-gossip] member died:", m.UUID)
+
+		if d.lostFunc != nil {
+			d.lostFunc(m.Endpoint, m.UUID)
+		}
+	case eventRefute:
+		d.log.Debug("[discovery-gossip] refuting suspicion from", m.UUID)
+	}
+}
+
+// report reports a member to Grav, which is responsible for ensuring uniqueness of the connections
+func (d *Discovery) report(m Member) {
+	if m.Endpoint == "" {
+		return
+	}
+
+	if d.peerFunc != nil {
+		go d.peerFunc(m.peer())
+	} else {
+		go d.discoveryFunc(m.Endpoint, m.UUID)
+	}
+}
+
+// send sends a gossip message with piggybacked membership updates
+func (d *Discovery) send(msgType string, gm gossipMsg) {
+	gm.Updates = d.members.piggyback(maxPiggyback)
+
+	d.sendMsg(msgType, gm)
+}
+
+// sendSync sends this node's full member list
+func (d *Discovery) sendSync() {
+	d.sendMsg(MsgTypeSync, gossipMsg{Updates: d.members.all()})
+}
+
+func (d *Discovery) sendMsg(msgType string, gm gossipMsg) {
+	gm.From = d.opts.NodeUUID
+
+	data, err := json.Marshal(gm)
+	if err != nil {
+		d.log.Error(errors.Wrap(err, "[discovery-gossip] failed to json.Marshal"))
+		return
+	}
+
+	d.pod.Send(grav.NewMsg(msgType, data))
+}
+
+// expectAck returns a new sequence number and the channel that is signalled when it is acknowledged
+func (d *Discovery) expectAck() (uint64, chan struct{}) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.seq++
+
+	ackChan := make(chan struct{}, 1)
+	d.acks[d.seq] = ackChan
+
+	return d.seq, ackChan
+}
+
+func (d *Discovery) forgetAck(seq uint64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	delete(d.acks, seq)
+}
+
+func (d *Discovery) ack(seq uint64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if ackChan, exists := d.acks[seq]; exists {
+		select {
+		case ackChan <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func waitAck(ackChan chan struct{}, timeout time.Duration) bool {
+	select {
+	case <-ackChan:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// advertiseEndpoint returns the endpoint at this node's first non-loopback IPv4 address
+func advertiseEndpoint(opts *grav.DiscoveryOpts) (string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to InterfaceAddrs")
+	}
+
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.To4() == nil {
+			continue
+		}
+
+		return fmt.Sprintf("%s:%s%s", ipNet.IP.String(), opts.TransportPort, opts.TransportURI), nil
+	}
+
+	return "", errors.New("no non-loopback IPv4 address found")
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Stop stops Discovery, telling the other members that this node is leaving
+func (d *Discovery) Stop() error {
+	d.lock.Lock()
+	members := d.members
+	d.lock.Unlock()
+
+	if members != nil {
+		d.sendMsg(MsgTypeSync, gossipMsg{Updates: []Member{members.leave()}})
+	}
+
+	d.stopChan <- struct{}{}
+
+	return nil
+}
@@ -0,0 +1,266 @@
+package gossip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/grav/testutil/gravtest"
+	"github.com/suborbital/grav/transport/memory"
+	"github.com/suborbital/vektor/vlog"
+)
+
+func newNode(network *memory.Network, address string, seeds ...string) (*grav.Grav, *Discovery) {
+	return newNodeWithOpts(network, address, seeds)
+}
+
+func newNodeWithOpts(network *memory.Network, address string, seeds []string, mods ...grav.OptionsModifier) (*grav.Grav, *Discovery) {
+	d := New(Options{
+		Seeds:            seeds,
+		Advertise:        address,
+		ProbeInterval:    time.Millisecond * 100,
+		ProbeTimeout:     time.Millisecond * 20,
+		SuspicionTimeout: time.Millisecond * 500,
+		SyncInterval:     time.Millisecond * 200,
+	})
+
+	mods = append([]grav.OptionsModifier{
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseMeshTransport(memory.New(network, address)),
+		grav.UseDiscovery(d),
+	}, mods...)
+
+	g := grav.New(mods...)
+
+	return g, d
+}
+
+// memberStates returns the state of each member known to the node, keyed by endpoint
+func memberStates(d *Discovery) map[string]State {
+	states := map[string]State{}
+	for _, m := range d.Members() {
+		states[m.Endpoint] = m.State
+	}
+
+	return states
+}
+
+func waitForMember(t *testing.T, d *Discovery, endpoint string, state State) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		current, exists := memberStates(d)[endpoint]
+		if exists && current == state {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s to be %s, members are %v", endpoint, state, memberStates(d))
+		}
+
+		time.Sleep(time.Millisecond * 20)
+	}
+}
+
+func TestGossipMembership(t *testing.T) {
+	network := memory.NewNetwork()
+
+	_, dA := newNode(network, "a")
+	gB, dB := newNode(network, "b", "a")
+	gC, dC := newNode(network, "c", "a")
+
+	// B and C only know A, and learn about each other through gossip
+	waitForMember(t, dB, "c", StateAlive)
+	waitForMember(t, dC, "b", StateAlive)
+	waitForMember(t, dA, "b", StateAlive)
+	waitForMember(t, dA, "c", StateAlive)
+
+	// the mesh is single hop, so messages from B reaching C means they have connected to each other
+	receivedC := gravtest.Receiver(gC.Connect())
+
+	deadline := time.Now().Add(time.Second * 2)
+	for {
+		gB.Connect().Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello")))
+
+		select {
+		case <-receivedC:
+			return
+		case <-time.After(time.Millisecond * 50):
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for B to connect to C")
+		}
+	}
+}
+
+func TestGossipFailureDetection(t *testing.T) {
+	network := memory.NewNetwork()
+
+	_, dA := newNode(network, "a")
+	_, dB := newNode(network, "b", "a")
+	_, dC := newNode(network, "c", "a")
+
+	waitForMember(t, dA, "c", StateAlive)
+	waitForMember(t, dB, "c", StateAlive)
+	waitForMember(t, dC, "b", StateAlive)
+
+	// A can't reach C directly, but B can probe it on A's behalf
+	network.Partition("a", "c")
+
+	for i := 0; i < 20; i++ {
+		if state := memberStates(dA)["c"]; state != StateAlive {
+			t.Fatalf("expected C to be kept alive by indirect probes, is %s", state)
+		}
+
+		time.Sleep(time.Millisecond * 50)
+	}
+
+	// once C is unreachable from every member, it is declared dead
+	network.Partition("b", "c")
+
+	waitForMember(t, dA, "c", StateDead)
+	waitForMember(t, dB, "c", StateDead)
+}
+
+func TestGossipLeave(t *testing.T) {
+	network := memory.NewNetwork()
+
+	_, dA := newNode(network, "a")
+	_, dB := newNode(network, "b", "a")
+
+	waitForMember(t, dA, "b", StateAlive)
+
+	dB.Stop()
+
+	waitForMember(t, dA, "b", StateDead)
+}
+
+func TestGossipMetadata(t *testing.T) {
+	network := memory.NewNetwork()
+
+	// edge nodes advertise a label, and don't connect to each other
+	edgeOpts := []grav.OptionsModifier{
+		grav.UseDiscoveryLabels(map[string]string{"role": "edge"}),
+		grav.UseDiscoveryFilter(func(peer grav.PeerInfo) bool {
+			return peer.Labels["role"] != "edge"
+		}),
+	}
+
+	newNode(network, "a")
+	gB, dB := newNodeWithOpts(network, "b", []string{"a"}, edgeOpts...)
+	gC, _ := newNodeWithOpts(network, "c", []string{"a"}, edgeOpts...)
+
+	waitForMember(t, dB, "c", StateAlive)
+
+	for _, m := range dB.Members() {
+		if m.Endpoint == "c" && m.Labels["role"] != "edge" {
+			t.Errorf("expected C's labels to be gossiped, got %v", m.Labels)
+		}
+	}
+
+	// the mesh is single hop, so B's messages only reach C if they are connected
+	receivedC := gravtest.Receiver(gC.Connect())
+
+	gB.Connect().Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello")))
+
+	select {
+	case <-receivedC:
+		t.Error("expected B not to connect to C")
+	case <-time.After(time.Millisecond * 300):
+	}
+}
+
+func TestGossipFilterOnlyDials(t *testing.T) {
+	network := memory.NewNetwork()
+
+	// B skips edge nodes, but C doesn't skip B, so C dials B and the connection is accepted
+	skipEdge := grav.UseDiscoveryFilter(func(peer grav.PeerInfo) bool {
+		return peer.Labels["role"] != "edge"
+	})
+
+	newNode(network, "a")
+	gB, _ := newNodeWithOpts(network, "b", []string{"a"}, skipEdge)
+	gC, dC := newNodeWithOpts(network, "c", []string{"a"}, grav.UseDiscoveryLabels(map[string]string{"role": "edge"}))
+
+	waitForMember(t, dC, "b", StateAlive)
+
+	receivedB := gravtest.Receiver(gB.Connect())
+	pod := gC.Connect()
+
+	// the connection is set up in the background, so messages are sent until one arrives
+	deadline := time.After(time.Second * 3)
+
+	for {
+		pod.Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello")))
+
+		select {
+		case <-receivedB:
+			return
+		case <-time.After(time.Millisecond * 100):
+		case <-deadline:
+			t.Fatal("expected C to connect to B")
+		}
+	}
+}
+
+func TestGossipReportsMembersAgain(t *testing.T) {
+	network := memory.NewNetwork()
+
+	reported := make(chan struct{}, 100)
+
+	// the filter is called each time C is reported to B's hub
+	countC := grav.UseDiscoveryFilter(func(peer grav.PeerInfo) bool {
+		if peer.Endpoint == "c" {
+			select {
+			case reported <- struct{}{}:
+			default:
+			}
+		}
+
+		return true
+	})
+
+	newNode(network, "a")
+	_, dB := newNodeWithOpts(network, "b", []string{"a"}, countC)
+	newNode(network, "c", "a")
+
+	waitForMember(t, dB, "c", StateAlive)
+
+	// C joins once, and is reported again on each sync so that a lost connection to it is re-established
+	for i := 0; i < 3; i++ {
+		select {
+		case <-reported:
+		case <-time.After(time.Second):
+			t.Fatalf("expected C to be reported again, was reported %d times", i)
+		}
+	}
+}
+
+func TestGossipMessagesInternal(t *testing.T) {
+	network := memory.NewNetwork()
+
+	gA, _ := newNode(network, "a")
+	_, dB := newNode(network, "b", "a")
+
+	// pods that receive every message type don't see gossip traffic
+	gossipSeen := make(chan string, 16)
+
+	gA.Connect().On(func(msg grav.Message) error {
+		select {
+		case gossipSeen <- msg.Type():
+		default:
+		}
+
+		return nil
+	})
+
+	waitForMember(t, dB, "a", StateAlive)
+
+	select {
+	case msgType := <-gossipSeen:
+		t.Errorf("expected pod not to receive gossip messages, got %s", msgType)
+	case <-time.After(time.Millisecond * 300):
+	}
+}
@@ -0,0 +1,354 @@
+package gossip
+
+import (
+	"math/bits"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/suborbital/grav/grav"
+)
+
+// State is the state of a member as known to this node
+type State int
+
+// StateAlive and others are the states of a member
+const (
+	// StateAlive means the member is responding to probes
+	StateAlive State = iota
+	// StateSuspect means a probe of the member failed, and it will be declared dead unless it refutes the suspicion
+	StateSuspect
+	// StateDead means the member failed to refute a suspicion, or left the cluster
+	StateDead
+)
+
+// String returns the name of the state
+func (s State) String() string {
+	switch s {
+	case StateAlive:
+		return "alive"
+	case StateSuspect:
+		return "suspect"
+	default:
+		return "dead"
+	}
+}
+
+// Member is a node in the gossip cluster and the metadata it advertised. The incarnation is incremented
+// by the member itself to refute suspicions, and orders conflicting updates about it.
+type Member struct {
+	UUID        string            `json:"uuid"`
+	Endpoint    string            `json:"endpoint"`
+	Incarnation uint64            `json:"incarnation"`
+	State       State             `json:"state"`
+	BelongsTo   string            `json:"belongsTo,omitempty"`
+	Interests   []string          `json:"interests,omitempty"`
+	Version     int               `json:"version,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// peer returns the member as a discovered peer
+func (m Member) peer() grav.PeerInfo {
+	peer := grav.PeerInfo{
+		Endpoint:  m.Endpoint,
+		UUID:      m.UUID,
+		BelongsTo: m.BelongsTo,
+		Interests: m.Interests,
+		Version:   m.Version,
+		Labels:    m.Labels,
+	}
+
+	return peer
+}
+
+// event is the result of applying an update to the member list
+type event int
+
+const (
+	eventNone event = iota
+	eventJoin
+	eventSuspect
+	eventDead
+	eventRefute
+)
+
+// entry is a member and the time its state last changed
+type entry struct {
+	Member
+	changed time.Time
+}
+
+// update is a membership update waiting to be piggybacked on gossip messages
+type update struct {
+	member    Member
+	transmits int
+}
+
+// memberList holds this node's view of the cluster, including itself
+type memberList struct {
+	self    string
+	members map[string]*entry
+	updates map[string]*update
+
+	// probeOrder is a shuffled list of members probed in turn, rebuilt each time it is exhausted
+	probeOrder []string
+
+	lock sync.Mutex
+}
+
+func newMemberList(self Member) *memberList {
+	m := &memberList{
+		self: self.UUID,
+		members: map[string]*entry{
+			self.UUID: {Member: self, changed: time.Now()},
+		},
+		updates: map[string]*update{},
+		lock:    sync.Mutex{},
+	}
+
+	return m
+}
+
+// apply merges an update into the list, returning the resulting event. An update about this node that
+// suspects it or declares it dead is refuted by incrementing its incarnation.
+func (l *memberList) apply(m Member) event {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if m.UUID == l.self {
+		self := l.members[l.self]
+
+		if m.State != StateAlive && m.Incarnation >= self.Incarnation && self.State == StateAlive {
+			self.Incarnation = m.Incarnation + 1
+			l.enqueue(self.Member)
+
+			return eventRefute
+		}
+
+		return eventNone
+	}
+
+	cur, exists := l.members[m.UUID]
+	if !exists {
+		if m.State == StateDead {
+			return eventNone
+		}
+
+		l.members[m.UUID] = &entry{Member: m, changed: time.Now()}
+		l.enqueue(m)
+
+		return eventJoin
+	}
+
+	switch m.State {
+	case StateAlive:
+		if m.Incarnation <= cur.Incarnation {
+			return eventNone
+		}
+	case StateSuspect:
+		if cur.State == StateDead || m.Incarnation < cur.Incarnation || (m.Incarnation == cur.Incarnation && cur.State == StateSuspect) {
+			return eventNone
+		}
+	case StateDead:
+		if cur.State == StateDead || m.Incarnation < cur.Incarnation {
+			return eventNone
+		}
+	}
+
+	wasDead := cur.State == StateDead
+
+	if m.Endpoint == "" {
+		m.Endpoint = cur.Endpoint
+	}
+
+	cur.Member = m
+	cur.changed = time.Now()
+
+	l.enqueue(m)
+
+	switch {
+	case m.State == StateAlive && wasDead:
+		return eventJoin
+	case m.State == StateSuspect:
+		return eventSuspect
+	case m.State == StateDead:
+		return eventDead
+	}
+
+	return eventNone
+}
+
+// leave marks this node as dead, so that other members remove it rather than waiting for it to fail probes
+func (l *memberList) leave() Member {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	self := l.members[l.self]
+	self.State = StateDead
+
+	return self.Member
+}
+
+// enqueue adds an update to be piggybacked, replacing any older update about the same member. The lock must be held.
+func (l *memberList) enqueue(m Member) {
+	l.updates[m.UUID] = &update{member: m}
+}
+
+// piggyback returns up to max of the least transmitted updates, discarding updates once they have been
+// transmitted enough times to have likely reached every member
+func (l *memberList) piggyback(max int) []Member {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	pending := make([]*update, 0, len(l.updates))
+	for _, u := range l.updates {
+		pending = append(pending, u)
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].transmits < pending[j].transmits
+	})
+
+	limit := retransmitMult * bits.Len(uint(len(l.members)))
+
+	members := []Member{}
+
+	for i := 0; i < len(pending) && i < max; i++ {
+		u := pending[i]
+		members = append(members, u.member)
+
+		u.transmits++
+		if u.transmits >= limit {
+			delete(l.updates, u.member.UUID)
+		}
+	}
+
+	return members
+}
+
+// has returns true if the member is known
+func (l *memberList) has(uuid string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	_, exists := l.members[uuid]
+
+	return exists
+}
+
+// all returns every member, including this node
+func (l *memberList) all() []Member {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	members := make([]Member, 0, len(l.members))
+	for _, e := range l.members {
+		members = append(members, e.Member)
+	}
+
+	return members
+}
+
+// live returns the members other than this node that are not dead
+func (l *memberList) live() []Member {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.liveLocked()
+}
+
+func (l *memberList) liveLocked() []Member {
+	members := []Member{}
+
+	for uuid, e := range l.members {
+		if uuid != l.self && e.State != StateDead {
+			members = append(members, e.Member)
+		}
+	}
+
+	return members
+}
+
+// next returns the next member to probe, visiting every live member in a random order before repeating
+func (l *memberList) next() (Member, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for {
+		if len(l.probeOrder) == 0 {
+			live := l.liveLocked()
+			if len(live) == 0 {
+				return Member{}, false
+			}
+
+			for _, m := range live {
+				l.probeOrder = append(l.probeOrder, m.UUID)
+			}
+
+			rand.Shuffle(len(l.probeOrder), func(i, j int) {
+				l.probeOrder[i], l.probeOrder[j] = l.probeOrder[j], l.probeOrder[i]
+			})
+		}
+
+		uuid := l.probeOrder[0]
+		l.probeOrder = l.probeOrder[1:]
+
+		// members may have died since the order was built
+		if e, exists := l.members[uuid]; exists && e.State != StateDead {
+			return e.Member, true
+		}
+	}
+}
+
+// helpers returns up to k random live members other than the target, to probe it indirectly
+func (l *memberList) helpers(target string, k int) []string {
+	live := l.live()
+
+	rand.Shuffle(len(live), func(i, j int) {
+		live[i], live[j] = live[j], live[i]
+	})
+
+	helpers := []string{}
+
+	for _, m := range live {
+		if len(helpers) == k {
+			break
+		}
+
+		if m.UUID != target && m.State == StateAlive {
+			helpers = append(helpers, m.UUID)
+		}
+	}
+
+	return helpers
+}
+
+// expiredSuspects returns members that have been suspect for longer than the timeout
+func (l *memberList) expiredSuspects(timeout time.Duration) []Member {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	expired := []Member{}
+
+	for _, e := range l.members {
+		if e.State == StateSuspect && time.Since(e.changed) > timeout {
+			expired = append(expired, e.Member)
+		}
+	}
+
+	return expired
+}
+
+// reap forgets members that have been dead for longer than the timeout. They are kept until then so that
+// stale updates about them are not mistaken for a rejoin.
+func (l *memberList) reap(timeout time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for uuid, e := range l.members {
+		if uuid != l.self && e.State == StateDead && time.Since(e.changed) > timeout {
+			delete(l.members, uuid)
+		}
+	}
+}
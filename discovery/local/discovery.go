@@ -3,6 +3,7 @@ package local
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/schollz/peerdiscovery"
@@ -10,25 +11,51 @@ import (
 	"github.com/suborbital/vektor/vlog"
 )
 
+// broadcastDelay is the time between broadcasts
+const broadcastDelay = 10 * time.Second
+
+// defaultTTL is how long a peer can go without broadcasting before it is reported lost
+const defaultTTL = 3 * broadcastDelay
+
 // Discovery is a grav Discovery plugin using local network multicast
 type Discovery struct {
 	opts     *grav.DiscoveryOpts
 	log      *vlog.Logger
+	ttl      time.Duration
 	stopChan chan struct{}
 
+	// peers holds the endpoint and last broadcast time of each peer, keyed by UUID
+	peers map[string]peer
+	lock  sync.Mutex
+
 	discoveryFunc grav.DiscoveryFunc
+	lostFunc      grav.LostFunc
+	peerFunc      grav.PeerFunc
+}
+
+// peer is a peer that has been heard from
+type peer struct {
+	endpoint string
+	lastSeen time.Time
 }
 
 // payload is a discovery payload
 type payload struct {
-	UUID string `json:"uuid"`
-	Port string `json:"port"`
-	Path string `json:"path"`
+	UUID      string            `json:"uuid"`
+	Port      string            `json:"port"`
+	Path      string            `json:"path"`
+	BelongsTo string            `json:"belongsTo,omitempty"`
+	Interests []string          `json:"interests,omitempty"`
+	Version   int               `json:"version,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
 }
 
 // New creates a new local discovery plugin
 func New() *Discovery {
-	g := &Discovery{}
+	g := &Discovery{
+		ttl:   defaultTTL,
+		peers: map[string]peer{},
+	}
 
 	return g
 }
@@ -44,34 +71,51 @@ func (d *Discovery) Start(opts *grav.DiscoveryOpts, discoveryFunc grav.Discovery
 
 	payloadFunc := func() []byte {
 		payload := payload{
-			UUID: d.opts.NodeUUID,
-			Port: opts.TransportPort,
-			Path: opts.TransportURI,
+			UUID:      d.opts.NodeUUID,
+			Port:      opts.TransportPort,
+			Path:      opts.TransportURI,
+			BelongsTo: opts.BelongsTo,
+			Interests: opts.Interests,
+			Version:   opts.Version,
+			Labels:    opts.Labels,
 		}
 
 		payloadBytes, _ := json.Marshal(payload)
 		return payloadBytes
 	}
 
-	notifyFunc := func(peer peerdiscovery.Discovered) {
-		d.log.Debug("[discovery-local] potential peer found:", peer.Address)
+	notifyFunc := func(discovered peerdiscovery.Discovered) {
+		d.log.Debug("[discovery-local] potential peer found:", discovered.Address)
 
 		payload := payload{}
-		if err := json.Unmarshal(peer.Payload, &payload); err != nil {
+		if err := json.Unmarshal(discovered.Payload, &payload); err != nil {
 			d.log.Debug("[discovery-local] peer did not offer correct payload, discarding")
 			return
 		}
 
-		endpoint := fmt.Sprintf("%s:%s%s", peer.Address, payload.Port, payload.Path)
+		endpoint := fmt.Sprintf("%s:%s%s", discovered.Address, payload.Port, payload.Path)
+
+		if payload.UUID != d.opts.NodeUUID {
+			d.seen(endpoint, payload.UUID)
+		}
 
 		// send the discovery to Grav. Grav is responsible for ensuring uniqueness of the connections.
-		d.discoveryFunc(endpoint, payload.UUID)
+		if d.peerFunc != nil {
+			d.peerFunc(payload.peer(endpoint))
+		} else {
+			d.discoveryFunc(endpoint, payload.UUID)
+		}
 	}
 
+	expireDone := make(chan struct{})
+	defer close(expireDone)
+
+	go d.expirePeers(expireDone)
+
 	_, err := peerdiscovery.Discover(peerdiscovery.Settings{
 		Limit:       -1,
 		PayloadFunc: payloadFunc,
-		Delay:       10 * time.Second,
+		Delay:       broadcastDelay,
 		TimeLimit:   -1,
 		Notify:      notifyFunc,
 		AllowSelf:   true,
@@ -86,6 +130,81 @@ func (d *Discovery) UseDiscoveryFunc(dFunc func(endpoint string, uuid string)) {
 	d.discoveryFunc = dFunc
 }
 
+// UsePeerFunc sets the function to be used when a new peer is discovered, which receives the metadata it advertised
+func (d *Discovery) UsePeerFunc(pFunc grav.PeerFunc) {
+	d.peerFunc = pFunc
+}
+
+// UseLostFunc sets the function to be used when a peer has not broadcast within the TTL
+func (d *Discovery) UseLostFunc(lFunc grav.LostFunc) {
+	d.lostFunc = lFunc
+}
+
+// UseTTL sets how long a peer can go without broadcasting before it is reported lost, which defaults to 30s
+func (d *Discovery) UseTTL(ttl time.Duration) {
+	d.ttl = ttl
+}
+
+// peer returns the peer that sent the payload
+func (p payload) peer(endpoint string) grav.PeerInfo {
+	peer := grav.PeerInfo{
+		Endpoint:  endpoint,
+		UUID:      p.UUID,
+		BelongsTo: p.BelongsTo,
+		Interests: p.Interests,
+		Version:   p.Version,
+		Labels:    p.Labels,
+	}
+
+	return peer
+}
+
+// seen records that a peer has broadcast
+func (d *Discovery) seen(endpoint, uuid string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.peers[uuid] = peer{endpoint: endpoint, lastSeen: time.Now()}
+}
+
+// expirePeers reports peers that have not broadcast within the TTL as lost, until done is closed
+func (d *Discovery) expirePeers(done chan struct{}) {
+	ticker := time.NewTicker(broadcastDelay)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			for uuid, endpoint := range d.expired(time.Now()) {
+				d.log.Debug("[discovery-local] peer expired:", endpoint)
+
+				if d.lostFunc != nil {
+					d.lostFunc(endpoint, uuid)
+				}
+			}
+		}
+	}
+}
+
+// expired removes and returns the endpoints of peers, keyed by UUID, that have not broadcast within the TTL
+func (d *Discovery) expired(now time.Time) map[string]string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	expired := map[string]string{}
+
+	for uuid, p := range d.peers {
+		if now.Sub(p.lastSeen) > d.ttl {
+			expired[uuid] = p.endpoint
+			delete(d.peers, uuid)
+		}
+	}
+
+	return expired
+}
+
 // Stop stops Discovery
 func (d *Discovery) Stop() error {
 	d.stopChan <- struct{}{}
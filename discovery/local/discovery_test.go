@@ -0,0 +1,33 @@
+package local
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpired(t *testing.T) {
+	d := New()
+	d.UseTTL(time.Second * 30)
+
+	now := time.Now()
+
+	d.peers["a"] = peer{endpoint: "10.0.0.2:8080/meta/message", lastSeen: now.Add(-time.Second * 10)}
+	d.peers["b"] = peer{endpoint: "10.0.0.3:8080/meta/message", lastSeen: now.Add(-time.Second * 40)}
+
+	expired := d.expired(now)
+
+	if len(expired) != 1 || expired["b"] != "10.0.0.3:8080/meta/message" {
+		t.Errorf("expected only b to expire, got %v", expired)
+	}
+
+	if _, exists := d.peers["b"]; exists {
+		t.Error("expected expired peer to be forgotten")
+	}
+
+	// a peer that broadcasts again is tracked anew
+	d.seen("10.0.0.3:8080/meta/message", "b")
+
+	if expired := d.expired(now.Add(time.Second * 25)); len(expired) != 1 || expired["a"] == "" {
+		t.Errorf("expected only a to expire, got %v", expired)
+	}
+}
@@ -0,0 +1,67 @@
+package static
+
+import (
+	"time"
+
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+// defaultInterval is how often the endpoints are reported
+const defaultInterval = time.Second * 10
+
+// Discovery is a grav Discovery plugin that connects to a fixed list of endpoints, for networks where multicast is unavailable.
+// The UUID of each peer is learned during the connection handshake.
+type Discovery struct {
+	opts      *grav.DiscoveryOpts
+	log       *vlog.Logger
+	endpoints []string
+	interval  time.Duration
+	stopChan  chan struct{}
+
+	discoveryFunc grav.DiscoveryFunc
+}
+
+// New creates a new static discovery plugin for the given endpoints
+func New(endpoints ...string) *Discovery {
+	d := &Discovery{
+		endpoints: endpoints,
+		interval:  defaultInterval,
+		stopChan:  make(chan struct{}, 1),
+	}
+
+	return d
+}
+
+// Start starts discovery, reporting each endpoint to Grav periodically so that endpoints which could not be reached,
+// or whose connections were lost, are connected to again. Grav is responsible for ensuring uniqueness of the connections.
+func (d *Discovery) Start(opts *grav.DiscoveryOpts, discoveryFunc grav.DiscoveryFunc) error {
+	d.opts = opts
+	d.log = opts.Logger
+	d.discoveryFunc = discoveryFunc
+
+	d.log.Debug("[discovery-static] starting discovery with", len(d.endpoints), "endpoints")
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, endpoint := range d.endpoints {
+			d.discoveryFunc(endpoint, "")
+		}
+
+		select {
+		case <-d.stopChan:
+			return nil
+		case <-ticker.C:
+			// continue
+		}
+	}
+}
+
+// Stop stops Discovery
+func (d *Discovery) Stop() error {
+	d.stopChan <- struct{}{}
+
+	return nil
+}
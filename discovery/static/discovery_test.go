@@ -0,0 +1,57 @@
+package static
+
+import (
+	"testing"
+	"time"
+
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/grav/transport/memory"
+	"github.com/suborbital/vektor/vlog"
+)
+
+func TestStatic(t *testing.T) {
+	network := memory.NewNetwork()
+
+	d := New("b")
+	d.interval = time.Millisecond * 50
+
+	gA := grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseMeshTransport(memory.New(network, "a")),
+		grav.UseDiscovery(d),
+	)
+
+	defer d.Stop()
+
+	// B starts after A has failed to connect to it, so it is only reached once the endpoint is reported again
+	time.Sleep(time.Millisecond * 100)
+
+	gB := grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseMeshTransport(memory.New(network, "b")),
+	)
+
+	received := make(chan string, 16)
+
+	gB.Connect().On(func(msg grav.Message) error {
+		received <- string(msg.Data())
+		return nil
+	})
+
+	podA := gA.Connect()
+
+	deadline := time.Now().Add(time.Second * 2)
+	for {
+		podA.Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello")))
+
+		select {
+		case <-received:
+			return
+		case <-time.After(time.Millisecond * 50):
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for A to connect to B")
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package unix
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+// socketExt matches the extension used by the unix transport
+const socketExt = ".sock"
+
+// defaultInterval is how often the socket directory is scanned
+const defaultInterval = time.Second * 2
+
+// Discovery is a grav Discovery plugin that finds peers by scanning a directory of Unix sockets
+// created by the unix transport, where each socket is named for the UUID of the node listening on it
+type Discovery struct {
+	opts     *grav.DiscoveryOpts
+	log      *vlog.Logger
+	dir      string
+	interval time.Duration
+	stopChan chan struct{}
+
+	discoveryFunc grav.DiscoveryFunc
+}
+
+// New creates a new unix discovery plugin that scans dir
+func New(dir string) *Discovery {
+	d := &Discovery{
+		dir:      dir,
+		interval: defaultInterval,
+		stopChan: make(chan struct{}, 1),
+	}
+
+	return d
+}
+
+// Start starts discovery
+func (d *Discovery) Start(opts *grav.DiscoveryOpts, discoveryFunc grav.DiscoveryFunc) error {
+	d.opts = opts
+	d.log = opts.Logger
+	d.discoveryFunc = discoveryFunc
+
+	d.log.Debug("[discovery-unix] starting discovery, scanning", d.dir)
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.scan(); err != nil {
+			d.log.Error(errors.Wrap(err, "[discovery-unix] failed to scan"))
+		}
+
+		select {
+		case <-d.stopChan:
+			return nil
+		case <-ticker.C:
+			// continue
+		}
+	}
+}
+
+// scan reports each socket in the directory to Grav, which is responsible for ensuring uniqueness of the connections
+func (d *Discovery) scan() error {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return errors.Wrap(err, "failed to ReadDir")
+	}
+
+	for _, entry := range entries {
+		if entry.Type()&os.ModeSocket == 0 || !strings.HasSuffix(entry.Name(), socketExt) {
+			continue
+		}
+
+		uuid := strings.TrimSuffix(entry.Name(), socketExt)
+		if uuid == d.opts.NodeUUID {
+			continue
+		}
+
+		d.discoveryFunc(filepath.Join(d.dir, entry.Name()), uuid)
+	}
+
+	return nil
+}
+
+// Stop stops Discovery
+func (d *Discovery) Stop() error {
+	d.stopChan <- struct{}{}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package unix
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+func listen(t *testing.T, path string) {
+	t.Helper()
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+}
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+
+	listen(t, filepath.Join(dir, "a.sock"))
+	listen(t, filepath.Join(dir, "b.sock"))
+	listen(t, filepath.Join(dir, "self.sock"))
+	listen(t, filepath.Join(dir, "c.other"))
+
+	// files that aren't sockets are skipped even if they have the socket extension
+	if err := os.WriteFile(filepath.Join(dir, "d.sock"), []byte{}, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	found := map[string]string{}
+
+	d := New(dir)
+	d.opts = &grav.DiscoveryOpts{NodeUUID: "self"}
+	d.discoveryFunc = func(endpoint, uuid string) {
+		found[uuid] = endpoint
+	}
+
+	if err := d.scan(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the node's own socket is not reported
+	expected := map[string]string{
+		"a": filepath.Join(dir, "a.sock"),
+		"b": filepath.Join(dir, "b.sock"),
+	}
+
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected %v, got %v", expected, found)
+	}
+}
+
+func TestScanMissingDir(t *testing.T) {
+	d := New(filepath.Join(t.TempDir(), "missing"))
+	d.opts = &grav.DiscoveryOpts{NodeUUID: "self"}
+	d.discoveryFunc = func(endpoint, uuid string) {
+		t.Errorf("expected nothing to be reported, got %s", uuid)
+	}
+
+	// the directory is created once the first node listens, so it not existing yet is not an error
+	if err := d.scan(); err != nil {
+		t.Errorf("expected no error, got %s", err)
+	}
+}
+
+func TestStop(t *testing.T) {
+	d := New(t.TempDir())
+	d.interval = time.Millisecond * 20
+
+	// stopping before starting does not block, and the discovery stops once it has started
+	if err := d.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &grav.DiscoveryOpts{
+		NodeUUID: "self",
+		Logger:   vlog.Default(vlog.Level(vlog.LogLevelNull)),
+	}
+
+	stopped := make(chan error)
+
+	go func() {
+		stopped <- d.Start(opts, func(endpoint, uuid string) {})
+	}()
+
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for discovery to stop")
+	}
+}
@@ -0,0 +1,134 @@
+package grav
+
+import (
+	"path"
+	"sync/atomic"
+)
+
+// ACL is a set of rules that controls which mesh peers may publish and receive which message types.
+// Rules are enforced when messages arrive from a peer and before messages are sent to a peer.
+// Peers that do not match any rule are allowed to publish and receive everything if DefaultAllow is set, and nothing otherwise.
+//
+// Messages exchanged between Grav instances and their discovery plugins (those with types beginning with MsgTypeInternalPrefix,
+// such as gossip) are subject to the ACL too. When DefaultAllow is not set, or a peer matches a rule, a rule must allow
+// `grav.internal.*` for those messages to be exchanged with the peer.
+type ACL struct {
+	// the counters are first to keep them 64-bit aligned for atomic access
+	publishDenied uint64
+	receiveDenied uint64
+
+	Rules        []ACLRule
+	DefaultAllow bool
+}
+
+// ACLRule grants a set of peers permission to publish and receive message types. A peer matches the rule if
+// each of the UUID, BelongsTo and Identity fields that are set match the peer's (Identity is the authenticated identity).
+// Message types are patterns, where '*' matches any sequence of characters (for example `user.*`).
+//
+// UUID and BelongsTo are claimed by the peer in its handshake and are not verified, so any peer able to connect can
+// match a rule that only sets them. Rules that grant permissions to particular peers should set Identity, which is
+// verified by the Authenticator set with UseAuthenticator.
+type ACLRule struct {
+	UUID      string
+	BelongsTo string
+	Identity  string
+
+	// Publish lists the message types the peers may send to this node
+	Publish []string
+	// Receive lists the message types this node may send to the peers
+	Receive []string
+}
+
+// ACLStats are the number of messages that have been denied by an ACL
+type ACLStats struct {
+	PublishDenied uint64
+	ReceiveDenied uint64
+}
+
+// MatchMsgType returns true if the message type matches the pattern. '*' matches any sequence of characters,
+// '?' matches any single character, and an invalid pattern never matches.
+func MatchMsgType(pattern, msgType string) bool {
+	matched, err := path.Match(pattern, msgType)
+	if err != nil {
+		return false
+	}
+
+	return matched
+}
+
+// Stats returns the number of messages that have been denied by the ACL
+func (a *ACL) Stats() ACLStats {
+	stats := ACLStats{
+		PublishDenied: atomic.LoadUint64(&a.publishDenied),
+		ReceiveDenied: atomic.LoadUint64(&a.receiveDenied),
+	}
+
+	return stats
+}
+
+// allowPublish returns true if the peer may send a message of the given type to this node
+func (a *ACL) allowPublish(peer *connectionHandler, msgType string) bool {
+	if a == nil {
+		return true
+	}
+
+	if a.allow(peer, msgType, func(r ACLRule) []string { return r.Publish }) {
+		return true
+	}
+
+	atomic.AddUint64(&a.publishDenied, 1)
+
+	return false
+}
+
+// allowReceive returns true if a message of the given type may be sent to the peer
+func (a *ACL) allowReceive(peer *connectionHandler, msgType string) bool {
+	if a == nil {
+		return true
+	}
+
+	if a.allow(peer, msgType, func(r ACLRule) []string { return r.Receive }) {
+		return true
+	}
+
+	atomic.AddUint64(&a.receiveDenied, 1)
+
+	return false
+}
+
+func (a *ACL) allow(peer *connectionHandler, msgType string, patterns func(ACLRule) []string) bool {
+	matchedRule := false
+
+	for _, rule := range a.Rules {
+		if !rule.matches(peer) {
+			continue
+		}
+
+		matchedRule = true
+
+		for _, pattern := range patterns(rule) {
+			if MatchMsgType(pattern, msgType) {
+				return true
+			}
+		}
+	}
+
+	return !matchedRule && a.DefaultAllow
+}
+
+// matches returns true if the rule applies to the peer
+func (r ACLRule) matches(peer *connectionHandler) bool {
+	if r.UUID != "" && r.UUID != peer.UUID {
+		return false
+	}
+
+	if r.BelongsTo != "" && r.BelongsTo != peer.BelongsTo {
+		return false
+	}
+
+	if r.Identity != "" && r.Identity != peer.Identity {
+		return false
+	}
+
+	return true
+}
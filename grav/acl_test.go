@@ -0,0 +1,57 @@
+package grav
+
+import "testing"
+
+func TestACL(t *testing.T) {
+	acl := &ACL{
+		Rules: []ACLRule{
+			{BelongsTo: "billing", Publish: []string{"invoice.*"}, Receive: []string{"payment.received"}},
+			{Identity: "admin", Publish: []string{"*"}, Receive: []string{"*"}},
+		},
+		DefaultAllow: false,
+	}
+
+	billing := &connectionHandler{UUID: "a", BelongsTo: "billing"}
+	admin := &connectionHandler{UUID: "b", BelongsTo: "ops", Identity: "admin"}
+	stranger := &connectionHandler{UUID: "c", BelongsTo: "ops"}
+
+	if !acl.allowPublish(billing, "invoice.created") {
+		t.Error("expected billing to publish invoice.created")
+	}
+
+	if acl.allowPublish(billing, "payment.received") {
+		t.Error("expected billing to be denied publishing payment.received")
+	}
+
+	if !acl.allowReceive(billing, "payment.received") {
+		t.Error("expected billing to receive payment.received")
+	}
+
+	if !acl.allowPublish(admin, "anything.at.all") || !acl.allowReceive(admin, "anything.at.all") {
+		t.Error("expected admin to publish and receive everything")
+	}
+
+	if acl.allowPublish(stranger, "invoice.created") || acl.allowReceive(stranger, "payment.received") {
+		t.Error("expected stranger to be denied")
+	}
+
+	stats := acl.Stats()
+	if stats.PublishDenied != 2 || stats.ReceiveDenied != 1 {
+		t.Errorf("expected 2 publish and 1 receive denials, got %+v", stats)
+	}
+
+	acl.DefaultAllow = true
+
+	if !acl.allowPublish(stranger, "invoice.created") {
+		t.Error("expected stranger to be allowed by default")
+	}
+
+	if acl.allowPublish(billing, "payment.received") {
+		t.Error("expected billing to be denied even when allowed by default, because a rule matched")
+	}
+
+	var nilACL *ACL
+	if !nilACL.allowPublish(stranger, "invoice.created") {
+		t.Error("expected a nil ACL to allow everything")
+	}
+}
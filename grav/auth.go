@@ -0,0 +1,42 @@
+package grav
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// Authenticator is a plugin that allows the hub to authenticate mesh peers during the handshake.
+// The node initiating a connection sends a fresh challenge along with credentials bound to it and to the UUID of the
+// accepting node, and the accepting node must answer with credentials bound to that same challenge, making the
+// authentication mutual. The identity returned from Verify is whatever the peer's credentials assert: with a key shared
+// by every node (such as the auth package's PSK and Token), any node holding the key can claim any identity, so it
+// identifies a group of nodes rather than an individual node. Use TLS with VerifyPeer for per-node identities.
+type Authenticator interface {
+	// Credentials returns credentials that prove the identity of nodeUUID, bound to the provided challenge
+	Credentials(nodeUUID, challenge string) (string, error)
+	// Verify checks the credentials presented by peerUUID for the provided challenge
+	// and returns the authenticated identity of the peer
+	Verify(peerUUID, challenge, credentials string) (string, error)
+}
+
+// newChallenge returns a random challenge to be sent with an outgoing handshake
+func newChallenge() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(nonce), nil
+}
+
+// handshakeChallenge derives the challenge used for the credentials in a handshake. Binding the credentials to the UUID
+// of the node receiving them ensures that a captured handshake can't be replayed to a different node.
+func handshakeChallenge(challenge, recipientUUID string) string {
+	return challenge + "." + recipientUUID
+}
+
+// ackChallenge derives the challenge used for the credentials in a handshake ack. Binding the ack to a different
+// value than the handshake ensures that credentials taken from an ack can never be reflected back as a handshake.
+func ackChallenge(challenge string) string {
+	return challenge + ".ack"
+}
@@ -0,0 +1,113 @@
+package grav
+
+import (
+	"testing"
+
+	"github.com/suborbital/grav/auth"
+	"github.com/suborbital/vektor/vlog"
+)
+
+// handshakeConn is a connection that delivers a handshake to the hub and records the ack
+type handshakeConn struct {
+	handshake *TransportHandshake
+	ack       *TransportHandshakeAck
+}
+
+func (c *handshakeConn) SendMsg(msg Message) error { return nil }
+
+func (c *handshakeConn) ReadMsg() (Message, *Withdraw, error) { return nil, nil, ErrConnectionClosed }
+
+func (c *handshakeConn) OutgoingHandshake(handshake *TransportHandshake) (*TransportHandshakeAck, error) {
+	return nil, ErrConnectionClosed
+}
+
+func (c *handshakeConn) IncomingHandshake(callback HandshakeCallback) error {
+	c.ack = callback(c.handshake)
+
+	return nil
+}
+
+func (c *handshakeConn) SendWithdraw(withdraw *Withdraw) error { return nil }
+
+func (c *handshakeConn) Close() error { return nil }
+
+func TestHandshakeBoundToRecipient(t *testing.T) {
+	newNode := func(uuid string) *Grav {
+		return New(
+			UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+			UseNodeUUID(uuid),
+			UseAuthenticator(auth.NewPSK([]byte("secret"), "mesh")),
+		)
+	}
+
+	gB, gC := newNode("b"), newNode("c")
+
+	challenge, err := newChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A's handshake to B, as it would be captured on the wire
+	credentials, err := auth.NewPSK([]byte("secret"), "mesh").Credentials("a", handshakeChallenge(challenge, "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handshake := &TransportHandshake{
+		UUID:        "a",
+		BelongsTo:   gB.BelongsTo,
+		Version:     ProtocolVersion,
+		Challenge:   challenge,
+		Credentials: credentials,
+	}
+
+	// replaying it to C fails, since the credentials are bound to B
+	conn := &handshakeConn{handshake: handshake}
+	gC.hub.handleIncomingConnection(conn)
+
+	if conn.ack == nil || conn.ack.Accept {
+		t.Error("expected C to reject a handshake meant for B")
+	}
+
+	conn = &handshakeConn{handshake: handshake}
+	gB.hub.handleIncomingConnection(conn)
+
+	if conn.ack == nil || !conn.ack.Accept {
+		t.Errorf("expected B to accept the handshake, got %+v", conn.ack)
+	}
+}
+
+func TestIdentifyHandshake(t *testing.T) {
+	g := New(
+		UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		UseNodeUUID("b"),
+		UseAuthenticator(auth.NewPSK([]byte("secret"), "mesh")),
+	)
+
+	handshake := &TransportHandshake{
+		UUID:      "a",
+		BelongsTo: g.BelongsTo,
+		Version:   ProtocolVersion,
+		Identify:  true,
+	}
+
+	conn := &handshakeConn{handshake: handshake}
+	g.hub.handleIncomingConnection(conn)
+
+	// the ack carries the node's UUID, and the handshake is neither accepted nor treated as failing authentication
+	if conn.ack == nil || conn.ack.UUID != "b" {
+		t.Fatalf("expected an ack with UUID b, got %+v", conn.ack)
+	}
+
+	if conn.ack.Accept {
+		t.Error("expected the identify handshake not to be accepted")
+	}
+
+	if errFromReason(conn.ack.Reason) == ErrAuthFailed || conn.ack.Credentials != "" {
+		t.Errorf("expected the identify handshake not to be authenticated, got %+v", conn.ack)
+	}
+
+	if _, exists := g.hub.findConnection("a"); exists {
+		t.Error("expected no connection to be added for the identify handshake")
+	}
+}
@@ -0,0 +1,254 @@
+package grav
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// minBridgeBackoff and maxBridgeBackoff bound the wait between attempts to reconnect a failed bridge topic
+	minBridgeBackoff = time.Second
+	maxBridgeBackoff = time.Second * 30
+)
+
+// BridgeState is the health of the connection to a bridge topic
+type BridgeState int
+
+// BridgeStateDisconnected and others are the states of a bridge topic
+const (
+	// BridgeStateDisconnected means the topic is not connected, either because it never was or because it was disconnected
+	BridgeStateDisconnected BridgeState = iota
+	// BridgeStateConnected means the topic's connection is exchanging messages
+	BridgeStateConnected
+	// BridgeStateReconnecting means the topic's connection failed and is being re-established
+	BridgeStateReconnecting
+)
+
+// String returns the name of the state
+func (b BridgeState) String() string {
+	switch b {
+	case BridgeStateConnected:
+		return "connected"
+	case BridgeStateReconnecting:
+		return "reconnecting"
+	default:
+		return "disconnected"
+	}
+}
+
+// BridgeErrorFunc is called with the topic and error when a bridge connection fails or cannot be re-established
+type BridgeErrorFunc func(topic string, err error)
+
+// Failed is called by a bridge connection when it can no longer exchange messages, such as when its subscription has failed.
+// The connection is closed and the topic is reconnected with backoff, so the connection should stop receiving after calling Failed.
+func (b *BridgeOptions) Failed(conn BridgeConnection, err error) {
+	if b.failFunc == nil {
+		return
+	}
+
+	// handled in the background since the connection will be closed, which may wait for the caller to return
+	go b.failFunc(conn, err)
+}
+
+// bridgeTopic is a topic connected to the bridge transport and the pod its connection uses
+type bridgeTopic struct {
+	topic   string
+	mapping *TopicMapping
+	conn    BridgeConnection
+	pod     *Pod
+	state   BridgeState
+	closed  bool
+
+	// published holds the UUIDs of messages recently published to the topic, so that they are not published again
+	// and echoes from the broker can be discarded
+	published *uuidHistory
+}
+
+// publishes returns true if messages of the given type are published to the topic by its connection
+func (bt *bridgeTopic) publishes(msgType string) bool {
+	if bt.mapping != nil {
+		return bt.mapping.Publishes(msgType)
+	}
+
+	return DefaultTopicMapping(bt.topic).Publishes(msgType)
+}
+
+// connectBridge connects to a topic on the bridge transport, using the mapping if one is provided
+func (h *hub) connectBridge(topic string, mapping *TopicMapping) (BridgeConnection, error) {
+	if mapping != nil {
+		mapper, ok := h.bridge.(MappingBridgeTransport)
+		if !ok {
+			return nil, ErrMappingNotSupported
+		}
+
+		return mapper.ConnectTopicWithMapping(topic, *mapping)
+	}
+
+	return h.bridge.ConnectTopic(topic)
+}
+
+// disconnectBridgeTopic closes the connection to a topic and stops it from being reconnected
+func (h *hub) disconnectBridgeTopic(topic string) error {
+	if h.bridge == nil {
+		return ErrTransportNotConfigured
+	}
+
+	h.lock.Lock()
+
+	bt, exists := h.bridgeTopics[topic]
+	if !exists {
+		h.lock.Unlock()
+		return ErrBridgeTopicNotConnected
+	}
+
+	h.log.Debug("[grav] disconnecting from topic", topic)
+
+	conn, pod := h.closeBridgeTopicLocked(bt)
+	delete(h.bridgeTopics, topic)
+
+	h.lock.Unlock()
+
+	closeBridgeConn(conn, pod)
+
+	return nil
+}
+
+// bridgeTopicState returns the state of a topic's connection
+func (h *hub) bridgeTopicState(topic string) BridgeState {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	bt, exists := h.bridgeTopics[topic]
+	if !exists {
+		return BridgeStateDisconnected
+	}
+
+	return bt.state
+}
+
+// closeBridgeTopicLocked marks a topic as closed and returns its connection and pod, which must be closed with
+// closeBridgeConn once the hub's lock is released. The hub's lock must be held.
+func (h *hub) closeBridgeTopicLocked(bt *bridgeTopic) (BridgeConnection, *Pod) {
+	bt.closed = true
+
+	// a reconnecting topic's connection and pod have already been closed
+	connected := bt.state == BridgeStateConnected
+	bt.state = BridgeStateDisconnected
+
+	if !connected {
+		return nil, nil
+	}
+
+	return bt.conn, bt.pod
+}
+
+// closeBridgeConn closes a topic's connection and disconnects its pod. The hub's lock must not be held, since
+// connections may wait for their goroutines, which send messages through the hub, to return when closing.
+func closeBridgeConn(conn BridgeConnection, pod *Pod) {
+	if conn != nil {
+		conn.Close()
+	}
+
+	if pod != nil {
+		pod.Disconnect()
+	}
+}
+
+// handleBridgeFailure closes a failed connection and begins reconnecting its topic
+func (h *hub) handleBridgeFailure(conn BridgeConnection, err error) {
+	h.lock.Lock()
+
+	var failed *bridgeTopic
+	for _, bt := range h.bridgeTopics {
+		if bt.conn == conn && bt.state == BridgeStateConnected {
+			failed = bt
+			break
+		}
+	}
+
+	// the connection may have been closed or already replaced
+	if failed == nil {
+		h.lock.Unlock()
+		return
+	}
+
+	h.log.Error(errors.Wrapf(err, "[grav] bridge connection for %s failed, reconnecting", failed.topic))
+
+	failed.state = BridgeStateReconnecting
+	conn, pod := failed.conn, failed.pod
+
+	h.lock.Unlock()
+
+	closeBridgeConn(conn, pod)
+
+	h.reportBridgeError(failed.topic, err)
+
+	h.reconnectBridgeTopic(failed)
+}
+
+// reconnectBridgeTopic connects to a failed topic again, with backoff, until it succeeds or the topic is disconnected
+func (h *hub) reconnectBridgeTopic(bt *bridgeTopic) {
+	backoff := minBridgeBackoff
+
+	for {
+		time.Sleep(backoff)
+
+		h.lock.RLock()
+		closed := bt.closed
+		h.lock.RUnlock()
+
+		if closed {
+			return
+		}
+
+		conn, err := h.connectBridge(bt.topic, bt.mapping)
+		if err != nil {
+			h.log.Error(errors.Wrapf(err, "[grav] failed to reconnect to topic %s", bt.topic))
+			h.reportBridgeError(bt.topic, err)
+
+			backoff *= 2
+			if backoff > maxBridgeBackoff {
+				backoff = maxBridgeBackoff
+			}
+
+			continue
+		}
+
+		pod := h.topicPod(bt)
+
+		h.lock.Lock()
+
+		// the topic may have been disconnected while connecting
+		if bt.closed {
+			h.lock.Unlock()
+			closeBridgeConn(conn, pod)
+
+			return
+		}
+
+		h.log.Info("[grav] reconnected to topic", bt.topic)
+
+		bt.pod = pod
+		bt.conn = conn
+		bt.state = BridgeStateConnected
+
+		h.lock.Unlock()
+
+		// started once the topic is updated, so that the connection's failures are handled
+		conn.Start(pod)
+
+		return
+	}
+}
+
+// topicPod creates the pod used by a bridge topic's connection
+func (h *hub) topicPod(bt *bridgeTopic) *Pod {
+	return h.connectFunc(&podOpts{relay: h.topicRelay(bt)})
+}
+
+func (h *hub) reportBridgeError(topic string, err error) {
+	if h.bridgeErrorHandler != nil {
+		h.bridgeErrorHandler(topic, err)
+	}
+}
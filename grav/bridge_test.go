@@ -0,0 +1,253 @@
+package grav
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/suborbital/vektor/vlog"
+)
+
+// fakeBridge is a bridge transport that records its connections, allowing failures to be simulated
+type fakeBridge struct {
+	opts  *BridgeOptions
+	conns []*fakeBridgeConn
+
+	// connectErrs is the number of ConnectTopic calls that fail before connecting succeeds
+	connectErrs int
+
+	lock sync.Mutex
+}
+
+type fakeBridgeConn struct {
+	pod    *Pod
+	closed bool
+	lock   sync.Mutex
+}
+
+func (f *fakeBridge) Setup(opts *BridgeOptions) error {
+	f.opts = opts
+
+	return nil
+}
+
+func (f *fakeBridge) ConnectTopic(topic string) (BridgeConnection, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.connectErrs > 0 {
+		f.connectErrs--
+		return nil, errors.New("broker unavailable")
+	}
+
+	conn := &fakeBridgeConn{}
+	f.conns = append(f.conns, conn)
+
+	return conn, nil
+}
+
+func (f *fakeBridge) conn(i int) *fakeBridgeConn {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if i >= len(f.conns) {
+		return nil
+	}
+
+	return f.conns[i]
+}
+
+func (f *fakeBridgeConn) Start(pod *Pod) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.pod = pod
+}
+
+func (f *fakeBridgeConn) topicPod() *Pod {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.pod
+}
+
+func (f *fakeBridgeConn) Close() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.closed = true
+}
+
+func (f *fakeBridgeConn) isClosed() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.closed
+}
+
+func waitForState(t *testing.T, g *Grav, topic string, state BridgeState, timeout time.Duration) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for g.BridgeTopicState(topic) != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s to be %s, is %s", topic, state, g.BridgeTopicState(topic))
+		}
+
+		time.Sleep(time.Millisecond * 20)
+	}
+}
+
+func TestBridgeReconnect(t *testing.T) {
+	bridge := &fakeBridge{}
+
+	errTopics := make(chan string, 10)
+
+	g := New(
+		UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		UseBridgeTransport(bridge),
+		UseBridgeErrorHandler(func(topic string, err error) {
+			errTopics <- topic
+		}),
+	)
+
+	if err := g.ConnectBridgeTopic("events"); err != nil {
+		t.Fatal(err)
+	}
+
+	if state := g.BridgeTopicState("events"); state != BridgeStateConnected {
+		t.Fatalf("expected connected, got %s", state)
+	}
+
+	// the first reconnect attempt fails, so the topic is reconnected on the second
+	bridge.lock.Lock()
+	bridge.connectErrs = 1
+	bridge.lock.Unlock()
+
+	bridge.opts.Failed(bridge.conn(0), errors.New("subscription failed"))
+
+	waitForState(t, g, "events", BridgeStateReconnecting, time.Second)
+
+	if !bridge.conn(0).isClosed() {
+		t.Error("expected failed connection to be closed")
+	}
+
+	waitForState(t, g, "events", BridgeStateConnected, time.Second*5)
+
+	if bridge.conn(1) == nil || bridge.conn(1).isClosed() {
+		t.Error("expected a new open connection")
+	}
+
+	// one error for the failure, and one for the failed reconnect attempt
+	for i := 0; i < 2; i++ {
+		select {
+		case topic := <-errTopics:
+			if topic != "events" {
+				t.Errorf("expected error for events, got %s", topic)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for error handler")
+		}
+	}
+
+	// failures reported by connections that have been replaced are ignored
+	bridge.opts.Failed(bridge.conn(0), errors.New("subscription failed"))
+	time.Sleep(time.Millisecond * 100)
+
+	if state := g.BridgeTopicState("events"); state != BridgeStateConnected {
+		t.Errorf("expected connected, got %s", state)
+	}
+}
+
+func TestDisconnectBridgeTopic(t *testing.T) {
+	bridge := &fakeBridge{}
+
+	g := New(
+		UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		UseBridgeTransport(bridge),
+	)
+
+	if err := g.ConnectBridgeTopic("events"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.DisconnectBridgeTopic("events"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bridge.conn(0).isClosed() {
+		t.Error("expected connection to be closed")
+	}
+
+	if state := g.BridgeTopicState("events"); state != BridgeStateDisconnected {
+		t.Errorf("expected disconnected, got %s", state)
+	}
+
+	if err := g.DisconnectBridgeTopic("events"); err != ErrBridgeTopicNotConnected {
+		t.Errorf("expected ErrBridgeTopicNotConnected, got %v", err)
+	}
+
+	// a disconnected topic is not reconnected if its connection reports a failure
+	bridge.opts.Failed(bridge.conn(0), errors.New("subscription failed"))
+	time.Sleep(time.Millisecond * 100)
+
+	if bridge.conn(1) != nil {
+		t.Error("expected disconnected topic not to be reconnected")
+	}
+}
+
+func TestBridgePublishRetry(t *testing.T) {
+	bridge := &fakeBridge{}
+
+	g := New(
+		UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		UseBridgeTransport(bridge),
+	)
+
+	if err := g.ConnectBridgeTopic(MsgTypeDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	published := make(chan string, 10)
+	failed := false
+	lock := sync.Mutex{}
+
+	// the first attempt to publish fails, as if the broker was briefly unavailable
+	bridge.conn(0).topicPod().On(func(msg Message) error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if string(msg.Data()) == "first" && !failed {
+			failed = true
+			return errors.New("broker unavailable")
+		}
+
+		published <- string(msg.Data())
+
+		return nil
+	})
+
+	pod := g.Connect()
+
+	// failed messages are re-sent to the pod after it next handles a message successfully
+	for _, data := range []string{"first", "second", "third"} {
+		pod.Send(NewMsg(MsgTypeDefault, []byte(data)))
+		time.Sleep(time.Millisecond * 50)
+	}
+
+	received := map[string]int{}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case data := <-published:
+			received[data]++
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for messages to be published, got %v", received)
+		}
+	}
+
+	if received["first"] != 1 {
+		t.Errorf("expected the failed message to be published on retry, got %v", received)
+	}
+}
@@ -8,12 +8,16 @@ import (
 
 type connectionHandler struct {
 	UUID      string
+	Endpoint  string // the endpoint dialled for outgoing connections, empty for incoming connections
 	Conn      Connection
 	Pod       *Pod
 	Signaler  *withdraw.Signaler
 	ErrChan   chan error
 	BelongsTo string
+	Identity  string
 	Interests []string
+	Features  []string
+	ACL       *ACL
 	Log       *vlog.Logger
 }
 
@@ -28,7 +32,7 @@ func (c *connectionHandler) Start() {
 
 		if err := c.Conn.SendWithdraw(&Withdraw{}); err != nil {
 			c.Log.Error(errors.Wrapf(err, "[grav] failed to SendWithdraw to connection %s", c.UUID))
-			c.ErrChan <- err
+			c.fail(err)
 		}
 
 		c.Signaler.Done()
@@ -40,7 +44,7 @@ func (c *connectionHandler) Start() {
 			if err != nil {
 				if !(c.Signaler.SelfWithdrawn() || c.Signaler.PeerWithdrawn()) {
 					c.Log.Error(errors.Wrapf(err, "[grav] failed to ReadMsg from connection %s", c.UUID))
-					c.ErrChan <- err
+					c.fail(err)
 				} else {
 					c.Log.Debug("[grav] failed to ReadMsg from withdrawn connection, ignoring:", err.Error())
 				}
@@ -58,6 +62,12 @@ func (c *connectionHandler) Start() {
 
 			c.Log.Debug("received message", msg.UUID())
 
+			if !c.ACL.allowPublish(c, msg.Type()) {
+				// logged at debug level since a peer can cause this for every message; ACL.Stats counts denied messages
+				c.Log.Debug("[grav] connection", c.UUID, "is not allowed to publish message type", msg.Type(), "discarding")
+				continue
+			}
+
 			c.Pod.Send(msg)
 		}
 	}()
@@ -69,13 +79,22 @@ func (c *connectionHandler) Send(msg Message) error {
 	}
 
 	if err := c.Conn.SendMsg(msg); err != nil {
-		c.ErrChan <- err
+		c.fail(err)
 		return errors.Wrap(err, "failed to SendMsg")
 	}
 
 	return nil
 }
 
+// fail reports an error to the hub, which closes and removes the connection. ErrChan is buffered and only the first
+// error is kept, so that neither the handler's goroutines nor senders block on a connection that is being removed.
+func (c *connectionHandler) fail(err error) {
+	select {
+	case c.ErrChan <- err:
+	default:
+	}
+}
+
 // Close stops outgoing messages and closes the underlying connection
 func (c *connectionHandler) Close() error {
 	if err := c.Conn.Close(); err != nil {
@@ -0,0 +1,73 @@
+package grav
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrDeliveryTimeout is passed to a DeliveryFunc when no pod handled the message before the timeout
+var ErrDeliveryTimeout = errors.New("message was not handled before timeout")
+
+// DeliveryFunc is called with the outcome of delivering a message to the Grav instance's pods
+type DeliveryFunc func(error)
+
+// deliveryTracker reports the outcome of the first pod to handle a message
+type deliveryTracker struct {
+	deliveryFunc DeliveryFunc
+	timer        *time.Timer
+	once         sync.Once
+}
+
+// trackedMessage is implemented by messages that can report the outcome of their delivery
+type trackedMessage interface {
+	tracker() *deliveryTracker
+	setTracker(*deliveryTracker)
+}
+
+// TrackDelivery calls deliveryFunc once the first pod to handle the message has done so, with nil if its onFunc succeeded or
+// the error it returned. If no pod handles the message before the timeout, deliveryFunc is called with ErrDeliveryTimeout.
+// Bridge transports use it to acknowledge messages to their broker only once they have been handled, allowing failed
+// messages to be redelivered. Pods created by the hub for the mesh and bridge topics do not count as handling a message.
+// It must be called before the message is sent. Messages that can't be tracked (those not created by Grav) are reported as handled immediately.
+func TrackDelivery(msg Message, timeout time.Duration, deliveryFunc DeliveryFunc) {
+	tm, ok := msg.(trackedMessage)
+	if !ok {
+		deliveryFunc(nil)
+		return
+	}
+
+	d := &deliveryTracker{
+		deliveryFunc: deliveryFunc,
+		once:         sync.Once{},
+	}
+
+	d.timer = time.AfterFunc(timeout, func() {
+		d.report(ErrDeliveryTimeout)
+	})
+
+	tm.setTracker(d)
+}
+
+// done reports the outcome of a pod handling the message
+func (d *deliveryTracker) done(err error) {
+	d.timer.Stop()
+	d.report(err)
+}
+
+// report calls the deliveryFunc, if the outcome has not already been reported
+func (d *deliveryTracker) report(err error) {
+	d.once.Do(func() {
+		d.deliveryFunc(err)
+	})
+}
+
+// msgDelivered reports the outcome of a pod handling a message to its tracker, if it has one
+func msgDelivered(msg Message, err error) {
+	tm, ok := msg.(trackedMessage)
+	if !ok || tm.tracker() == nil {
+		return
+	}
+
+	tm.tracker().done(err)
+}
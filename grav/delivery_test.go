@@ -0,0 +1,43 @@
+package grav
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTrackDelivery(t *testing.T) {
+	g := New()
+
+	errBad := errors.New("bad message")
+
+	g.Connect().OnType(msgTypeBad, func(msg Message) error {
+		return errBad
+	})
+
+	g.Connect().OnType(MsgTypeDefault, func(msg Message) error {
+		return nil
+	})
+
+	sender := g.Connect()
+
+	for msgType, want := range map[string]error{MsgTypeDefault: nil, msgTypeBad: errBad, "unhandled": ErrDeliveryTimeout} {
+		outcome := make(chan error, 2)
+
+		msg := NewMsg(msgType, []byte("hello"))
+		TrackDelivery(msg, time.Millisecond*200, func(err error) {
+			outcome <- err
+		})
+
+		sender.Send(msg)
+
+		select {
+		case err := <-outcome:
+			if err != want {
+				t.Errorf("expected %v for %s, got %v", want, msgType, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for outcome of %s", msgType)
+		}
+	}
+}
@@ -5,6 +5,27 @@ import "github.com/suborbital/vektor/vlog"
 // DiscoveryFunc is a function that allows a plugin to report a newly discovered node
 type DiscoveryFunc func(endpoint string, uuid string)
 
+// LostFunc is a function that allows a plugin to report that a node has disappeared.
+// Either the endpoint or the UUID may be empty if the plugin does not know it.
+type LostFunc func(endpoint string, uuid string)
+
+// PeerFunc is a function that allows a plugin to report a newly discovered node along with the metadata it advertised
+type PeerFunc func(peer PeerInfo)
+
+// PeerInfo is a node found by discovery, and the metadata it advertised. Fields other than Endpoint may be
+// left empty by plugins that do not know them, and empty fields never cause a peer to be skipped.
+type PeerInfo struct {
+	Endpoint  string
+	UUID      string
+	BelongsTo string
+	Interests []string
+	Version   int
+	Labels    map[string]string
+}
+
+// DiscoveryFilterFunc returns false for discovered peers that should not be connected to
+type DiscoveryFilterFunc func(peer PeerInfo) bool
+
 // Discovery represents a discovery plugin
 type Discovery interface {
 	// Start is called to start the Discovery plugin
@@ -12,6 +33,21 @@ type Discovery interface {
 	Stop() error
 }
 
+// LossDiscovery is an optional interface for discovery plugins that can detect when a node disappears.
+// UseLostFunc is called before Start, and the hub closes the connection to each node that is reported lost.
+type LossDiscovery interface {
+	Discovery
+	UseLostFunc(LostFunc)
+}
+
+// MetadataDiscovery is an optional interface for discovery plugins that can report the metadata advertised by peers.
+// UsePeerFunc is called before Start, and the plugin should report peers to the PeerFunc rather than the DiscoveryFunc,
+// allowing the hub to skip peers that are incompatible or filtered out before connecting to them.
+type MetadataDiscovery interface {
+	Discovery
+	UsePeerFunc(PeerFunc)
+}
+
 // DiscoveryOpts is a set of options for transports
 type DiscoveryOpts struct {
 	NodeUUID      string
@@ -19,4 +55,14 @@ type DiscoveryOpts struct {
 	TransportURI  string
 	Logger        *vlog.Logger
 	Custom        interface{}
+
+	// Connect creates a pod on the bus, for plugins that exchange messages with their peers over the mesh.
+	// The pod receives messages with types beginning with MsgTypeInternalPrefix, which application pods do not.
+	Connect func() *Pod
+
+	// BelongsTo, Interests, Version and Labels are the metadata for plugins to advertise to peers
+	BelongsTo string
+	Interests []string
+	Version   int
+	Labels    map[string]string
 }
@@ -0,0 +1,39 @@
+package grav
+
+import "testing"
+
+func TestSkipPeer(t *testing.T) {
+	h := &hub{
+		belongsTo: "group",
+		discoveryFilter: func(peer PeerInfo) bool {
+			return peer.Labels["role"] != "edge"
+		},
+	}
+
+	cases := []struct {
+		name string
+		peer PeerInfo
+		skip bool
+	}{
+		{"no metadata", PeerInfo{Endpoint: "a"}, false},
+		{"same group", PeerInfo{Endpoint: "a", BelongsTo: "group", Version: ProtocolVersion}, false},
+		{"any group", PeerInfo{Endpoint: "a", BelongsTo: "*"}, true},
+		{"other group", PeerInfo{Endpoint: "a", BelongsTo: "other"}, true},
+		{"newer version", PeerInfo{Endpoint: "a", Version: ProtocolVersion + 1}, true},
+		{"filtered", PeerInfo{Endpoint: "a", Labels: map[string]string{"role": "edge"}}, true},
+		{"not filtered", PeerInfo{Endpoint: "a", Labels: map[string]string{"role": "worker"}}, false},
+	}
+
+	for _, c := range cases {
+		if skip, _ := h.skipPeer(c.peer); skip != c.skip {
+			t.Errorf("%s: expected skip %t, got %t", c.name, c.skip, skip)
+		}
+	}
+
+	// a node that belongs to '*' can connect to any group
+	h.belongsTo = "*"
+
+	if skip, _ := h.skipPeer(PeerInfo{Endpoint: "a", BelongsTo: "other"}); skip {
+		t.Error("expected node belonging to * not to skip other groups")
+	}
+}
@@ -9,8 +9,10 @@ import (
 
 // ErrTransportNotConfigured represent package-level vars
 var (
-	ErrTransportNotConfigured = errors.New("transport plugin not configured")
-	ErrTunnelNotEstablished   = errors.New("tunnel cannot be established")
+	ErrTransportNotConfigured  = errors.New("transport plugin not configured")
+	ErrTunnelNotEstablished    = errors.New("tunnel cannot be established")
+	ErrMappingNotSupported     = errors.New("bridge transport does not support topic mappings")
+	ErrBridgeTopicNotConnected = errors.New("bridge topic is not connected")
 )
 
 // Grav represents a Grav message bus instance
@@ -25,10 +27,13 @@ type Grav struct {
 
 // New creates a new Grav with the provided options
 func New(opts ...OptionsModifier) *Grav {
-	nodeUUID := uuid.New().String()
-
 	options := newOptionsWithModifiers(opts...)
 
+	nodeUUID := options.NodeUUID
+	if nodeUUID == "" {
+		nodeUUID = uuid.New().String()
+	}
+
 	g := &Grav{
 		NodeUUID:  nodeUUID,
 		BelongsTo: options.BelongsTo,
@@ -38,7 +43,7 @@ func New(opts ...OptionsModifier) *Grav {
 	}
 
 	// the hub handles coordinating the transport and discovery plugins
-	g.hub = initHub(nodeUUID, options, g.Connect)
+	g.hub = initHub(nodeUUID, options, g.connectWithOpts)
 
 	return g
 }
@@ -58,14 +63,34 @@ func (g *Grav) ConnectWithReplay() *Pod {
 	return g.connectWithOpts(opts)
 }
 
-// ConnectEndpoint uses the configured transport to connect the bus to an external endpoint
+// ConnectEndpoint uses the configured transport to connect the bus to an external endpoint.
+// It blocks until the handshake has completed, and returns an error such as ErrBelongsToMismatch,
+// ErrNodeUUIDMismatch, ErrProtocolVersionMismatch or ErrAuthFailed if the connection could not be established.
 func (g *Grav) ConnectEndpoint(endpoint string) error {
 	return g.hub.connectEndpoint(endpoint, "")
 }
 
 // ConnectBridgeTopic connects the Grav instance to a particular topic on the connected bridge
 func (g *Grav) ConnectBridgeTopic(topic string) error {
-	return g.hub.connectBridgeTopic(topic)
+	return g.hub.connectBridgeTopic(topic, nil)
+}
+
+// ConnectBridgeTopicWithMapping connects the Grav instance to a particular topic on the connected bridge, using the mapping to
+// choose which message types are published to the topic and what type is given to raw data received from it.
+// ErrMappingNotSupported is returned if the bridge transport does not implement MappingBridgeTransport.
+func (g *Grav) ConnectBridgeTopicWithMapping(topic string, mapping TopicMapping) error {
+	return g.hub.connectBridgeTopic(topic, &mapping)
+}
+
+// DisconnectBridgeTopic closes the connection to a topic on the connected bridge, stopping messages from being exchanged with it
+func (g *Grav) DisconnectBridgeTopic(topic string) error {
+	return g.hub.disconnectBridgeTopic(topic)
+}
+
+// BridgeTopicState returns the state of the connection to a topic on the connected bridge. Connections that fail are
+// reconnected automatically, and BridgeStateDisconnected is returned for topics that are not connected.
+func (g *Grav) BridgeTopicState(topic string) BridgeState {
+	return g.hub.bridgeTopicState(topic)
 }
 
 // Tunnel sends a message to a specific connection that has advertised it has the required capability.
@@ -81,7 +106,7 @@ func (g *Grav) Withdraw() error {
 	return g.hub.withdraw()
 }
 
-// Stop stops Grav's meshing entirely, causing all connections to peers to close.
+// Stop stops Grav's meshing entirely, causing all connections to peers and bridge topics to close and the transports to stop.
 // It is reccomended to call `Withdraw` first to give peers notice and stop recieving messages
 func (g *Grav) Stop() error {
 	return g.hub.stop()
@@ -0,0 +1,80 @@
+package grav
+
+import "github.com/pkg/errors"
+
+// ProtocolVersion is the version of the mesh wire protocol spoken by this node.
+// It is sent with every handshake and ack so that peers can detect incompatible wire changes.
+const ProtocolVersion = 1
+
+// MinProtocolVersion is the oldest protocol version this node will accept from a peer.
+// Peers that predate versioning do not send a version at all and are treated as version 0.
+const MinProtocolVersion = 0
+
+// MaxProtocolVersion is the newest protocol version this node will accept from a peer. Newer versions carry wire
+// changes this node does not understand, so it is raised along with ProtocolVersion.
+const MaxProtocolVersion = ProtocolVersion
+
+// FeatureCompression and others are optional features that are negotiated during the handshake
+// and are only enabled on a connection when both peers support them
+const (
+	FeatureCompression = "compression"
+)
+
+// FeatureTransport is an optional interface for mesh transports that support optional features
+type FeatureTransport interface {
+	// Features returns the optional features that the transport can enable on its connections
+	Features() []string
+}
+
+// FeatureConnection is an optional interface for connections that can enable negotiated features
+type FeatureConnection interface {
+	// EnableFeatures is called after a successful handshake with the features supported by both peers
+	EnableFeatures(features []string)
+}
+
+// handshakeErrors are the errors that can be carried as the Reason of a rejected handshake ack
+var handshakeErrors = []error{
+	ErrBelongsToMismatch,
+	ErrNodeUUIDMismatch,
+	ErrProtocolVersionMismatch,
+	ErrAuthFailed,
+	ErrPeerIdentityMismatch,
+	ErrConnectedToSelf,
+}
+
+// errFromReason converts the Reason of a rejected handshake ack into a typed error
+func errFromReason(reason string) error {
+	if reason == "" {
+		return ErrHandshakeRejected
+	}
+
+	for _, err := range handshakeErrors {
+		if err.Error() == reason {
+			return err
+		}
+	}
+
+	return errors.Wrap(ErrHandshakeRejected, reason)
+}
+
+// versionCompatible returns true if a peer speaking the given protocol version can be connected to
+func versionCompatible(version int) bool {
+	return version >= MinProtocolVersion && version <= MaxProtocolVersion
+}
+
+// negotiateFeatures returns the features that are present in both the local and remote lists
+func negotiateFeatures(local, remote []string) []string {
+	remoteSet := map[string]bool{}
+	for _, f := range remote {
+		remoteSet[f] = true
+	}
+
+	features := []string{}
+	for _, f := range local {
+		if remoteSet[f] {
+			features = append(features, f)
+		}
+	}
+
+	return features
+}
@@ -0,0 +1,81 @@
+package grav
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/suborbital/vektor/vlog"
+)
+
+func TestNegotiateFeatures(t *testing.T) {
+	local := []string{FeatureCompression, "codec.msgpack", "acks"}
+	remote := []string{"acks", FeatureCompression}
+
+	features := negotiateFeatures(local, remote)
+
+	if !reflect.DeepEqual(features, []string{FeatureCompression, "acks"}) {
+		t.Errorf("expected [compression acks], got %v", features)
+	}
+
+	if features := negotiateFeatures(local, nil); len(features) != 0 {
+		t.Errorf("expected no features, got %v", features)
+	}
+}
+
+func TestVersionCompatible(t *testing.T) {
+	if !versionCompatible(ProtocolVersion) {
+		t.Error("expected current protocol version to be compatible")
+	}
+
+	if !versionCompatible(MinProtocolVersion) {
+		t.Error("expected minimum protocol version to be compatible")
+	}
+
+	if versionCompatible(MinProtocolVersion - 1) {
+		t.Error("expected protocol version below minimum to be incompatible")
+	}
+
+	if versionCompatible(MaxProtocolVersion + 1) {
+		t.Error("expected protocol version above maximum to be incompatible")
+	}
+}
+
+func TestHandshakeVersion(t *testing.T) {
+	g := New(UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))))
+
+	cases := []struct {
+		name    string
+		version int
+		accept  bool
+	}{
+		{"current version", ProtocolVersion, true},
+		{"before versioning", 0, true},
+		{"newer version", ProtocolVersion + 1, false},
+	}
+
+	for _, c := range cases {
+		conn := &handshakeConn{handshake: &TransportHandshake{UUID: "peer", BelongsTo: g.BelongsTo, Version: c.version}}
+		g.hub.handleIncomingConnection(conn)
+
+		if conn.ack == nil || conn.ack.Accept != c.accept {
+			t.Errorf("%s: expected accept %t, got %+v", c.name, c.accept, conn.ack)
+		} else if !c.accept && errFromReason(conn.ack.Reason) != ErrProtocolVersionMismatch {
+			t.Errorf("%s: expected ErrProtocolVersionMismatch, got %s", c.name, conn.ack.Reason)
+		}
+	}
+}
+
+func TestErrFromReason(t *testing.T) {
+	if err := errFromReason(ErrBelongsToMismatch.Error()); err != ErrBelongsToMismatch {
+		t.Errorf("expected ErrBelongsToMismatch, got %v", err)
+	}
+
+	if err := errFromReason(""); err != ErrHandshakeRejected {
+		t.Errorf("expected ErrHandshakeRejected, got %v", err)
+	}
+
+	if err := errFromReason("something else"); !errors.Is(err, ErrHandshakeRejected) {
+		t.Errorf("expected wrapped ErrHandshakeRejected, got %v", err)
+	}
+}
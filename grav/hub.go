@@ -1,7 +1,6 @@
 package grav
 
 import (
-	"fmt"
 	"sync"
 	"time"
 
@@ -18,22 +17,35 @@ type hub struct {
 	nodeUUID    string
 	belongsTo   string
 	interests   []string
+	features    []string
 	mesh        MeshTransport
 	bridge      BridgeTransport
 	discovery   Discovery
+	auth        Authenticator
+	acl         *ACL
 	log         *vlog.Logger
 	pod         *Pod
-	connectFunc func() *Pod
+	connectFunc func(opts *podOpts) *Pod
+	meshReady   chan struct{}
+	bridgeReady chan struct{}
 
-	meshConnections   map[string]*connectionHandler
-	bridgeConnections map[string]BridgeConnection
+	meshConnections map[string]*connectionHandler
+	bridgeTopics    map[string]*bridgeTopic
+
+	// endpointUUIDs are the UUIDs learned for discovered endpoints, so that endpoints which discovery reports
+	// again without a UUID are not connected to again while connected
+	endpointUUIDs map[string]string
+
+	bridgeErrorHandler BridgeErrorFunc
+	bridgeRelay        BridgeRelay
+	discoveryFilter    DiscoveryFilterFunc
 
 	capabilityBalancers map[string]*tunnel.Balancer
 
 	lock sync.RWMutex
 }
 
-func initHub(nodeUUID string, options *Options, connectFunc func() *Pod) *hub {
+func initHub(nodeUUID string, options *Options, connectFunc func(opts *podOpts) *Pod) *hub {
 	h := &hub{
 		nodeUUID:            nodeUUID,
 		belongsTo:           options.BelongsTo,
@@ -41,21 +53,37 @@ func initHub(nodeUUID string, options *Options, connectFunc func() *Pod) *hub {
 		mesh:                options.MeshTransport,
 		bridge:              options.BridgeTransport,
 		discovery:           options.Discovery,
+		discoveryFilter:     options.DiscoveryFilter,
+		auth:                options.Authenticator,
+		acl:                 options.ACL,
 		log:                 options.Logger,
-		pod:                 connectFunc(),
 		connectFunc:         connectFunc,
+		meshReady:           make(chan struct{}),
+		bridgeReady:         make(chan struct{}),
 		meshConnections:     map[string]*connectionHandler{},
-		bridgeConnections:   map[string]BridgeConnection{},
+		bridgeTopics:        map[string]*bridgeTopic{},
+		endpointUUIDs:       map[string]string{},
+		bridgeErrorHandler:  options.BridgeErrorHandler,
+		bridgeRelay:         options.BridgeRelay,
 		capabilityBalancers: map[string]*tunnel.Balancer{},
 		lock:                sync.RWMutex{},
 	}
 
+	// the hub's pod sends messages received from mesh peers and relays messages to them
+	h.pod = connectFunc(&podOpts{relay: h.meshRelay()})
+
+	// optional features are only advertised if the mesh transport is able to enable them
+	if featureMesh, ok := h.mesh.(FeatureTransport); ok {
+		h.features = featureMesh.Features()
+	}
+
 	// start mesh transport, then discovery if each have been configured (can have transport but no discovery)
 	if h.mesh != nil {
 		transportOpts := &MeshOptions{
 			NodeUUID: nodeUUID,
 			Port:     options.Port,
 			URI:      options.URI,
+			TLS:      options.TLS,
 			Logger:   options.Logger,
 		}
 
@@ -67,6 +95,9 @@ func initHub(nodeUUID string, options *Options, connectFunc func() *Pod) *hub {
 			// send all messages to all mesh connections
 			h.pod.On(h.messageHandler)
 
+			// outgoing connections can be made once the transport is ready
+			close(h.meshReady)
+
 			// scan forever to remove failed connections
 			h.scanFailedMeshConnections()
 		}()
@@ -77,6 +108,19 @@ func initHub(nodeUUID string, options *Options, connectFunc func() *Pod) *hub {
 				TransportPort: transportOpts.Port,
 				TransportURI:  transportOpts.URI,
 				Logger:        options.Logger,
+				Connect:       func() *Pod { return connectFunc(&podOpts{internal: true}) },
+				BelongsTo:     options.BelongsTo,
+				Interests:     options.Interests,
+				Version:       ProtocolVersion,
+				Labels:        options.DiscoveryLabels,
+			}
+
+			if metadataDiscovery, ok := h.discovery.(MetadataDiscovery); ok {
+				metadataDiscovery.UsePeerFunc(h.peerHandler())
+			}
+
+			if lossDiscovery, ok := h.discovery.(LossDiscovery); ok {
+				lossDiscovery.UseLostFunc(h.lostHandler())
 			}
 
 			go func() {
@@ -89,14 +133,19 @@ func initHub(nodeUUID string, options *Options, connectFunc func() *Pod) *hub {
 
 	if h.bridge != nil {
 		transportOpts := &BridgeOptions{
-			NodeUUID: nodeUUID,
-			Logger:   options.Logger,
+			NodeUUID:  nodeUUID,
+			BelongsTo: options.BelongsTo,
+			Sealer:    options.Sealer,
+			Logger:    options.Logger,
+			failFunc:  h.handleBridgeFailure,
 		}
 
 		go func() {
 			if err := h.bridge.Setup(transportOpts); err != nil {
 				h.log.Error(errors.Wrap(err, "[grav] failed to Setup bridge transport"))
 			}
+
+			close(h.bridgeReady)
 		}()
 	}
 
@@ -108,9 +157,17 @@ func (h *hub) messageHandler(msg Message) error {
 	h.lock.RLock()
 	defer h.lock.RUnlock()
 
+	msg = h.meshMsgLocked(msg)
+
 	// send the message to each. withdrawn connections will result in a no-op
 	for uuid := range h.meshConnections {
 		handler := h.meshConnections[uuid]
+
+		if !h.acl.allowReceive(handler, msg.Type()) {
+			h.log.Debug("[grav] connection", uuid, "is not allowed to receive message type", msg.Type(), "skipping")
+			continue
+		}
+
 		handler.Send(msg)
 	}
 
@@ -124,102 +181,298 @@ func (h *hub) discoveryHandler() func(endpoint string, uuid string) {
 			return
 		}
 
+		// discovery plugins report endpoints again periodically so that lost connections are re-established,
+		// so the UUID learned from an earlier handshake is used to avoid connecting to the same peer again
+		known := uuid
+		if known == "" {
+			known = h.endpointUUID(endpoint)
+		}
+
+		if known == h.nodeUUID {
+			h.log.Debug("[grav] discovered endpoint", endpoint, "belongs to self, discarding")
+			return
+		}
+
 		// this reduces the number of extraneous outgoing handshakes that get attempted.
-		if _, exists := h.findConnection(uuid); exists {
+		if _, exists := h.findConnection(known); exists {
 			h.log.Debug("[grav] encountered duplicate connection, discarding")
 			return
 		}
 
-		if err := h.connectEndpoint(endpoint, uuid); err != nil {
+		if err := h.connectEndpoint(endpoint, uuid); errors.Is(err, ErrConnectedToSelf) {
+			h.log.Debug("[grav] discovered endpoint", endpoint, "belongs to self, discarding")
+			h.setEndpointUUID(endpoint, h.nodeUUID)
+		} else if err != nil {
 			h.log.Error(errors.Wrap(err, "[grav] failed to connectEndpoint for discovered peer"))
 		}
 	}
 }
 
-// connectEndpoint creates a new outgoing connection
+// peerHandler connects to peers reported with metadata, skipping those that would reject the handshake or are filtered out
+func (h *hub) peerHandler() func(peer PeerInfo) {
+	discoveryHandler := h.discoveryHandler()
+
+	return func(peer PeerInfo) {
+		if skip, reason := h.skipPeer(peer); skip {
+			h.log.Debug("[grav] skipping discovered peer", peer.Endpoint, peer.UUID, reason)
+			return
+		}
+
+		discoveryHandler(peer.Endpoint, peer.UUID)
+	}
+}
+
+// skipPeer returns true and the reason if a discovered peer should not be connected to
+func (h *hub) skipPeer(peer PeerInfo) (bool, string) {
+	if peer.Version != 0 && !versionCompatible(peer.Version) {
+		return true, "protocol version is not supported"
+	}
+
+	// peers only accept handshakes from the same group unless the handshake belongs to '*'
+	if peer.BelongsTo != "" && h.belongsTo != "*" && peer.BelongsTo != h.belongsTo {
+		return true, "belongs to a different group"
+	}
+
+	if h.discoveryFilter != nil && !h.discoveryFilter(peer) {
+		return true, "filtered out"
+	}
+
+	return false, ""
+}
+
+// lostHandler closes the connection to a node reported lost by discovery, found by its UUID or otherwise the endpoint it was connected to
+func (h *hub) lostHandler() func(endpoint string, uuid string) {
+	return func(endpoint string, uuid string) {
+		h.lock.Lock()
+
+		var lost *connectionHandler
+		for _, handler := range h.meshConnections {
+			if (uuid != "" && handler.UUID == uuid) || (uuid == "" && endpoint != "" && handler.Endpoint == endpoint) {
+				lost = handler
+				break
+			}
+		}
+
+		// the connection is taken out of circulation before it is closed, so nothing sends to it while it closes
+		if lost != nil {
+			h.removeMeshConnectionLocked(lost.UUID)
+		}
+
+		h.lock.Unlock()
+
+		if lost == nil {
+			h.log.Debug("[grav] lost peer", endpoint, uuid, "is not connected, discarding")
+			return
+		}
+
+		h.log.Info("[grav] discovery reported peer", lost.UUID, "lost, closing connection")
+
+		if err := lost.Close(); err != nil {
+			h.log.Error(errors.Wrapf(err, "[grav] failed to Close %s", lost.UUID))
+		}
+	}
+}
+
+// connectEndpoint creates a new outgoing connection and returns once its handshake has completed
 func (h *hub) connectEndpoint(endpoint, uuid string) error {
 	if h.mesh == nil {
 		return ErrTransportNotConfigured
 	}
 
+	<-h.meshReady
+
 	h.log.Debug("[grav] connecting to endpoint", endpoint)
 
+	if h.auth != nil && uuid == "" {
+		// credentials are bound to the UUID of the node receiving them, so it must be learned first
+		peerUUID, err := h.identifyEndpoint(endpoint)
+		if err != nil {
+			return errors.Wrap(err, "[grav] failed to identifyEndpoint")
+		}
+
+		uuid = peerUUID
+	}
+
 	conn, err := h.mesh.Connect(endpoint)
 	if err != nil {
 		return errors.Wrap(err, "[grav] failed to transport.CreateConnection")
 	}
 
-	h.setupOutgoingConnection(conn, uuid)
+	if err := h.setupOutgoingConnection(conn, endpoint, uuid); err != nil {
+		return err
+	}
 
 	return nil
 }
 
-// connectBridgeTopic creates a new outgoing connection
-func (h *hub) connectBridgeTopic(topic string) error {
+// identifyEndpoint learns the UUID of the node at an endpoint from the ack to an identify handshake, which the node
+// answers without treating it as a failed attempt to authenticate
+func (h *hub) identifyEndpoint(endpoint string) (string, error) {
+	conn, err := h.mesh.Connect(endpoint)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to transport.CreateConnection")
+	}
+
+	defer conn.Close()
+
+	handshake := &TransportHandshake{
+		UUID:      h.nodeUUID,
+		BelongsTo: h.belongsTo,
+		Version:   ProtocolVersion,
+		Identify:  true,
+	}
+
+	ack, err := conn.OutgoingHandshake(handshake)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to connection.DoOutgoingHandshake")
+	}
+
+	if ack.UUID == "" {
+		return "", errors.Wrap(ErrNodeUUIDMismatch, "connection handshake Ack returned empty UUID")
+	} else if ack.UUID == h.nodeUUID {
+		return "", ErrConnectedToSelf
+	}
+
+	return ack.UUID, nil
+}
+
+// connectBridgeTopic creates a new outgoing connection, using the mapping if one is provided
+func (h *hub) connectBridgeTopic(topic string, mapping *TopicMapping) error {
 	if h.bridge == nil {
 		return ErrTransportNotConfigured
 	}
 
+	if mapping != nil {
+		if _, ok := h.bridge.(MappingBridgeTransport); !ok {
+			return ErrMappingNotSupported
+		}
+
+		if len(mapping.Types) == 0 {
+			mapping.Types = []string{topic}
+		}
+	}
+
+	<-h.bridgeReady
+
 	h.log.Debug("[grav] connecting to topic", topic)
 
-	conn, err := h.bridge.ConnectTopic(topic)
+	conn, err := h.connectBridge(topic, mapping)
 	if err != nil {
 		return errors.Wrap(err, "[grav] failed to transport.CreateConnection")
 	}
 
-	h.addTopicConnection(conn, topic)
+	h.addTopicConnection(conn, topic, mapping)
 
 	return nil
 }
 
-func (h *hub) setupOutgoingConnection(connection Connection, uuid string) {
-	handshake := &TransportHandshake{h.nodeUUID, h.belongsTo, h.interests}
+func (h *hub) setupOutgoingConnection(connection Connection, endpoint, uuid string) error {
+	handshake := &TransportHandshake{
+		UUID:      h.nodeUUID,
+		BelongsTo: h.belongsTo,
+		Interests: h.interests,
+		Version:   ProtocolVersion,
+		Features:  h.features,
+	}
+
+	if h.auth != nil {
+		challenge, err := newChallenge()
+		if err != nil {
+			connection.Close()
+			return errors.Wrap(err, "[grav] failed to newChallenge")
+		}
+
+		credentials, err := h.auth.Credentials(h.nodeUUID, handshakeChallenge(challenge, uuid))
+		if err != nil {
+			connection.Close()
+			return errors.Wrap(err, "[grav] failed to auth.Credentials")
+		}
+
+		handshake.Challenge = challenge
+		handshake.Credentials = credentials
+	}
 
 	ack, err := connection.OutgoingHandshake(handshake)
 	if err != nil {
-		h.log.Error(errors.Wrap(err, "[grav] failed to connection.DoOutgoingHandshake"))
 		connection.Close()
-		return
+		return errors.Wrap(err, "[grav] failed to connection.DoOutgoingHandshake")
 	}
 
 	if !ack.Accept {
 		h.log.Debug("[grav] connection handshake was not accepted, terminating connection")
 		connection.Close()
 
-		return
+		return errFromReason(ack.Reason)
+	} else if !versionCompatible(ack.Version) {
+		connection.Close()
+
+		return errors.Wrapf(ErrProtocolVersionMismatch, "connection handshake Ack has protocol version %d", ack.Version)
 	} else if uuid == "" {
 		if ack.UUID == "" {
-			h.log.ErrorString("[grav] connection handshake returned empty UUID, terminating connection")
 			connection.Close()
 
-			return
+			return errors.Wrap(ErrNodeUUIDMismatch, "connection handshake Ack returned empty UUID")
 		}
 
 		uuid = ack.UUID
 	} else if ack.UUID != uuid {
-		h.log.ErrorString(fmt.Sprintf("[grav] connection handshake Ack %s did not match Discovery Ack %s, terminating connection", ack.UUID, uuid))
 		connection.Close()
 
-		return
+		return errors.Wrapf(ErrNodeUUIDMismatch, "connection handshake Ack %s did not match Discovery Ack %s", ack.UUID, uuid)
+	}
+
+	identity := ""
+
+	if h.auth != nil {
+		// the peer must prove its identity by answering the challenge that was sent with the handshake
+		identity, err = h.auth.Verify(uuid, ackChallenge(handshake.Challenge), ack.Credentials)
+		if err != nil {
+			connection.Close()
+
+			return errors.Wrapf(ErrAuthFailed, "failed to Verify handshake Ack credentials: %s", err.Error())
+		}
 	}
 
-	h.setupNewConnection(connection, uuid, ack.BelongsTo, ack.Interests)
+	h.setEndpointUUID(endpoint, uuid)
+
+	h.setupNewConnection(connection, endpoint, uuid, ack.BelongsTo, identity, ack.Interests, ack.Features)
+
+	return nil
 }
 
 func (h *hub) handleIncomingConnection(connection Connection) {
 	var handshake *TransportHandshake
 	var ack *TransportHandshakeAck
+	var identity string
+	var rejectErr error
 
 	callback := func(incomingHandshake *TransportHandshake) *TransportHandshakeAck {
 		handshake = incomingHandshake
 
 		ack = &TransportHandshakeAck{
-			Accept: true,
-			UUID:   h.nodeUUID,
+			Accept:   true,
+			UUID:     h.nodeUUID,
+			Version:  ProtocolVersion,
+			Features: h.features,
+		}
+
+		if incomingHandshake.UUID == h.nodeUUID {
+			// discovery plugins that don't know peer UUIDs can lead a node to connect to its own endpoint
+			rejectErr = ErrConnectedToSelf
+		} else if incomingHandshake.Identify {
+			// the peer only needs this node's UUID (included in every ack) to authenticate a connection of its own
+			rejectErr = errIdentifyHandshake
+		} else if !versionCompatible(incomingHandshake.Version) {
+			rejectErr = ErrProtocolVersionMismatch
+		} else if incomingHandshake.BelongsTo != h.belongsTo && incomingHandshake.BelongsTo != "*" {
+			rejectErr = ErrBelongsToMismatch
+		} else if h.auth != nil {
+			identity, rejectErr = h.authenticateHandshake(incomingHandshake, ack)
 		}
 
-		if incomingHandshake.BelongsTo != h.belongsTo && incomingHandshake.BelongsTo != "*" {
+		if rejectErr != nil {
 			ack.Accept = false
+			ack.Reason = rejectErr.Error()
 		} else {
 			ack.BelongsTo = h.belongsTo
 			ack.Interests = h.interests
@@ -242,23 +495,61 @@ func (h *hub) handleIncomingConnection(connection Connection) {
 		return
 	}
 
-	if !ack.Accept {
-		h.log.Debug("[grav] rejecting connection with incompatible BelongsTo", handshake.BelongsTo)
+	if rejectErr == errIdentifyHandshake {
+		h.log.Debug("[grav] answered identify handshake from", handshake.UUID)
+		connection.Close()
+
+		return
+	} else if !ack.Accept {
+		h.log.Debug("[grav] rejecting connection from", handshake.UUID, "reason:", rejectErr.Error())
 		connection.Close()
 
 		return
 	}
 
-	h.setupNewConnection(connection, handshake.UUID, handshake.BelongsTo, handshake.Interests)
+	h.setupNewConnection(connection, "", handshake.UUID, handshake.BelongsTo, identity, handshake.Interests, handshake.Features)
 }
 
-func (h *hub) setupNewConnection(connection Connection, uuid, belongsTo string, interests []string) {
+// authenticateHandshake verifies the credentials of an incoming handshake and answers its challenge in the ack
+func (h *hub) authenticateHandshake(handshake *TransportHandshake, ack *TransportHandshakeAck) (string, error) {
+	if handshake.Challenge == "" {
+		h.log.Debug("[grav] handshake from", handshake.UUID, "has no challenge")
+		return "", ErrAuthFailed
+	}
+
+	identity, err := h.auth.Verify(handshake.UUID, handshakeChallenge(handshake.Challenge, h.nodeUUID), handshake.Credentials)
+	if err != nil {
+		h.log.Debug("[grav] failed to Verify handshake credentials from", handshake.UUID, err.Error())
+		return "", ErrAuthFailed
+	}
+
+	credentials, err := h.auth.Credentials(h.nodeUUID, ackChallenge(handshake.Challenge))
+	if err != nil {
+		h.log.Error(errors.Wrap(err, "[grav] failed to auth.Credentials for handshake ack"))
+		return "", ErrAuthFailed
+	}
+
+	ack.Credentials = credentials
+
+	return identity, nil
+}
+
+func (h *hub) setupNewConnection(connection Connection, endpoint, uuid, belongsTo, identity string, interests, peerFeatures []string) {
 	if _, exists := h.findConnection(uuid); exists {
 		connection.Close()
 		h.log.Debug("[grav] encountered duplicate connection, discarding")
-	} else {
-		h.addConnection(connection, uuid, belongsTo, interests)
+		return
+	}
+
+	// only features supported by both sides are enabled on the connection
+	features := negotiateFeatures(h.features, peerFeatures)
+
+	if featureConn, ok := connection.(FeatureConnection); ok && len(features) > 0 {
+		h.log.Debug("[grav] enabling features", features, "for connection", uuid)
+		featureConn.EnableFeatures(features)
 	}
+
+	h.addConnection(connection, endpoint, uuid, belongsTo, identity, interests, features)
 }
 
 func (h *hub) incomingMessageHandler(uuid string) ReceiveFunc {
@@ -269,7 +560,7 @@ func (h *hub) incomingMessageHandler(uuid string) ReceiveFunc {
 	}
 }
 
-func (h *hub) addConnection(connection Connection, uuid, belongsTo string, interests []string) {
+func (h *hub) addConnection(connection Connection, endpoint, uuid, belongsTo, identity string, interests, features []string) {
 	h.lock.Lock()
 	defer h.lock.Unlock()
 
@@ -279,12 +570,16 @@ func (h *hub) addConnection(connection Connection, uuid, belongsTo string, inter
 
 	handler := &connectionHandler{
 		UUID:      uuid,
+		Endpoint:  endpoint,
 		Conn:      connection,
 		Pod:       h.pod,
 		Signaler:  signaler,
-		ErrChan:   make(chan error),
+		ErrChan:   make(chan error, 1),
 		BelongsTo: belongsTo,
+		Identity:  identity,
 		Interests: interests,
+		Features:  features,
+		ACL:       h.acl,
 		Log:       h.log,
 	}
 
@@ -301,21 +596,41 @@ func (h *hub) addConnection(connection Connection, uuid, belongsTo string, inter
 	}
 }
 
-func (h *hub) addTopicConnection(connection BridgeConnection, topic string) {
-	h.lock.Lock()
-	defer h.lock.Unlock()
-
+func (h *hub) addTopicConnection(connection BridgeConnection, topic string, mapping *TopicMapping) {
 	h.log.Debug("[grav] adding bridge connection for", topic)
 
-	connection.Start(h.connectFunc())
+	bt := &bridgeTopic{
+		topic:     topic,
+		mapping:   mapping,
+		conn:      connection,
+		state:     BridgeStateConnected,
+		published: newUUIDHistory(publishedHistorySize),
+	}
 
-	h.bridgeConnections[topic] = connection
-}
+	bt.pod = h.topicPod(bt)
 
-func (h *hub) removeMeshConnection(uuid string) {
 	h.lock.Lock()
-	defer h.lock.Unlock()
 
+	// connecting to a topic again replaces its existing connection
+	var existingConn BridgeConnection
+	var existingPod *Pod
+
+	if existing, exists := h.bridgeTopics[topic]; exists {
+		existingConn, existingPod = h.closeBridgeTopicLocked(existing)
+	}
+
+	h.bridgeTopics[topic] = bt
+
+	h.lock.Unlock()
+
+	closeBridgeConn(existingConn, existingPod)
+
+	// started once the topic is added, so that the connection's failures are handled
+	connection.Start(bt.pod)
+}
+
+// removeMeshConnectionLocked removes a connection from circulation. The hub's lock must be held.
+func (h *hub) removeMeshConnectionLocked(uuid string) {
 	h.log.Debug("[grav] removing connection for", uuid)
 
 	for _, balancer := range h.capabilityBalancers {
@@ -325,6 +640,21 @@ func (h *hub) removeMeshConnection(uuid string) {
 	delete(h.meshConnections, uuid)
 }
 
+// endpointUUID returns the UUID learned for an endpoint, if any
+func (h *hub) endpointUUID(endpoint string) string {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	return h.endpointUUIDs[endpoint]
+}
+
+func (h *hub) setEndpointUUID(endpoint, uuid string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.endpointUUIDs[endpoint] = uuid
+}
+
 func (h *hub) findConnection(uuid string) (Connection, bool) {
 	h.lock.RLock()
 	defer h.lock.RUnlock()
@@ -342,31 +672,39 @@ func (h *hub) findConnection(uuid string) (Connection, bool) {
 func (h *hub) scanFailedMeshConnections() {
 	for {
 		// we don't want to edit the `meshConnections` map while in the loop, so do it after
-		toRemove := []string{}
+		failed := []*connectionHandler{}
 
 		// for each connection, check if it has errored or if its peer has withdrawn,
-		// and in either case close it and remove it from circulation
+		// and in either case remove it from circulation and close it. connections
+		// can be removed concurrently, such as when discovery reports a peer lost.
+		h.lock.RLock()
+
 		for _, conn := range h.meshConnections {
 			select {
 			case <-conn.ErrChan:
-				if err := conn.Close(); err != nil {
-					h.log.Error(errors.Wrapf(err, "[grav] failed to Close %s", conn.UUID))
-				}
-
-				toRemove = append(toRemove, conn.UUID)
+				failed = append(failed, conn)
 			default:
 				if conn.Signaler.PeerWithdrawn() {
-					if err := conn.Close(); err != nil {
-						h.log.Error(errors.Wrapf(err, "[grav] failed to Close %s", conn.UUID))
-					}
-
-					toRemove = append(toRemove, conn.UUID)
+					failed = append(failed, conn)
 				}
 			}
 		}
 
-		for _, uuid := range toRemove {
-			h.removeMeshConnection(uuid)
+		h.lock.RUnlock()
+
+		for _, conn := range failed {
+			h.lock.Lock()
+
+			// the connection may have been replaced by a new one from the same peer
+			if h.meshConnections[conn.UUID] == conn {
+				h.removeMeshConnectionLocked(conn.UUID)
+			}
+
+			h.lock.Unlock()
+
+			if err := conn.Close(); err != nil {
+				h.log.Error(errors.Wrapf(err, "[grav] failed to Close %s", conn.UUID))
+			}
 		}
 
 		time.Sleep(time.Second)
@@ -387,6 +725,11 @@ func (h *hub) sendTunneledMessage(capability string, msg Message) error {
 		h.lock.RUnlock()
 
 		if exists && handler.Conn != nil {
+			if !h.acl.allowReceive(handler, msg.Type()) {
+				h.log.Debug("[grav] connection", uuid, "is not allowed to receive tunneled message type", msg.Type(), "skipping")
+				continue
+			}
+
 			if err := handler.Send(msg); err != nil {
 				h.log.Error(errors.Wrap(err, "[grav] failed to SendMsg on tunneled connection, will remove"))
 			} else {
@@ -466,5 +809,34 @@ func (h *hub) stop() error {
 		}
 	}
 
+	if stopper, ok := h.mesh.(TransportStopper); ok {
+		if err := stopper.Stop(); err != nil {
+			lastErr = err
+			h.log.Error(errors.Wrap(err, "[grav] failed to Stop mesh transport"))
+		}
+	}
+
+	h.lock.Lock()
+	closing := map[BridgeConnection]*Pod{}
+	for topic, bt := range h.bridgeTopics {
+		if conn, pod := h.closeBridgeTopicLocked(bt); conn != nil {
+			closing[conn] = pod
+		}
+
+		delete(h.bridgeTopics, topic)
+	}
+	h.lock.Unlock()
+
+	for conn, pod := range closing {
+		closeBridgeConn(conn, pod)
+	}
+
+	if stopper, ok := h.bridge.(TransportStopper); ok {
+		if err := stopper.Stop(); err != nil {
+			lastErr = err
+			h.log.Error(errors.Wrap(err, "[grav] failed to Stop bridge transport"))
+		}
+	}
+
 	return lastErr
 }
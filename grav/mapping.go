@@ -0,0 +1,65 @@
+package grav
+
+// TopicMapping controls how messages are mapped between Grav message types and a bridge topic,
+// allowing a single topic to carry many message types, and a message type to be published to many topics.
+type TopicMapping struct {
+	// Types are patterns for the message types published to the topic, where '*' matches any sequence of characters
+	// (see MatchMsgType). Defaults to the topic name, meaning only messages whose type equals the topic are published.
+	Types []string
+	// Type is the message type given to raw data received from the topic, meaning data that is not an encoded Grav message.
+	// Defaults to a type chosen by the transport, usually the topic name.
+	Type string
+	// TypeHeader names a message header that holds the message type, for transports that support headers.
+	// It is set to the type of each published message, and its value is used as the type of raw data received from the topic.
+	TypeHeader string
+}
+
+// DefaultTopicMapping returns the mapping used by ConnectBridgeTopic, which publishes messages
+// whose type equals the topic name and gives raw data received from the topic the transport's default type
+func DefaultTopicMapping(topic string) TopicMapping {
+	m := TopicMapping{
+		Types: []string{topic},
+	}
+
+	return m
+}
+
+// Publishes returns true if messages of the given type should be published to the topic. Internal messages are never published.
+func (t TopicMapping) Publishes(msgType string) bool {
+	if isInternalMsgType(msgType) {
+		return false
+	}
+
+	for _, pattern := range t.Types {
+		if MatchMsgType(pattern, msgType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Filter wraps a bridge connection's onFunc so that it is only called for messages that should be published to the topic
+func (t TopicMapping) Filter(onFunc MsgFunc) MsgFunc {
+	return func(msg Message) error {
+		if !t.Publishes(msg.Type()) {
+			return nil
+		}
+
+		return onFunc(msg)
+	}
+}
+
+// MsgType returns the type for raw data received from the topic: the value of the type header if it was present,
+// the mapping's Type if set, and otherwise the transport's default type
+func (t TopicMapping) MsgType(header, defaultType string) string {
+	if header != "" {
+		return header
+	}
+
+	if t.Type != "" {
+		return t.Type
+	}
+
+	return defaultType
+}
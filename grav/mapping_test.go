@@ -0,0 +1,56 @@
+package grav
+
+import "testing"
+
+func TestTopicMapping(t *testing.T) {
+	mapping := TopicMapping{
+		Types: []string{"user.*", "order.created"},
+		Type:  "event.raw",
+	}
+
+	for msgType, expected := range map[string]bool{
+		"user.login":    true,
+		"order.created": true,
+		"order.shipped": false,
+		"events":        false,
+	} {
+		if publishes := mapping.Publishes(msgType); publishes != expected {
+			t.Errorf("expected Publishes(%s) to be %t", msgType, expected)
+		}
+	}
+
+	if msgType := mapping.MsgType("user.logout", "events"); msgType != "user.logout" {
+		t.Errorf("expected the header to take precedence, got %s", msgType)
+	}
+
+	if msgType := mapping.MsgType("", "events"); msgType != "event.raw" {
+		t.Errorf("expected event.raw, got %s", msgType)
+	}
+
+	if msgType := DefaultTopicMapping("events").MsgType("", "events"); msgType != "events" {
+		t.Errorf("expected the default type, got %s", msgType)
+	}
+
+	if !DefaultTopicMapping("events").Publishes("events") || DefaultTopicMapping("events").Publishes("user.login") {
+		t.Error("expected the default mapping to only publish the topic's type")
+	}
+
+	if (TopicMapping{Types: []string{"*"}}).Publishes(MsgTypeInternalPrefix + "gossip.ping") {
+		t.Error("expected internal messages not to be published")
+	}
+}
+
+func TestMappingNotSupported(t *testing.T) {
+	g := New(UseBridgeTransport(&unmappedBridge{}))
+
+	if err := g.ConnectBridgeTopicWithMapping("events", TopicMapping{}); err != ErrMappingNotSupported {
+		t.Errorf("expected ErrMappingNotSupported, got %v", err)
+	}
+}
+
+// unmappedBridge is a bridge transport that does not implement MappingBridgeTransport
+type unmappedBridge struct{}
+
+func (u *unmappedBridge) Setup(opts *BridgeOptions) error { return nil }
+
+func (u *unmappedBridge) ConnectTopic(topic string) (BridgeConnection, error) { return nil, nil }
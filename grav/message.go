@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,6 +16,10 @@ const (
 	msgTypePodFeedback string = "grav.feedback"
 )
 
+// MsgTypeInternalPrefix begins the types of messages exchanged between Grav instances and their discovery plugins over the mesh.
+// Internal messages are only received by the pods of discovery plugins, and are never published to bridge topics.
+const MsgTypeInternalPrefix = "grav.internal."
+
 // MsgFunc is a callback function that accepts a message and returns an error
 type MsgFunc func(Message) error
 
@@ -74,6 +79,25 @@ func MsgFromBytes(bytes []byte) (Message, error) {
 	return m, nil
 }
 
+// MsgFromParts returns a default _message built from its individual parts, preserving its identity.
+// Transports that encode messages with their own format use it to reconstruct messages they receive.
+func MsgFromParts(uuid, parentID, replyTo, msgType string, timestamp time.Time, data []byte) Message {
+	m := &_message{
+		Meta: _meta{
+			UUID:      uuid,
+			ParentID:  parentID,
+			ReplyTo:   replyTo,
+			MsgType:   msgType,
+			Timestamp: timestamp,
+		},
+		Payload: _payload{
+			Data: data,
+		},
+	}
+
+	return m
+}
+
 // MsgFromRequest extracts an encoded Message from an HTTP request
 func MsgFromRequest(r *http.Request) (Message, error) {
 	defer r.Body.Close()
@@ -110,6 +134,11 @@ func new(msgType, parentID string, data []byte) Message {
 type _message struct {
 	Meta    _meta    `json:"meta"`
 	Payload _payload `json:"payload"`
+
+	// where the message entered this instance, see originMessage
+	from string
+	// reports the outcome of delivering the message, see TrackDelivery
+	delivery *deliveryTracker
 }
 
 type _meta struct {
@@ -118,6 +147,8 @@ type _meta struct {
 	ReplyTo   string    `json:"response_to"`
 	MsgType   string    `json:"msg_type"`
 	Timestamp time.Time `json:"timestamp"`
+	// Bridges are the bridge topics the message was received from or published to before crossing the mesh
+	Bridges []string `json:"bridges,omitempty"`
 }
 
 type _payload struct {
@@ -168,3 +199,39 @@ func (m *_message) Marshal() ([]byte, error) {
 func (m *_message) Unmarshal(bytes []byte) error {
 	return json.Unmarshal(bytes, m)
 }
+
+func (m *_message) origin() string {
+	return m.from
+}
+
+func (m *_message) setOrigin(origin string) {
+	m.from = origin
+}
+
+func (m *_message) bridges() []string {
+	return m.Meta.Bridges
+}
+
+func (m *_message) setBridges(topics []string) {
+	m.Meta.Bridges = topics
+}
+
+func (m *_message) withBridges(topics []string) Message {
+	c := *m
+	c.Meta.Bridges = topics
+
+	return &c
+}
+
+func (m *_message) tracker() *deliveryTracker {
+	return m.delivery
+}
+
+func (m *_message) setTracker(d *deliveryTracker) {
+	m.delivery = d
+}
+
+// isInternalMsgType returns true if messages of the type are internal to Grav
+func isInternalMsgType(msgType string) bool {
+	return strings.HasPrefix(msgType, MsgTypeInternalPrefix)
+}
@@ -6,14 +6,23 @@ import (
 
 // Options represent Grav options
 type Options struct {
-	Logger          *vlog.Logger
-	MeshTransport   MeshTransport
-	BridgeTransport BridgeTransport
-	Discovery       Discovery
-	Port            string
-	URI             string
-	BelongsTo       string
-	Interests       []string
+	NodeUUID           string
+	Logger             *vlog.Logger
+	MeshTransport      MeshTransport
+	BridgeTransport    BridgeTransport
+	BridgeErrorHandler BridgeErrorFunc
+	BridgeRelay        BridgeRelay
+	Discovery          Discovery
+	DiscoveryLabels    map[string]string
+	DiscoveryFilter    DiscoveryFilterFunc
+	Authenticator      Authenticator
+	Sealer             Sealer
+	ACL                *ACL
+	Port               string
+	URI                string
+	TLS                *TLSOptions
+	BelongsTo          string
+	Interests          []string
 }
 
 // OptionsModifier is function that modifies an option
@@ -50,6 +59,21 @@ func UseBridgeTransport(bridge BridgeTransport) OptionsModifier {
 	}
 }
 
+// UseBridgeErrorHandler sets a function to be called when a bridge topic's connection fails or cannot be re-established.
+// Failed topics are reconnected automatically, so the handler is for reporting and monitoring.
+func UseBridgeErrorHandler(handler BridgeErrorFunc) OptionsModifier {
+	return func(o *Options) {
+		o.BridgeErrorHandler = handler
+	}
+}
+
+// UseBridgeRelay sets whether messages are relayed between the mesh and bridge topics. By default they are relayed in both directions.
+func UseBridgeRelay(relay BridgeRelay) OptionsModifier {
+	return func(o *Options) {
+		o.BridgeRelay = relay
+	}
+}
+
 // UseEndpoint sets the endpoint settings for the instance to broadcast for discovery
 // Pass empty strings for either if you would like to keep the defaults (8080 and /meta/message)
 func UseEndpoint(port, uri string) OptionsModifier {
@@ -64,6 +88,21 @@ func UseEndpoint(port, uri string) OptionsModifier {
 	}
 }
 
+// UseTLS sets the TLS options to be used by mesh transports that support TLS
+func UseTLS(tlsOpts *TLSOptions) OptionsModifier {
+	return func(o *Options) {
+		o.TLS = tlsOpts
+	}
+}
+
+// UseNodeUUID sets the UUID of the Grav instance rather than generating a random one.
+// This is useful when the UUID must be known ahead of time, for example to issue a TLS certificate for the node.
+func UseNodeUUID(uuid string) OptionsModifier {
+	return func(o *Options) {
+		o.NodeUUID = uuid
+	}
+}
+
 // UseDiscovery sets the discovery plugin to be used
 func UseDiscovery(discovery Discovery) OptionsModifier {
 	return func(o *Options) {
@@ -71,6 +110,45 @@ func UseDiscovery(discovery Discovery) OptionsModifier {
 	}
 }
 
+// UseDiscoveryLabels sets labels advertised to peers by discovery plugins that support metadata
+func UseDiscoveryLabels(labels map[string]string) OptionsModifier {
+	return func(o *Options) {
+		o.DiscoveryLabels = labels
+	}
+}
+
+// UseDiscoveryFilter sets a function that chooses which peers reported by discovery plugins are dialed, such as by their
+// labels or interests. Peers whose metadata is incompatible are skipped regardless of the filter. The filter does not apply
+// to incoming connections, since handshakes don't carry labels, so peers that a filter skips can still connect to this node
+// unless they skip it too or belong to a different group.
+func UseDiscoveryFilter(filter DiscoveryFilterFunc) OptionsModifier {
+	return func(o *Options) {
+		o.DiscoveryFilter = filter
+	}
+}
+
+// UseAuthenticator sets the plugin used to authenticate mesh peers during the handshake.
+// Peers that fail authentication are rejected before they are added to the mesh.
+func UseAuthenticator(auth Authenticator) OptionsModifier {
+	return func(o *Options) {
+		o.Authenticator = auth
+	}
+}
+
+// UseSealer sets the plugin used to encrypt and authenticate messages sent and received via the bridge transport
+func UseSealer(sealer Sealer) OptionsModifier {
+	return func(o *Options) {
+		o.Sealer = sealer
+	}
+}
+
+// UseACL sets the rules that control which mesh peers may publish and receive which message types
+func UseACL(acl *ACL) OptionsModifier {
+	return func(o *Options) {
+		o.ACL = acl
+	}
+}
+
 // UseBelongsTo sets the 'BelongsTo' property for the Grav instance
 func UseBelongsTo(belongsTo string) OptionsModifier {
 	return func(o *Options) {
@@ -87,14 +165,23 @@ func UseInterests(interests ...string) OptionsModifier {
 
 func defaultOptions() *Options {
 	o := &Options{
-		BelongsTo:       "*",
-		Interests:       []string{},
-		Logger:          vlog.Default(),
-		Port:            "8080",
-		URI:             "/meta/message",
-		MeshTransport:   nil,
-		BridgeTransport: nil,
-		Discovery:       nil,
+		NodeUUID:           "",
+		BelongsTo:          "*",
+		Interests:          []string{},
+		Logger:             vlog.Default(),
+		Port:               "8080",
+		URI:                "/meta/message",
+		TLS:                nil,
+		MeshTransport:      nil,
+		BridgeTransport:    nil,
+		BridgeErrorHandler: nil,
+		BridgeRelay:        BridgeRelay{ToMesh: true, FromMesh: true},
+		Discovery:          nil,
+		DiscoveryLabels:    map[string]string{},
+		DiscoveryFilter:    nil,
+		Authenticator:      nil,
+		Sealer:             nil,
+		ACL:                nil,
 	}
 
 	return o
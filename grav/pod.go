@@ -55,6 +55,18 @@ type Pod struct {
 type podOpts struct {
 	WantsReplay bool
 	replayOnce  sync.Once
+
+	// relay is set for pods created by the hub, controlling which messages the pod exchanges with the bus
+	relay *podRelay
+
+	// internal is set for pods created for discovery plugins, which receive internal messages
+	internal bool
+}
+
+// receivesType returns true if the pod receives messages of the type. Internal messages are kept from
+// application pods, and only received by the pods of the hub and discovery plugins.
+func (o *podOpts) receivesType(msgType string) bool {
+	return o.internal || o.relay != nil || !isInternalMsgType(msgType)
 }
 
 // newPod creates a new Pod
@@ -88,15 +100,21 @@ func (p *Pod) Send(msg Message) *MsgReceipt {
 		return nil
 	}
 
-	p.FilterUUID(msg.UUID(), false) // don't allow the same message to bounce back through this pod
-
-	p.busChan <- msg
-
 	t := &MsgReceipt{
 		UUID: msg.UUID(),
 		pod:  p,
 	}
 
+	// messages discarded by the relay (such as echoes from a bridge) are treated as sent, since they have already been handled
+	if !p.opts.relay.send(msg) {
+		msgDelivered(msg, nil)
+		return t
+	}
+
+	p.FilterUUID(msg.UUID(), false) // don't allow the same message to bounce back through this pod
+
+	p.busChan <- msg
+
 	return t
 }
 
@@ -259,12 +277,20 @@ func (p *Pod) start() {
 					return
 				}
 
-				if p.allow(msg) {
-					if err := p.onFunc(msg); err != nil {
+				if p.opts.receivesType(msg.Type()) && p.allow(msg) && p.opts.relay.receive(msg) {
+					err := p.onFunc(msg)
+
+					// only application pods report whether a message was handled, not those created by the hub
+					if p.opts.relay == nil && err != ErrMsgNotWanted {
+						msgDelivered(msg, err)
+					}
+
+					if err != nil {
 						// if the onFunc failed, send it back to the bus to be re-sent later
 						p.feedbackChan <- msg
 					} else {
 						// if it was successful, a success message on the channel lets the conn know all is well
+						p.opts.relay.delivered(msg)
 						p.feedbackChan <- podFeedbackMsgSuccess
 					}
 				}
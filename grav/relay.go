@@ -0,0 +1,266 @@
+package grav
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// originMesh is the origin of messages received from mesh peers
+	originMesh = "mesh"
+	// originBridgePrefix prefixes the topic in the origin of messages received from bridge topics
+	originBridgePrefix = "bridge:"
+
+	// publishedHistorySize is the number of message UUIDs recently published to each bridge topic that are remembered
+	publishedHistorySize = 1024
+)
+
+// BridgeRelay controls whether messages are relayed between the mesh and bridge topics. When every node in a mesh is
+// connected to the same bridge, relaying in both directions causes nodes to receive messages more than once, since
+// they arrive both from the broker and from peers. Messages are never published back to the bridge topic they arrived from.
+type BridgeRelay struct {
+	// ToMesh relays messages received from bridge topics to mesh peers
+	ToMesh bool
+	// FromMesh publishes messages received from mesh peers to bridge topics
+	FromMesh bool
+}
+
+// podRelay is used by the hub to control how messages flow through the pods it creates for the mesh and bridge topics
+type podRelay struct {
+	// origin is recorded on the messages sent by the pod
+	origin string
+	// sendFunc returns false for messages sent by the pod that should be discarded
+	sendFunc func(Message) bool
+	// receiveFunc returns false for messages from the bus that should not reach the pod's onFunc
+	receiveFunc func(Message) bool
+	// deliveredFunc is called once the pod's onFunc has handled a message without error
+	deliveredFunc func(Message)
+}
+
+// originMessage is implemented by messages that can record where they entered the Grav instance.
+// The origin is only kept in-process, but the bridge topics are encoded with the message so that
+// mesh peers connected to the same topics don't publish it to them again.
+type originMessage interface {
+	origin() string
+	setOrigin(string)
+	bridges() []string
+	setBridges([]string)
+	withBridges([]string) Message
+}
+
+// send records the pod's origin on a message and returns true if it should be sent
+func (r *podRelay) send(msg Message) bool {
+	if r == nil {
+		return true
+	}
+
+	if om, ok := msg.(originMessage); ok && om.origin() == "" {
+		om.setOrigin(r.origin)
+	}
+
+	if r.sendFunc == nil {
+		return true
+	}
+
+	return r.sendFunc(msg)
+}
+
+// receive returns true if a message from the bus should reach the pod's onFunc
+func (r *podRelay) receive(msg Message) bool {
+	if r == nil || r.receiveFunc == nil {
+		return true
+	}
+
+	return r.receiveFunc(msg)
+}
+
+// delivered is called once the pod's onFunc has handled a message
+func (r *podRelay) delivered(msg Message) {
+	if r == nil || r.deliveredFunc == nil {
+		return
+	}
+
+	r.deliveredFunc(msg)
+}
+
+// msgOrigin returns where a message entered the Grav instance, or an empty string for messages sent by local pods
+func msgOrigin(msg Message) string {
+	if om, ok := msg.(originMessage); ok {
+		return om.origin()
+	}
+
+	return ""
+}
+
+// msgHasBridge returns true if the message was received from or published to the topic, by this node or the peer it came from
+func msgHasBridge(msg Message, topic string) bool {
+	om, ok := msg.(originMessage)
+	if !ok {
+		return false
+	}
+
+	for _, t := range om.bridges() {
+		if t == topic {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addMsgBridge records that a message was received from a topic
+func addMsgBridge(msg Message, topic string) {
+	om, ok := msg.(originMessage)
+	if !ok || msgHasBridge(msg, topic) {
+		return
+	}
+
+	topics := append([]string{}, om.bridges()...)
+	om.setBridges(append(topics, topic))
+}
+
+// MsgBridges returns the bridge topics a message was received from or published to before crossing the mesh. Transports
+// that encode messages with their own format must carry them, so that peers connected to the same topics don't publish
+// the message to them again, and restore them with SetMsgBridges.
+func MsgBridges(msg Message) []string {
+	om, ok := msg.(originMessage)
+	if !ok {
+		return nil
+	}
+
+	return om.bridges()
+}
+
+// SetMsgBridges sets the bridge topics of a message received from a mesh peer, such as one built with MsgFromParts
+func SetMsgBridges(msg Message, topics []string) {
+	if om, ok := msg.(originMessage); ok {
+		om.setBridges(topics)
+	}
+}
+
+func bridgeOrigin(topic string) string {
+	return originBridgePrefix + topic
+}
+
+// meshRelay returns the relay for the hub's pod, which sends messages received from mesh peers and relays the bus to them
+func (h *hub) meshRelay() *podRelay {
+	r := &podRelay{
+		origin: originMesh,
+		receiveFunc: func(msg Message) bool {
+			return h.bridgeRelay.ToMesh || !strings.HasPrefix(msgOrigin(msg), originBridgePrefix)
+		},
+	}
+
+	return r
+}
+
+// meshMsgLocked returns the message to be sent to mesh peers, listing the bridge topics this node publishes it to
+// so that peers connected to the same topics don't publish it again. The hub's lock must be held.
+func (h *hub) meshMsgLocked(msg Message) Message {
+	om, ok := msg.(originMessage)
+	if !ok {
+		return msg
+	}
+
+	topics := append([]string{}, om.bridges()...)
+
+	for topic, bt := range h.bridgeTopics {
+		if bt.state == BridgeStateConnected && bt.publishes(msg.Type()) && !msgHasBridge(msg, topic) {
+			topics = append(topics, topic)
+		}
+	}
+
+	if len(topics) == len(om.bridges()) {
+		return msg
+	}
+
+	sort.Strings(topics)
+
+	// the message is shared with the other pods on the bus, so a copy is sent instead of modifying it
+	return om.withBridges(topics)
+}
+
+// topicRelay returns the relay for a bridge topic's pod. Messages that were received from the topic, by this node or by the mesh
+// peer they came from, are not published back to it. Messages are published to the topic at most once, and echoes from the broker
+// of messages this node published are discarded. Messages the broker redelivers are not discarded, since they may have failed.
+func (h *hub) topicRelay(bt *bridgeTopic) *podRelay {
+	r := &podRelay{
+		origin: bridgeOrigin(bt.topic),
+		sendFunc: func(msg Message) bool {
+			if bt.published.has(msg.UUID()) {
+				return false
+			}
+
+			addMsgBridge(msg, bt.topic)
+
+			return true
+		},
+		receiveFunc: func(msg Message) bool {
+			if msgHasBridge(msg, bt.topic) {
+				return false
+			} else if msgOrigin(msg) == originMesh && !h.bridgeRelay.FromMesh {
+				return false
+			} else if bt.published.has(msg.UUID()) {
+				// the message has reached the bus again, such as from a mesh peer that received it from the topic
+				return false
+			}
+
+			return true
+		},
+		deliveredFunc: func(msg Message) {
+			// only recorded once published, so that a failed publish is retried when the bus re-sends the message
+			if bt.publishes(msg.Type()) {
+				bt.published.add(msg.UUID())
+			}
+		},
+	}
+
+	return r
+}
+
+// uuidHistory is a fixed-size set of the most recently added UUIDs
+type uuidHistory struct {
+	uuids map[string]struct{}
+	ring  []string
+	next  int
+
+	lock sync.RWMutex
+}
+
+func newUUIDHistory(size int) *uuidHistory {
+	u := &uuidHistory{
+		uuids: make(map[string]struct{}, size),
+		ring:  make([]string, size),
+		lock:  sync.RWMutex{},
+	}
+
+	return u
+}
+
+func (u *uuidHistory) add(uuid string) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if _, exists := u.uuids[uuid]; exists {
+		return
+	}
+
+	// evict the oldest UUID to make room
+	if oldest := u.ring[u.next]; oldest != "" {
+		delete(u.uuids, oldest)
+	}
+
+	u.ring[u.next] = uuid
+	u.uuids[uuid] = struct{}{}
+	u.next = (u.next + 1) % len(u.ring)
+}
+
+func (u *uuidHistory) has(uuid string) bool {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	_, exists := u.uuids[uuid]
+
+	return exists
+}
@@ -0,0 +1,87 @@
+package grav
+
+import "testing"
+
+func TestUUIDHistory(t *testing.T) {
+	history := newUUIDHistory(2)
+
+	history.add("a")
+	history.add("b")
+	history.add("b")
+
+	if !history.has("a") || !history.has("b") {
+		t.Error("expected history to have a and b")
+	}
+
+	// adding a third UUID evicts the oldest
+	history.add("c")
+
+	if history.has("a") {
+		t.Error("expected a to be evicted")
+	}
+
+	if !history.has("b") || !history.has("c") {
+		t.Error("expected history to have b and c")
+	}
+}
+
+func TestMsgOrigin(t *testing.T) {
+	msg := NewMsg(MsgTypeDefault, []byte("hello"))
+
+	relay := &podRelay{origin: bridgeOrigin("events")}
+	if !relay.send(msg) {
+		t.Error("expected message to be sent")
+	}
+
+	if origin := msgOrigin(msg); origin != "bridge:events" {
+		t.Errorf("expected bridge:events, got %s", origin)
+	}
+
+	// the first origin recorded is kept
+	(&podRelay{origin: originMesh}).send(msg)
+
+	if origin := msgOrigin(msg); origin != "bridge:events" {
+		t.Errorf("expected bridge:events, got %s", origin)
+	}
+
+	// the origin is not encoded
+	encoded, err := msg.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := MsgFromBytes(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if origin := msgOrigin(decoded); origin != "" {
+		t.Errorf("expected no origin, got %s", origin)
+	}
+}
+
+func TestMsgBridges(t *testing.T) {
+	msg := NewMsg(MsgTypeDefault, []byte("hello"))
+
+	addMsgBridge(msg, "events")
+	addMsgBridge(msg, "events")
+
+	if !msgHasBridge(msg, "events") {
+		t.Error("expected message to have bridge events")
+	}
+
+	// the bridges are encoded, so that peers don't publish the message back to the topic
+	encoded, err := msg.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := MsgFromBytes(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bridges := decoded.(originMessage).bridges(); len(bridges) != 1 || bridges[0] != "events" {
+		t.Errorf("expected bridges [events], got %v", bridges)
+	}
+}
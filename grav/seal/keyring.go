@@ -0,0 +1,186 @@
+package seal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoActiveKey and others are errors related to sealing and opening data
+var (
+	ErrNoActiveKey  = errors.New("group has no active key")
+	ErrUnknownKey   = errors.New("data was sealed with an unknown key")
+	ErrKeyIsActive  = errors.New("the active key cannot be removed")
+	ErrNotSealed    = errors.New("data is not sealed")
+	ErrOpenFailed   = errors.New("sealed data failed authentication")
+	ErrKeyNotExists = errors.New("key does not exist")
+)
+
+// envelopeVersion is the current version of the sealed envelope format
+const envelopeVersion = 1
+
+// Keyring holds AES-GCM keys for each group (for example each BelongsTo value) and uses them to seal and open data.
+// Each group has one active key that is used to seal new data, and any number of keys that can still be used to open data,
+// which allows keys to be rotated by adding a new key, activating it once every node has it, and then removing the old one.
+type Keyring struct {
+	groups map[string]*groupKeys
+	lock   sync.RWMutex
+}
+
+type groupKeys struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// envelope is the encoded form of sealed data
+type envelope struct {
+	Version int    `json:"sealed"`
+	KeyID   string `json:"kid"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// NewKeyring creates an empty Keyring
+func NewKeyring() *Keyring {
+	k := &Keyring{
+		groups: map[string]*groupKeys{},
+		lock:   sync.RWMutex{},
+	}
+
+	return k
+}
+
+// AddKey adds a 16, 24 or 32 byte AES key to the group. The first key added to a group becomes its active key.
+func (k *Keyring) AddKey(group, id string, key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return errors.Wrap(err, "failed to NewCipher")
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return errors.Wrap(err, "failed to NewGCM")
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	keys, exists := k.groups[group]
+	if !exists {
+		keys = &groupKeys{active: id, keys: map[string]cipher.AEAD{}}
+		k.groups[group] = keys
+	}
+
+	keys.keys[id] = aead
+
+	return nil
+}
+
+// Activate sets the key that is used to seal new data for the group
+func (k *Keyring) Activate(group, id string) error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	keys, exists := k.groups[group]
+	if !exists {
+		return ErrKeyNotExists
+	}
+
+	if _, exists := keys.keys[id]; !exists {
+		return ErrKeyNotExists
+	}
+
+	keys.active = id
+
+	return nil
+}
+
+// RemoveKey removes a key from the group, after which data sealed with it can no longer be opened
+func (k *Keyring) RemoveKey(group, id string) error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	keys, exists := k.groups[group]
+	if !exists {
+		return ErrKeyNotExists
+	}
+
+	if keys.active == id {
+		return ErrKeyIsActive
+	}
+
+	delete(keys.keys, id)
+
+	return nil
+}
+
+// Seal encrypts and authenticates data using the group's active key
+func (k *Keyring) Seal(group string, data []byte) ([]byte, error) {
+	k.lock.RLock()
+	keys, exists := k.groups[group]
+	if !exists {
+		k.lock.RUnlock()
+		return nil, ErrNoActiveKey
+	}
+
+	keyID := keys.active
+	aead := keys.keys[keyID]
+	k.lock.RUnlock()
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "failed to generate nonce")
+	}
+
+	env := envelope{
+		Version: envelopeVersion,
+		KeyID:   keyID,
+		Nonce:   nonce,
+		Data:    aead.Seal(nil, nonce, data, additionalData(group, keyID)),
+	}
+
+	return json.Marshal(env)
+}
+
+// Open verifies and decrypts data that was sealed for the group.
+// ErrOpenFailed is returned if the data was tampered with or sealed for a different group.
+func (k *Keyring) Open(group string, sealed []byte) ([]byte, error) {
+	env := envelope{}
+	if err := json.Unmarshal(sealed, &env); err != nil || env.Version != envelopeVersion {
+		return nil, ErrNotSealed
+	}
+
+	k.lock.RLock()
+	keys, exists := k.groups[group]
+	if !exists {
+		k.lock.RUnlock()
+		return nil, ErrUnknownKey
+	}
+
+	aead, exists := keys.keys[env.KeyID]
+	k.lock.RUnlock()
+
+	if !exists {
+		return nil, ErrUnknownKey
+	}
+
+	if len(env.Nonce) != aead.NonceSize() {
+		return nil, ErrOpenFailed
+	}
+
+	data, err := aead.Open(nil, env.Nonce, env.Data, additionalData(group, env.KeyID))
+	if err != nil {
+		return nil, ErrOpenFailed
+	}
+
+	return data, nil
+}
+
+// additionalData binds sealed data to its group and key so that it cannot be opened in any other context
+func additionalData(group, keyID string) []byte {
+	return []byte(group + "|" + keyID)
+}
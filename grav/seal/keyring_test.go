@@ -0,0 +1,102 @@
+package seal
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	k := NewKeyring()
+
+	if err := k.AddKey("billing", "v1", bytes.Repeat([]byte("a"), 32)); err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := k.Seal("billing", []byte("hello, world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(sealed, []byte("hello, world")) {
+		t.Error("sealed data contains plaintext")
+	}
+
+	data, err := k.Open("billing", sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "hello, world" {
+		t.Errorf("expected 'hello, world', got %s", string(data))
+	}
+
+	if _, err := k.Open("billing", []byte("hello, world")); err != ErrNotSealed {
+		t.Errorf("expected ErrNotSealed, got %v", err)
+	}
+}
+
+func TestSealTampered(t *testing.T) {
+	k := NewKeyring()
+	k.AddKey("billing", "v1", bytes.Repeat([]byte("a"), 32))
+	k.AddKey("shipping", "v1", bytes.Repeat([]byte("a"), 32))
+
+	sealed, err := k.Seal("billing", []byte("hello, world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same key material in a different group must not open the data
+	if _, err := k.Open("shipping", sealed); err != ErrOpenFailed {
+		t.Errorf("expected ErrOpenFailed for wrong group, got %v", err)
+	}
+
+	// flip a character inside the base64 encoded ciphertext
+	idx := bytes.Index(sealed, []byte(`"data":"`)) + len(`"data":"`)
+	tampered := append([]byte{}, sealed...)
+	if tampered[idx] == 'A' {
+		tampered[idx] = 'B'
+	} else {
+		tampered[idx] = 'A'
+	}
+
+	if _, err := k.Open("billing", tampered); err != ErrOpenFailed {
+		t.Errorf("expected ErrOpenFailed for tampered data, got %v", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	k := NewKeyring()
+	k.AddKey("billing", "v1", bytes.Repeat([]byte("a"), 32))
+
+	oldSealed, _ := k.Seal("billing", []byte("old"))
+
+	if err := k.AddKey("billing", "v2", bytes.Repeat([]byte("b"), 32)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := k.RemoveKey("billing", "v1"); err != ErrKeyIsActive {
+		t.Errorf("expected ErrKeyIsActive, got %v", err)
+	}
+
+	if err := k.Activate("billing", "v2"); err != nil {
+		t.Fatal(err)
+	}
+
+	newSealed, _ := k.Seal("billing", []byte("new"))
+
+	if data, err := k.Open("billing", oldSealed); err != nil || string(data) != "old" {
+		t.Errorf("expected old data to open during rotation, got %v", err)
+	}
+
+	if err := k.RemoveKey("billing", "v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := k.Open("billing", oldSealed); err != ErrUnknownKey {
+		t.Errorf("expected ErrUnknownKey after removal, got %v", err)
+	}
+
+	if data, err := k.Open("billing", newSealed); err != nil || string(data) != "new" {
+		t.Errorf("expected new data to open, got %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+package grav
+
+// Sealer is a plugin that encrypts and authenticates data before it leaves the node via a bridge transport,
+// and verifies and decrypts it when it is received. The group is the BelongsTo of the Grav instance, allowing
+// each group to use its own keys. See the grav/seal package for an AEAD Keyring that implements Sealer.
+type Sealer interface {
+	// Seal encrypts and authenticates the data for the group
+	Seal(group string, data []byte) ([]byte, error)
+	// Open verifies and decrypts data that was sealed for the group, returning an error if it was tampered with
+	Open(group string, sealed []byte) ([]byte, error)
+}
+
+// Seal seals encoded message data using the configured Sealer, or returns it unchanged if there is none
+func (b *BridgeOptions) Seal(data []byte) ([]byte, error) {
+	if b.Sealer == nil {
+		return data, nil
+	}
+
+	return b.Sealer.Seal(b.BelongsTo, data)
+}
+
+// Open opens data that was received by a bridge using the configured Sealer, or returns it unchanged if there is none.
+// When a Sealer is configured, bridges must discard data that fails to Open.
+func (b *BridgeOptions) Open(sealed []byte) ([]byte, error) {
+	if b.Sealer == nil {
+		return sealed, nil
+	}
+
+	return b.Sealer.Open(b.BelongsTo, sealed)
+}
@@ -0,0 +1,59 @@
+package grav
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+)
+
+// TLSOptions configures TLS for mesh transports that support it
+type TLSOptions struct {
+	// Config is used both when dialing peers and when accepting connections from them.
+	// The CA pool (RootCAs and ClientCAs), the node's certificates, ServerName and ClientAuth are all set here.
+	Config *tls.Config
+	// VerifyPeerUUID requires that the certificate presented by a peer names the node UUID it sends in its handshake,
+	// either as the certificate's CommonName, a DNS name, or a URI such as urn:uuid:<uuid>
+	VerifyPeerUUID bool
+}
+
+// VerifyPeer checks that the peer certificate in the provided connection state belongs to the node with the given UUID.
+// If VerifyPeerUUID is not set, VerifyPeer does nothing.
+func (t *TLSOptions) VerifyPeer(state *tls.ConnectionState, uuid string) error {
+	if t == nil || !t.VerifyPeerUUID {
+		return nil
+	}
+
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return ErrPeerIdentityMismatch
+	}
+
+	if !certNamesUUID(state.PeerCertificates[0], uuid) {
+		return ErrPeerIdentityMismatch
+	}
+
+	return nil
+}
+
+// certNamesUUID returns true if the certificate's subject or SANs contain the UUID
+func certNamesUUID(cert *x509.Certificate, uuid string) bool {
+	if uuid == "" {
+		return false
+	}
+
+	if cert.Subject.CommonName == uuid {
+		return true
+	}
+
+	for _, name := range cert.DNSNames {
+		if name == uuid {
+			return true
+		}
+	}
+
+	for _, uri := range cert.URIs {
+		if uri.String() == "urn:uuid:"+uuid {
+			return true
+		}
+	}
+
+	return false
+}
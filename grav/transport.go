@@ -7,12 +7,20 @@ import (
 
 // ErrConnectionClosed and others are transport and connection related errors
 var (
-	ErrConnectionClosed  = errors.New("connection was closed")
-	ErrNodeUUIDMismatch  = errors.New("handshake UUID did not match node UUID")
-	ErrBelongsToMismatch = errors.New("new connection doesn't belongTo the same group or *")
-	ErrNodeWithdrawn     = errors.New("node has withdrawn from the mesh")
+	ErrConnectionClosed        = errors.New("connection was closed")
+	ErrNodeUUIDMismatch        = errors.New("handshake UUID did not match node UUID")
+	ErrBelongsToMismatch       = errors.New("new connection doesn't belongTo the same group or *")
+	ErrNodeWithdrawn           = errors.New("node has withdrawn from the mesh")
+	ErrProtocolVersionMismatch = errors.New("peer protocol version is not supported")
+	ErrAuthFailed              = errors.New("peer failed authentication")
+	ErrHandshakeRejected       = errors.New("peer rejected the connection handshake")
+	ErrPeerIdentityMismatch    = errors.New("peer certificate does not match its node UUID")
+	ErrConnectedToSelf         = errors.New("endpoint belongs to this node")
 )
 
+// errIdentifyHandshake is the reason given in the ack to an identify handshake, which is never accepted
+var errIdentifyHandshake = errors.New("handshake only identifies the node")
+
 type (
 	// ReceiveFunc is a function that allows passing along a received message
 	ReceiveFunc func(msg Message)
@@ -36,15 +44,21 @@ type MeshOptions struct {
 	NodeUUID string
 	Port     string
 	URI      string
+	TLS      *TLSOptions
 	Logger   *vlog.Logger
 	Custom   interface{}
 }
 
 // BridgeOptions is a set of options for mesh transports
 type BridgeOptions struct {
-	NodeUUID string
-	Logger   *vlog.Logger
-	Custom   interface{}
+	NodeUUID  string
+	BelongsTo string
+	Sealer    Sealer
+	Logger    *vlog.Logger
+	Custom    interface{}
+
+	// failFunc is called when a bridge connection reports that it has failed
+	failFunc func(BridgeConnection, error)
 }
 
 // MeshTransport represents a transport plugin for connecting to meshed peers
@@ -56,6 +70,13 @@ type MeshTransport interface {
 	Connect(endpoint string) (Connection, error)
 }
 
+// TransportStopper is an optional interface for transports that hold resources such as listeners or servers,
+// allowing them to be released when the Grav instance is stopped
+type TransportStopper interface {
+	// Stop shuts the transport down gracefully
+	Stop() error
+}
+
 // BridgeTransport represents a transport plugin that connects to centralized brokers
 type BridgeTransport interface {
 	// Setup is a transport-specific function that allows bootstrapping
@@ -64,6 +85,13 @@ type BridgeTransport interface {
 	ConnectTopic(topic string) (BridgeConnection, error)
 }
 
+// MappingBridgeTransport is an optional interface for bridge transports that can connect to a topic
+// using a TopicMapping, which is required by ConnectBridgeTopicWithMapping
+type MappingBridgeTransport interface {
+	// ConnectTopicWithMapping connects to a topic and returns a BridgeConnection that maps messages using the mapping
+	ConnectTopicWithMapping(topic string, mapping TopicMapping) (BridgeConnection, error)
+}
+
 // Connection represents a connection to another node in the mesh
 type Connection interface {
 	// SendMsg a message from the local instance to the connected node
@@ -93,14 +121,28 @@ type TransportHandshake struct {
 	UUID      string   `json:"uuid"`
 	BelongsTo string   `json:"belongsTo"`
 	Interests []string `json:"interests"`
+	Version   int      `json:"version"`
+	Features  []string `json:"features"`
+
+	Challenge   string `json:"challenge,omitempty"`
+	Credentials string `json:"credentials,omitempty"`
+
+	// Identify asks the accepting node only for its UUID, which a node using an Authenticator must learn before it can
+	// bind its credentials to it. The handshake is answered with an ack that is not accepted, and is not authenticated.
+	Identify bool `json:"identify,omitempty"`
 }
 
 // TransportHandshakeAck represents a handshake response
 type TransportHandshakeAck struct {
 	Accept    bool     `json:"accept"`
+	Reason    string   `json:"reason,omitempty"`
 	UUID      string   `json:"uuid"`
 	BelongsTo string   `json:"belongsTo"`
 	Interests []string `json:"interests"`
+	Version   int      `json:"version"`
+	Features  []string `json:"features"`
+
+	Credentials string `json:"credentials,omitempty"`
 }
 
 // TransportWithdraw represents a message sent to a peer indicating a withdrawal from the mesh
@@ -0,0 +1,88 @@
+// Package gravtest contains helpers for testing transports with Grav instances. It is separate from testutil,
+// which is used by the grav package's own tests and so cannot import it.
+package gravtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+// Receiver returns a channel of the messages received by the pod
+func Receiver(pod *grav.Pod) chan grav.Message {
+	received := make(chan grav.Message, 10)
+
+	pod.On(func(msg grav.Message) error {
+		received <- msg
+		return nil
+	})
+
+	return received
+}
+
+// ReceiveOne waits for a message from a Receiver channel and checks its data, returning nil if none arrives
+func ReceiveOne(t testing.TB, ch chan grav.Message, expected string) grav.Message {
+	t.Helper()
+
+	select {
+	case msg := <-ch:
+		if string(msg.Data()) != expected {
+			t.Errorf("expected %s, got %s", expected, string(msg.Data()))
+		}
+
+		return msg
+	case <-time.After(time.Second * 3):
+		t.Errorf("timed out waiting for %s", expected)
+	}
+
+	return nil
+}
+
+// ReceiveAll waits for a message with each of the expected data from a Receiver channel, in any order,
+// and returns them keyed by their data. Pods handle messages concurrently, so their order is not guaranteed.
+func ReceiveAll(t testing.TB, ch chan grav.Message, expected ...string) map[string]grav.Message {
+	t.Helper()
+
+	wanted := map[string]bool{}
+	for _, e := range expected {
+		wanted[e] = true
+	}
+
+	received := map[string]grav.Message{}
+
+	for len(received) < len(wanted) {
+		select {
+		case msg := <-ch:
+			data := string(msg.Data())
+			if !wanted[data] {
+				t.Errorf("expected one of %v, got %s", expected, data)
+				continue
+			}
+
+			received[data] = msg
+		case <-time.After(time.Second * 3):
+			t.Errorf("timed out waiting for %v, got %d", expected, len(received))
+			return received
+		}
+	}
+
+	return received
+}
+
+// BridgeNode creates a Grav instance that uses the bridge transport and connects it to the topic
+func BridgeNode(t testing.TB, transport grav.BridgeTransport, topic string) *grav.Grav {
+	t.Helper()
+
+	g := grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseBridgeTransport(transport),
+	)
+
+	if err := g.ConnectBridgeTopic(topic); err != nil {
+		t.Fatal(err)
+	}
+
+	return g
+}
@@ -0,0 +1,21 @@
+package testutil
+
+import (
+	"fmt"
+	"net"
+	"testing"
+)
+
+// FreePort returns a port on 127.0.0.1 that is not in use
+func FreePort(t testing.TB) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	return fmt.Sprintf("%d", listener.Addr().(*net.TCPAddr).Port)
+}
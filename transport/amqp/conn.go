@@ -0,0 +1,291 @@
+package amqp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+// Conn implements transport.TopicConnection and represents a queue consumer and publisher for a Grav message type.
+// Each Conn uses its own channel, which is reopened with backoff if it fails.
+type Conn struct {
+	topic      string
+	mapping    grav.TopicMapping
+	exchange   string
+	routingKey string
+	queue      string
+	opts       *grav.BridgeOptions
+	amqpOpts   Options
+	log        *vlog.Logger
+	pod        *grav.Pod
+
+	channelFn  func() (*amqp.Channel, error)
+	channel    *amqp.Channel
+	deliveries <-chan amqp.Delivery
+	lock       sync.Mutex
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Start begins the receiving of messages. Messages are published with publisher confirms, so an error is returned
+// from the pod's handler if the broker does not confirm a message, allowing Grav to replay it once publishing recovers.
+func (c *Conn) Start(pod *grav.Pod) {
+	c.pod = pod
+
+	c.pod.On(c.mapping.Filter(func(msg grav.Message) error {
+		msgBytes, err := msg.Marshal()
+		if err != nil {
+			return errors.Wrap(err, "failed to Marshal message")
+		}
+
+		msgBytes, err = c.opts.Seal(msgBytes)
+		if err != nil {
+			return errors.Wrap(err, "failed to Seal message")
+		}
+
+		if err := c.publish(msg, msgBytes); err != nil {
+			return errors.Wrap(err, "failed to publish")
+		}
+
+		return nil
+	}))
+
+	go c.consume()
+}
+
+// Close closes the channel, which stops consuming from the queue
+func (c *Conn) Close() {
+	c.log.Debug("[bridge-amqp] connection for", c.topic, "is closing")
+
+	c.closeOnce.Do(func() {
+		close(c.done)
+
+		c.lock.Lock()
+		defer c.lock.Unlock()
+
+		if c.channel != nil && !c.channel.IsClosed() {
+			if err := c.channel.Close(); err != nil {
+				c.log.Error(errors.Wrapf(err, "[bridge-amqp] connection for %s failed to close", c.topic))
+			}
+		}
+	})
+}
+
+// setup opens a channel, declares the exchange and queue, binds them, and begins consuming
+func (c *Conn) setup() error {
+	ch, err := c.channelFn()
+	if err != nil {
+		return errors.Wrap(err, "failed to open channel")
+	}
+
+	if err := c.declare(ch); err != nil {
+		ch.Close()
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.channel = ch
+
+	return nil
+}
+
+func (c *Conn) declare(ch *amqp.Channel) error {
+	if err := ch.Confirm(false); err != nil {
+		return errors.Wrap(err, "failed to Confirm")
+	}
+
+	if err := ch.ExchangeDeclare(c.exchange, amqp.ExchangeTopic, c.amqpOpts.Durable, false, false, false, nil); err != nil {
+		return errors.Wrap(err, "failed to ExchangeDeclare")
+	}
+
+	// private queues are named by the server and deleted when the channel closes
+	private := c.queue == ""
+
+	queue, err := ch.QueueDeclare(c.queue, c.amqpOpts.Durable && !private, private, private, false, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to QueueDeclare")
+	}
+
+	if err := ch.QueueBind(queue.Name, c.routingKey, c.exchange, false, nil); err != nil {
+		return errors.Wrap(err, "failed to QueueBind")
+	}
+
+	if c.amqpOpts.Prefetch > 0 {
+		if err := ch.Qos(c.amqpOpts.Prefetch, 0, false); err != nil {
+			return errors.Wrap(err, "failed to Qos")
+		}
+	}
+
+	deliveries, err := ch.Consume(queue.Name, "", false, false, false, false, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to Consume")
+	}
+
+	c.deliveries = deliveries
+
+	return nil
+}
+
+// publish publishes a message and waits for the broker to confirm it
+func (c *Conn) publish(msg grav.Message, data []byte) error {
+	c.lock.Lock()
+	ch := c.channel
+	c.lock.Unlock()
+
+	if ch == nil || ch.IsClosed() {
+		return ErrChannelClosed
+	}
+
+	publishing := amqp.Publishing{
+		MessageId: msg.UUID(),
+		Type:      msg.Type(),
+		Timestamp: msg.Timestamp(),
+		Body:      data,
+	}
+
+	if c.mapping.TypeHeader != "" {
+		publishing.Headers = amqp.Table{c.mapping.TypeHeader: msg.Type()}
+	}
+
+	if c.amqpOpts.Durable {
+		publishing.DeliveryMode = amqp.Persistent
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), confirmTimeout)
+	defer cancel()
+
+	confirmation, err := ch.PublishWithDeferredConfirmWithContext(ctx, c.exchange, c.routingKey, false, false, publishing)
+	if err != nil {
+		return errors.Wrap(err, "failed to Publish")
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to WaitContext for confirmation")
+	} else if !acked {
+		return ErrNotConfirmed
+	}
+
+	return nil
+}
+
+// consume sends deliveries to the Grav instance until the connection is closed, reopening the channel if it fails
+func (c *Conn) consume() {
+	backoff := minReconnectBackoff
+
+	for {
+		c.lock.Lock()
+		deliveries := c.deliveries
+		c.lock.Unlock()
+
+		for delivery := range deliveries {
+			c.handleDelivery(delivery)
+		}
+
+		// the deliveries channel is closed when the channel fails or is closed
+		for {
+			select {
+			case <-c.done:
+				return
+			case <-time.After(backoff):
+			}
+
+			c.log.Warn("[bridge-amqp] channel for", c.topic, "closed, reconnecting")
+
+			if err := c.setup(); err != nil {
+				c.log.Error(errors.Wrapf(err, "[bridge-amqp] failed to reconnect channel for %s", c.topic))
+
+				backoff *= 2
+				if backoff > maxReconnectBackoff {
+					backoff = maxReconnectBackoff
+				}
+
+				continue
+			}
+
+			backoff = minReconnectBackoff
+			break
+		}
+	}
+}
+
+// handleDelivery sends a delivery to the Grav instance. It is acknowledged once a pod has handled it (or no pod has
+// within the delivery timeout), rejected if it cannot be decoded, and requeued if the pod handling it returns an error
+// or the Grav instance cannot accept it, so that it is redelivered.
+func (c *Conn) handleDelivery(delivery amqp.Delivery) {
+	c.log.Debug("[bridge-amqp] recieved message via", c.topic)
+
+	msg, err := c.toMsg(delivery)
+	if err != nil {
+		c.log.Error(errors.Wrap(err, "[bridge-amqp] failed to toMsg, rejecting"))
+
+		if err := delivery.Reject(false); err != nil {
+			c.log.Error(errors.Wrap(err, "[bridge-amqp] failed to Reject delivery"))
+		}
+
+		return
+	}
+
+	settle := sync.Once{}
+
+	grav.TrackDelivery(msg, c.amqpOpts.DeliveryTimeout, func(err error) {
+		settle.Do(func() { c.settle(delivery, err) })
+	})
+
+	// send to the Grav instance
+	if receipt := c.pod.Send(msg); receipt == nil {
+		settle.Do(func() { c.settle(delivery, grav.ErrConnectionClosed) })
+	}
+}
+
+// settle acknowledges a delivery that was handled, or requeues it if handling it failed
+func (c *Conn) settle(delivery amqp.Delivery, err error) {
+	if err != nil && err != grav.ErrDeliveryTimeout {
+		c.log.Debug("[bridge-amqp] failed to handle message via", c.topic, "requeueing:", err.Error())
+
+		if err := delivery.Nack(false, true); err != nil {
+			c.log.Error(errors.Wrap(err, "[bridge-amqp] failed to Nack delivery"))
+		}
+
+		return
+	}
+
+	if err := delivery.Ack(false); err != nil {
+		c.log.Error(errors.Wrap(err, "[bridge-amqp] failed to Ack delivery"))
+	}
+}
+
+func (c *Conn) toMsg(delivery amqp.Delivery) (grav.Message, error) {
+	data, err := c.opts.Open(delivery.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Open message")
+	}
+
+	msg, err := grav.MsgFromBytes(data)
+	if err != nil {
+		c.log.Debug(errors.Wrap(err, "[bridge-amqp] failed to MsgFromBytes, falling back to raw data").Error())
+
+		msg = grav.NewMsg(c.mapping.MsgType(c.typeHeader(delivery), c.topic), data)
+	}
+
+	return msg, nil
+}
+
+// typeHeader returns the type of a raw delivery from the mapping's TypeHeader if it is present, or from the AMQP type property
+func (c *Conn) typeHeader(delivery amqp.Delivery) string {
+	if c.mapping.TypeHeader != "" {
+		if msgType, ok := delivery.Headers[c.mapping.TypeHeader].(string); ok && msgType != "" {
+			return msgType
+		}
+	}
+
+	return delivery.Type
+}
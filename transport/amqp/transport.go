@@ -0,0 +1,184 @@
+package amqp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+const (
+	// defaultExchange is the exchange used when Options.Exchange is not set
+	defaultExchange = "grav"
+
+	// confirmTimeout is how long a publish waits for the broker to confirm it
+	confirmTimeout = time.Second * 10
+
+	// defaultDeliveryTimeout is used when Options.DeliveryTimeout is not set
+	defaultDeliveryTimeout = time.Second * 10
+
+	// minReconnectBackoff and maxReconnectBackoff bound the wait between attempts to reopen a failed channel
+	minReconnectBackoff = time.Second
+	maxReconnectBackoff = time.Second * 30
+)
+
+// ErrChannelClosed and others are errors returned by the transport
+var (
+	ErrChannelClosed = errors.New("channel is closed")
+	ErrNotConfirmed  = errors.New("publish was not confirmed by the broker")
+)
+
+// Options are the options for an AMQP transport
+type Options struct {
+	// Exchange is the topic exchange that messages are published to, unless Route returns a different one. Defaults to "grav".
+	Exchange string
+	// Route maps a Grav message type to the exchange and routing key used to publish and consume it.
+	// Defaults to the Exchange and the message type itself, as Grav types map naturally onto dot-separated routing keys.
+	Route func(msgType string) (exchange, routingKey string)
+	// Durable declares durable exchanges and queues that survive broker restarts, and publishes persistent messages
+	Durable bool
+	// QueuePrefix names the queue for each topic as "<prefix>.<topic>". Nodes with the same prefix share a queue and
+	// its messages between them. When empty, each node uses a private queue that is deleted when it disconnects.
+	QueuePrefix string
+	// Prefetch limits the number of unacknowledged deliveries for each topic. Defaults to 0 (no limit).
+	Prefetch int
+	// DeliveryTimeout is how long a delivery waits for a pod to handle it before it is acknowledged anyway, so that
+	// messages no pod consumes (such as those only relayed to the mesh) don't stay unacknowledged. Defaults to 10s.
+	DeliveryTimeout time.Duration
+}
+
+// Transport is a transport that connects Grav nodes via an AMQP 0-9-1 broker such as RabbitMQ
+type Transport struct {
+	opts *grav.BridgeOptions
+	log  *vlog.Logger
+
+	url      string
+	amqpOpts Options
+
+	conn *amqp.Connection
+	lock sync.Mutex
+}
+
+// New creates a new AMQP transport connected to the broker at the provided URL
+func New(url string) (*Transport, error) {
+	return NewWithOptions(url, Options{})
+}
+
+// NewWithOptions creates a new AMQP transport connected to the broker at the provided URL with the provided options
+func NewWithOptions(url string, amqpOpts Options) (*Transport, error) {
+	if amqpOpts.Exchange == "" {
+		amqpOpts.Exchange = defaultExchange
+	}
+
+	if amqpOpts.DeliveryTimeout == 0 {
+		amqpOpts.DeliveryTimeout = defaultDeliveryTimeout
+	}
+
+	t := &Transport{
+		url:      url,
+		amqpOpts: amqpOpts,
+		lock:     sync.Mutex{},
+	}
+
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Dial")
+	}
+
+	t.conn = conn
+
+	return t, nil
+}
+
+// Setup sets up the transport
+func (t *Transport) Setup(opts *grav.BridgeOptions) error {
+	t.opts = opts
+	t.log = opts.Logger
+
+	return nil
+}
+
+// ConnectTopic connects to a topic if the transport is a bridge
+func (t *Transport) ConnectTopic(topic string) (grav.BridgeConnection, error) {
+	return t.ConnectTopicWithMapping(topic, grav.DefaultTopicMapping(topic))
+}
+
+// ConnectTopicWithMapping connects to a topic using the provided mapping. Every message published to the topic uses the
+// topic's route, and the mapping's TypeHeader is set as a message header in addition to the AMQP type property.
+func (t *Transport) ConnectTopicWithMapping(topic string, mapping grav.TopicMapping) (grav.BridgeConnection, error) {
+	exchange, routingKey := t.amqpOpts.route(topic)
+
+	conn := &Conn{
+		topic:      topic,
+		mapping:    mapping,
+		exchange:   exchange,
+		routingKey: routingKey,
+		queue:      t.amqpOpts.queueName(topic),
+		opts:       t.opts,
+		amqpOpts:   t.amqpOpts,
+		log:        t.log,
+		channelFn:  t.channel,
+		lock:       sync.Mutex{},
+		done:       make(chan struct{}),
+	}
+
+	if err := conn.setup(); err != nil {
+		return nil, errors.Wrap(err, "failed to setup")
+	}
+
+	return conn, nil
+}
+
+// Stop closes the connection to the broker
+func (t *Transport) Stop() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.conn == nil || t.conn.IsClosed() {
+		return nil
+	}
+
+	if err := t.conn.Close(); err != nil {
+		return errors.Wrap(err, "[bridge-amqp] failed to Close connection")
+	}
+
+	return nil
+}
+
+// channel opens a new channel, first redialing the broker if the connection has failed
+func (t *Transport) channel() (*amqp.Channel, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.conn == nil || t.conn.IsClosed() {
+		conn, err := amqp.Dial(t.url)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to Dial")
+		}
+
+		t.conn = conn
+	}
+
+	return t.conn.Channel()
+}
+
+// route returns the exchange and routing key for a message type
+func (o Options) route(msgType string) (string, string) {
+	if o.Route != nil {
+		return o.Route(msgType)
+	}
+
+	return o.Exchange, msgType
+}
+
+// queueName returns the name of the queue for a topic, or an empty string for a private server-named queue
+func (o Options) queueName(topic string) string {
+	if o.QueuePrefix == "" {
+		return ""
+	}
+
+	return o.QueuePrefix + "." + topic
+}
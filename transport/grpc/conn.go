@@ -0,0 +1,256 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/grav/transport/grpc/meshpb"
+	"github.com/suborbital/vektor/vlog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// ErrUnexpectedFrame is returned when a frame of the wrong kind is received
+var ErrUnexpectedFrame = errors.New("unexpected frame kind")
+
+// stream is the subset of meshpb.Mesh_ConnectClient and meshpb.Mesh_ConnectServer used by Conn
+type stream interface {
+	Send(*meshpb.Frame) error
+	Recv() (*meshpb.Frame, error)
+	Context() context.Context
+}
+
+// Conn implements transport.Connection over one side of a bidirectional gRPC stream
+type Conn struct {
+	nodeUUID string
+	log      *vlog.Logger
+
+	stream stream
+	lock   sync.Mutex
+
+	tlsOpts *grav.TLSOptions
+
+	// closeFunc releases the resources of an outgoing stream, and done signals an incoming stream's handler to return
+	closeFunc func()
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newConn(s stream, log *vlog.Logger, tlsOpts *grav.TLSOptions) *Conn {
+	c := &Conn{
+		log:       log,
+		stream:    s,
+		lock:      sync.Mutex{},
+		tlsOpts:   tlsOpts,
+		done:      make(chan struct{}),
+		closeOnce: sync.Once{},
+	}
+
+	return c
+}
+
+// SendMsg sends a message to the connection
+func (c *Conn) SendMsg(msg grav.Message) error {
+	c.log.Debug("[transport-grpc] sending message", msg.UUID(), "to connection", c.nodeUUID)
+
+	if err := c.sendFrame(&meshpb.Frame{Kind: meshpb.Frame_KIND_MESSAGE, Message: encodeMsg(msg)}); err != nil {
+		if isClosed(err) {
+			return grav.ErrConnectionClosed
+		}
+
+		return errors.Wrap(err, "[transport-grpc] failed to sendFrame")
+	}
+
+	c.log.Debug("[transport-grpc] sent message", msg.UUID(), "to connection", c.nodeUUID)
+
+	return nil
+}
+
+// ReadMsg reads the next message or withdraw from the connection
+func (c *Conn) ReadMsg() (grav.Message, *grav.Withdraw, error) {
+	f, err := c.stream.Recv()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "[transport-grpc] failed to Recv, closing")
+	}
+
+	switch f.Kind {
+	case meshpb.Frame_KIND_WITHDRAW:
+		// let Grav know this message was a withdraw
+		return nil, &grav.Withdraw{Ack: false}, nil
+	case meshpb.Frame_KIND_WITHDRAW_ACK:
+		// let Grav know the peer acknowledged our withdraw
+		return nil, &grav.Withdraw{Ack: true}, nil
+	case meshpb.Frame_KIND_MESSAGE:
+		// handled below
+	default:
+		return nil, nil, errors.Wrapf(ErrUnexpectedFrame, "[transport-grpc] received frame kind %s", f.Kind)
+	}
+
+	if f.Message == nil {
+		return nil, nil, errors.Wrap(ErrUnexpectedFrame, "[transport-grpc] received message frame without a message")
+	}
+
+	msg := decodeMsg(f.Message)
+
+	c.log.Debug("[transport-grpc] received message", msg.UUID(), "via", c.nodeUUID)
+
+	return msg, nil, nil
+}
+
+// OutgoingHandshake performs a connection handshake and returns the UUID of the node that we're connected to
+// so that it can be validated against the UUID that was provided in discovery (or if none was provided)
+func (c *Conn) OutgoingHandshake(handshake *grav.TransportHandshake) (*grav.TransportHandshakeAck, error) {
+	handshakeJSON, err := json.Marshal(handshake)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Marshal handshake JSON")
+	}
+
+	c.log.Debug("[transport-grpc] sending handshake")
+
+	if err := c.sendFrame(&meshpb.Frame{Kind: meshpb.Frame_KIND_HANDSHAKE, Payload: handshakeJSON}); err != nil {
+		return nil, errors.Wrap(err, "failed to sendFrame handshake")
+	}
+
+	f, err := c.stream.Recv()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Recv handshake ack, terminating connection")
+	}
+
+	if f.Kind != meshpb.Frame_KIND_HANDSHAKE_ACK {
+		return nil, errors.Wrap(ErrUnexpectedFrame, "first frame recieved was not handshake ack")
+	}
+
+	c.log.Debug("[transport-grpc] recieved handshake ack")
+
+	ack := grav.TransportHandshakeAck{}
+	if err := json.Unmarshal(f.Payload, &ack); err != nil {
+		return nil, errors.Wrap(err, "failed to Unmarshal handshake ack")
+	}
+
+	if ack.Accept {
+		// the peer's certificate must belong to the node that it claims to be
+		if err := c.tlsOpts.VerifyPeer(c.tlsState(), ack.UUID); err != nil {
+			return nil, errors.Wrapf(err, "failed to VerifyPeer for %s", ack.UUID)
+		}
+	}
+
+	c.nodeUUID = ack.UUID
+
+	return &ack, nil
+}
+
+// IncomingHandshake performs a connection handshake and returns the UUID of the node that we're connected to
+// so that it can be validated against the UUID that was provided in discovery (or if none was provided)
+func (c *Conn) IncomingHandshake(handshakeCallback grav.HandshakeCallback) error {
+	f, err := c.stream.Recv()
+	if err != nil {
+		return errors.Wrap(err, "failed to Recv handshake, terminating connection")
+	}
+
+	if f.Kind != meshpb.Frame_KIND_HANDSHAKE {
+		return errors.Wrap(ErrUnexpectedFrame, "first frame recieved was not handshake")
+	}
+
+	c.log.Debug("[transport-grpc] recieved handshake")
+
+	handshake := &grav.TransportHandshake{}
+	if err := json.Unmarshal(f.Payload, handshake); err != nil {
+		return errors.Wrap(err, "failed to Unmarshal handshake")
+	}
+
+	var ack *grav.TransportHandshakeAck
+
+	// the peer's certificate must belong to the node that it claims to be, otherwise the hub is never consulted
+	verifyErr := c.tlsOpts.VerifyPeer(c.tlsState(), handshake.UUID)
+	if verifyErr != nil {
+		ack = &grav.TransportHandshakeAck{Accept: false, Reason: verifyErr.Error()}
+	} else {
+		ack = handshakeCallback(handshake)
+	}
+
+	ackJSON, err := json.Marshal(ack)
+	if err != nil {
+		return errors.Wrap(err, "failed to Marshal handshake ack JSON")
+	}
+
+	c.log.Debug("[transport-grpc] sending handshake ack")
+
+	if err := c.sendFrame(&meshpb.Frame{Kind: meshpb.Frame_KIND_HANDSHAKE_ACK, Payload: ackJSON}); err != nil {
+		return errors.Wrap(err, "failed to sendFrame handshake ack")
+	}
+
+	c.log.Debug("[transport-grpc] sent handshake ack")
+
+	if verifyErr != nil {
+		return errors.Wrapf(verifyErr, "failed to VerifyPeer for %s", handshake.UUID)
+	}
+
+	c.nodeUUID = handshake.UUID
+
+	return nil
+}
+
+// SendWithdraw sends a withdraw message to the peer
+func (c *Conn) SendWithdraw(withdraw *grav.Withdraw) error {
+	kind := meshpb.Frame_KIND_WITHDRAW
+	if withdraw.Ack {
+		kind = meshpb.Frame_KIND_WITHDRAW_ACK
+	}
+
+	if err := c.sendFrame(&meshpb.Frame{Kind: kind}); err != nil {
+		return errors.Wrap(err, "[transport-grpc] failed to sendFrame for withdraw")
+	}
+
+	return nil
+}
+
+// Close ends the stream
+func (c *Conn) Close() error {
+	c.log.Debug("[transport-grpc] connection for", c.nodeUUID, "is closing")
+
+	c.closeOnce.Do(func() {
+		close(c.done)
+
+		if c.closeFunc != nil {
+			c.closeFunc()
+		}
+	})
+
+	return nil
+}
+
+// sendFrame is a concurrent-safe way to send a single frame on the stream
+func (c *Conn) sendFrame(f *meshpb.Frame) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.stream.Send(f)
+}
+
+// tlsState returns the TLS state of the stream's underlying connection, if it is a TLS connection.
+// For outgoing streams it must only be called after a frame has been received.
+func (c *Conn) tlsState() *tls.ConnectionState {
+	p, ok := peer.FromContext(c.stream.Context())
+	if !ok {
+		return nil
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
+	}
+
+	return &tlsInfo.State
+}
+
+// isClosed returns true if the error indicates that the stream has ended
+func isClosed(err error) bool {
+	return err == io.EOF || status.Code(err) == codes.Canceled
+}
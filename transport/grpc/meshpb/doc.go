@@ -0,0 +1,4 @@
+// Package meshpb is the Go code generated from grav.proto, the wire format of the gRPC transport
+package meshpb
+
+//go:generate protoc -I ../../.. --go_out=../../.. --go_opt=paths=source_relative --go-grpc_out=../../.. --go-grpc_opt=paths=source_relative transport/grpc/meshpb/grav.proto
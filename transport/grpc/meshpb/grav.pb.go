@@ -0,0 +1,373 @@
+// The wire format used by the Grav gRPC transport. Peers in other languages can generate their code from this file
+// and connect using the standard protobuf codec.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.27.1
+// 	protoc        (unknown)
+// source: transport/grpc/meshpb/grav.proto
+
+package meshpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Frame_Kind int32
+
+const (
+	Frame_KIND_UNKNOWN       Frame_Kind = 0
+	Frame_KIND_MESSAGE       Frame_Kind = 1
+	Frame_KIND_HANDSHAKE     Frame_Kind = 2
+	Frame_KIND_HANDSHAKE_ACK Frame_Kind = 3
+	Frame_KIND_WITHDRAW      Frame_Kind = 4
+	Frame_KIND_WITHDRAW_ACK  Frame_Kind = 5
+)
+
+// Enum value maps for Frame_Kind.
+var (
+	Frame_Kind_name = map[int32]string{
+		0: "KIND_UNKNOWN",
+		1: "KIND_MESSAGE",
+		2: "KIND_HANDSHAKE",
+		3: "KIND_HANDSHAKE_ACK",
+		4: "KIND_WITHDRAW",
+		5: "KIND_WITHDRAW_ACK",
+	}
+	Frame_Kind_value = map[string]int32{
+		"KIND_UNKNOWN":       0,
+		"KIND_MESSAGE":       1,
+		"KIND_HANDSHAKE":     2,
+		"KIND_HANDSHAKE_ACK": 3,
+		"KIND_WITHDRAW":      4,
+		"KIND_WITHDRAW_ACK":  5,
+	}
+)
+
+func (x Frame_Kind) Enum() *Frame_Kind {
+	p := new(Frame_Kind)
+	*p = x
+	return p
+}
+
+func (x Frame_Kind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Frame_Kind) Descriptor() protoreflect.EnumDescriptor {
+	return file_transport_grpc_meshpb_grav_proto_enumTypes[0].Descriptor()
+}
+
+func (Frame_Kind) Type() protoreflect.EnumType {
+	return &file_transport_grpc_meshpb_grav_proto_enumTypes[0]
+}
+
+func (x Frame_Kind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Frame_Kind.Descriptor instead.
+func (Frame_Kind) EnumDescriptor() ([]byte, []int) {
+	return file_transport_grpc_meshpb_grav_proto_rawDescGZIP(), []int{0, 0}
+}
+
+type Frame struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Kind Frame_Kind `protobuf:"varint,1,opt,name=kind,proto3,enum=grav.transport.Frame_Kind" json:"kind,omitempty"`
+	// set for KIND_MESSAGE frames
+	Message *Message `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	// the JSON encoded grav.TransportHandshake or grav.TransportHandshakeAck for handshake frames
+	Payload []byte `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+}
+
+func (x *Frame) Reset() {
+	*x = Frame{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_transport_grpc_meshpb_grav_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Frame) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Frame) ProtoMessage() {}
+
+func (x *Frame) ProtoReflect() protoreflect.Message {
+	mi := &file_transport_grpc_meshpb_grav_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Frame.ProtoReflect.Descriptor instead.
+func (*Frame) Descriptor() ([]byte, []int) {
+	return file_transport_grpc_meshpb_grav_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Frame) GetKind() Frame_Kind {
+	if x != nil {
+		return x.Kind
+	}
+	return Frame_KIND_UNKNOWN
+}
+
+func (x *Frame) GetMessage() *Message {
+	if x != nil {
+		return x.Message
+	}
+	return nil
+}
+
+func (x *Frame) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+type Message struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Uuid     string `protobuf:"bytes,1,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	ParentId string `protobuf:"bytes,2,opt,name=parent_id,json=parentId,proto3" json:"parent_id,omitempty"`
+	ReplyTo  string `protobuf:"bytes,3,opt,name=reply_to,json=replyTo,proto3" json:"reply_to,omitempty"`
+	Type     string `protobuf:"bytes,4,opt,name=type,proto3" json:"type,omitempty"`
+	// nanoseconds since the unix epoch
+	Timestamp int64  `protobuf:"varint,5,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Data      []byte `protobuf:"bytes,6,opt,name=data,proto3" json:"data,omitempty"`
+	// the bridge topics the message was received from or published to before crossing the mesh,
+	// so that peers connected to the same topics don't publish it to them again
+	Bridges []string `protobuf:"bytes,7,rep,name=bridges,proto3" json:"bridges,omitempty"`
+}
+
+func (x *Message) Reset() {
+	*x = Message{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_transport_grpc_meshpb_grav_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Message) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Message) ProtoMessage() {}
+
+func (x *Message) ProtoReflect() protoreflect.Message {
+	mi := &file_transport_grpc_meshpb_grav_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Message.ProtoReflect.Descriptor instead.
+func (*Message) Descriptor() ([]byte, []int) {
+	return file_transport_grpc_meshpb_grav_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Message) GetUuid() string {
+	if x != nil {
+		return x.Uuid
+	}
+	return ""
+}
+
+func (x *Message) GetParentId() string {
+	if x != nil {
+		return x.ParentId
+	}
+	return ""
+}
+
+func (x *Message) GetReplyTo() string {
+	if x != nil {
+		return x.ReplyTo
+	}
+	return ""
+}
+
+func (x *Message) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Message) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *Message) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *Message) GetBridges() []string {
+	if x != nil {
+		return x.Bridges
+	}
+	return nil
+}
+
+var File_transport_grpc_meshpb_grav_proto protoreflect.FileDescriptor
+
+var file_transport_grpc_meshpb_grav_proto_rawDesc = []byte{
+	0x0a, 0x20, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x2f, 0x67, 0x72, 0x70, 0x63,
+	0x2f, 0x6d, 0x65, 0x73, 0x68, 0x70, 0x62, 0x2f, 0x67, 0x72, 0x61, 0x76, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x12, 0x0e, 0x67, 0x72, 0x61, 0x76, 0x2e, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f,
+	0x72, 0x74, 0x22, 0x87, 0x02, 0x0a, 0x05, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x12, 0x2e, 0x0a, 0x04,
+	0x6b, 0x69, 0x6e, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x1a, 0x2e, 0x67, 0x72, 0x61,
+	0x76, 0x2e, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x2e, 0x46, 0x72, 0x61, 0x6d,
+	0x65, 0x2e, 0x4b, 0x69, 0x6e, 0x64, 0x52, 0x04, 0x6b, 0x69, 0x6e, 0x64, 0x12, 0x31, 0x0a, 0x07,
+	0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x17, 0x2e,
+	0x67, 0x72, 0x61, 0x76, 0x2e, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x2e, 0x4d,
+	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12,
+	0x18, 0x0a, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c,
+	0x52, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x22, 0x80, 0x01, 0x0a, 0x04, 0x4b, 0x69,
+	0x6e, 0x64, 0x12, 0x10, 0x0a, 0x0c, 0x4b, 0x49, 0x4e, 0x44, 0x5f, 0x55, 0x4e, 0x4b, 0x4e, 0x4f,
+	0x57, 0x4e, 0x10, 0x00, 0x12, 0x10, 0x0a, 0x0c, 0x4b, 0x49, 0x4e, 0x44, 0x5f, 0x4d, 0x45, 0x53,
+	0x53, 0x41, 0x47, 0x45, 0x10, 0x01, 0x12, 0x12, 0x0a, 0x0e, 0x4b, 0x49, 0x4e, 0x44, 0x5f, 0x48,
+	0x41, 0x4e, 0x44, 0x53, 0x48, 0x41, 0x4b, 0x45, 0x10, 0x02, 0x12, 0x16, 0x0a, 0x12, 0x4b, 0x49,
+	0x4e, 0x44, 0x5f, 0x48, 0x41, 0x4e, 0x44, 0x53, 0x48, 0x41, 0x4b, 0x45, 0x5f, 0x41, 0x43, 0x4b,
+	0x10, 0x03, 0x12, 0x11, 0x0a, 0x0d, 0x4b, 0x49, 0x4e, 0x44, 0x5f, 0x57, 0x49, 0x54, 0x48, 0x44,
+	0x52, 0x41, 0x57, 0x10, 0x04, 0x12, 0x15, 0x0a, 0x11, 0x4b, 0x49, 0x4e, 0x44, 0x5f, 0x57, 0x49,
+	0x54, 0x48, 0x44, 0x52, 0x41, 0x57, 0x5f, 0x41, 0x43, 0x4b, 0x10, 0x05, 0x22, 0xb5, 0x01, 0x0a,
+	0x07, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x75, 0x75, 0x69, 0x64,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x75, 0x75, 0x69, 0x64, 0x12, 0x1b, 0x0a, 0x09,
+	0x70, 0x61, 0x72, 0x65, 0x6e, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x08, 0x70, 0x61, 0x72, 0x65, 0x6e, 0x74, 0x49, 0x64, 0x12, 0x19, 0x0a, 0x08, 0x72, 0x65, 0x70,
+	0x6c, 0x79, 0x5f, 0x74, 0x6f, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x72, 0x65, 0x70,
+	0x6c, 0x79, 0x54, 0x6f, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65,
+	0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x74, 0x69, 0x6d,
+	0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x06,
+	0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x12, 0x18, 0x0a, 0x07, 0x62, 0x72,
+	0x69, 0x64, 0x67, 0x65, 0x73, 0x18, 0x07, 0x20, 0x03, 0x28, 0x09, 0x52, 0x07, 0x62, 0x72, 0x69,
+	0x64, 0x67, 0x65, 0x73, 0x32, 0x43, 0x0a, 0x04, 0x4d, 0x65, 0x73, 0x68, 0x12, 0x3b, 0x0a, 0x07,
+	0x43, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x12, 0x15, 0x2e, 0x67, 0x72, 0x61, 0x76, 0x2e, 0x74,
+	0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x2e, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x1a, 0x15,
+	0x2e, 0x67, 0x72, 0x61, 0x76, 0x2e, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x2e,
+	0x46, 0x72, 0x61, 0x6d, 0x65, 0x28, 0x01, 0x30, 0x01, 0x42, 0x32, 0x5a, 0x30, 0x67, 0x69, 0x74,
+	0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x73, 0x75, 0x62, 0x6f, 0x72, 0x62, 0x69, 0x74,
+	0x61, 0x6c, 0x2f, 0x67, 0x72, 0x61, 0x76, 0x2f, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f, 0x72,
+	0x74, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x2f, 0x6d, 0x65, 0x73, 0x68, 0x70, 0x62, 0x62, 0x06, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_transport_grpc_meshpb_grav_proto_rawDescOnce sync.Once
+	file_transport_grpc_meshpb_grav_proto_rawDescData = file_transport_grpc_meshpb_grav_proto_rawDesc
+)
+
+func file_transport_grpc_meshpb_grav_proto_rawDescGZIP() []byte {
+	file_transport_grpc_meshpb_grav_proto_rawDescOnce.Do(func() {
+		file_transport_grpc_meshpb_grav_proto_rawDescData = protoimpl.X.CompressGZIP(file_transport_grpc_meshpb_grav_proto_rawDescData)
+	})
+	return file_transport_grpc_meshpb_grav_proto_rawDescData
+}
+
+var file_transport_grpc_meshpb_grav_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_transport_grpc_meshpb_grav_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_transport_grpc_meshpb_grav_proto_goTypes = []interface{}{
+	(Frame_Kind)(0), // 0: grav.transport.Frame.Kind
+	(*Frame)(nil),   // 1: grav.transport.Frame
+	(*Message)(nil), // 2: grav.transport.Message
+}
+var file_transport_grpc_meshpb_grav_proto_depIdxs = []int32{
+	0, // 0: grav.transport.Frame.kind:type_name -> grav.transport.Frame.Kind
+	2, // 1: grav.transport.Frame.message:type_name -> grav.transport.Message
+	1, // 2: grav.transport.Mesh.Connect:input_type -> grav.transport.Frame
+	1, // 3: grav.transport.Mesh.Connect:output_type -> grav.transport.Frame
+	3, // [3:4] is the sub-list for method output_type
+	2, // [2:3] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_transport_grpc_meshpb_grav_proto_init() }
+func file_transport_grpc_meshpb_grav_proto_init() {
+	if File_transport_grpc_meshpb_grav_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_transport_grpc_meshpb_grav_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Frame); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_transport_grpc_meshpb_grav_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Message); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_transport_grpc_meshpb_grav_proto_rawDesc,
+			NumEnums:      1,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_transport_grpc_meshpb_grav_proto_goTypes,
+		DependencyIndexes: file_transport_grpc_meshpb_grav_proto_depIdxs,
+		EnumInfos:         file_transport_grpc_meshpb_grav_proto_enumTypes,
+		MessageInfos:      file_transport_grpc_meshpb_grav_proto_msgTypes,
+	}.Build()
+	File_transport_grpc_meshpb_grav_proto = out.File
+	file_transport_grpc_meshpb_grav_proto_rawDesc = nil
+	file_transport_grpc_meshpb_grav_proto_goTypes = nil
+	file_transport_grpc_meshpb_grav_proto_depIdxs = nil
+}
@@ -0,0 +1,137 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: transport/grpc/meshpb/grav.proto
+
+package meshpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// MeshClient is the client API for Mesh service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MeshClient interface {
+	Connect(ctx context.Context, opts ...grpc.CallOption) (Mesh_ConnectClient, error)
+}
+
+type meshClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMeshClient(cc grpc.ClientConnInterface) MeshClient {
+	return &meshClient{cc}
+}
+
+func (c *meshClient) Connect(ctx context.Context, opts ...grpc.CallOption) (Mesh_ConnectClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Mesh_ServiceDesc.Streams[0], "/grav.transport.Mesh/Connect", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &meshConnectClient{stream}
+	return x, nil
+}
+
+type Mesh_ConnectClient interface {
+	Send(*Frame) error
+	Recv() (*Frame, error)
+	grpc.ClientStream
+}
+
+type meshConnectClient struct {
+	grpc.ClientStream
+}
+
+func (x *meshConnectClient) Send(m *Frame) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *meshConnectClient) Recv() (*Frame, error) {
+	m := new(Frame)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MeshServer is the server API for Mesh service.
+// All implementations must embed UnimplementedMeshServer
+// for forward compatibility
+type MeshServer interface {
+	Connect(Mesh_ConnectServer) error
+	mustEmbedUnimplementedMeshServer()
+}
+
+// UnimplementedMeshServer must be embedded to have forward compatible implementations.
+type UnimplementedMeshServer struct {
+}
+
+func (UnimplementedMeshServer) Connect(Mesh_ConnectServer) error {
+	return status.Errorf(codes.Unimplemented, "method Connect not implemented")
+}
+func (UnimplementedMeshServer) mustEmbedUnimplementedMeshServer() {}
+
+// UnsafeMeshServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MeshServer will
+// result in compilation errors.
+type UnsafeMeshServer interface {
+	mustEmbedUnimplementedMeshServer()
+}
+
+func RegisterMeshServer(s grpc.ServiceRegistrar, srv MeshServer) {
+	s.RegisterService(&Mesh_ServiceDesc, srv)
+}
+
+func _Mesh_Connect_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MeshServer).Connect(&meshConnectServer{stream})
+}
+
+type Mesh_ConnectServer interface {
+	Send(*Frame) error
+	Recv() (*Frame, error)
+	grpc.ServerStream
+}
+
+type meshConnectServer struct {
+	grpc.ServerStream
+}
+
+func (x *meshConnectServer) Send(m *Frame) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *meshConnectServer) Recv() (*Frame, error) {
+	m := new(Frame)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Mesh_ServiceDesc is the grpc.ServiceDesc for Mesh service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Mesh_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "grav.transport.Mesh",
+	HandlerType: (*MeshServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Connect",
+			Handler:       _Mesh_Connect_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "transport/grpc/meshpb/grav.proto",
+}
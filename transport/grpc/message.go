@@ -0,0 +1,39 @@
+package grpc
+
+import (
+	"time"
+
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/grav/transport/grpc/meshpb"
+)
+
+// encodeMsg converts a Message to its protobuf form, omitting a zero timestamp
+func encodeMsg(msg grav.Message) *meshpb.Message {
+	m := &meshpb.Message{
+		Uuid:     msg.UUID(),
+		ParentId: msg.ParentID(),
+		ReplyTo:  msg.ReplyTo(),
+		Type:     msg.Type(),
+		Data:     msg.Data(),
+		Bridges:  grav.MsgBridges(msg),
+	}
+
+	if ts := msg.Timestamp(); !ts.IsZero() {
+		m.Timestamp = ts.UnixNano()
+	}
+
+	return m
+}
+
+// decodeMsg converts a Message from its protobuf form, preserving its UUID, timestamp and other metadata
+func decodeMsg(m *meshpb.Message) grav.Message {
+	var timestamp time.Time
+	if m.Timestamp != 0 {
+		timestamp = time.Unix(0, m.Timestamp)
+	}
+
+	msg := grav.MsgFromParts(m.Uuid, m.ParentId, m.ReplyTo, m.Type, timestamp, m.Data)
+	grav.SetMsgBridges(msg, m.Bridges)
+
+	return msg
+}
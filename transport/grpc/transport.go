@@ -0,0 +1,182 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/grav/transport/grpc/meshpb"
+	"github.com/suborbital/vektor/vlog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// Transport is a transport that connects Grav nodes via bidirectional gRPC streams
+type Transport struct {
+	opts *grav.MeshOptions
+	log  *vlog.Logger
+
+	standalone bool
+	server     *grpc.Server
+
+	connectionFunc grav.ConnectFunc
+}
+
+// meshService implements the Mesh service in grav.proto for the transport, whose own Connect method dials peers
+type meshService struct {
+	meshpb.UnimplementedMeshServer
+
+	transport *Transport
+}
+
+// Connect handles an incoming stream
+func (m *meshService) Connect(stream meshpb.Mesh_ConnectServer) error {
+	return m.transport.connect(stream)
+}
+
+// New creates a new gRPC transport. Its service must be registered on a gRPC server using Register.
+func New() *Transport {
+	t := &Transport{}
+
+	return t
+}
+
+// NewStandalone creates a new gRPC transport that runs its own gRPC server on the Port of the Grav instance,
+// rather than requiring the service to be registered on an existing server. The server uses the instance's
+// TLS options if set, and is stopped when Grav is stopped.
+func NewStandalone() *Transport {
+	t := &Transport{standalone: true}
+
+	return t
+}
+
+// Setup sets up the transport
+func (t *Transport) Setup(opts *grav.MeshOptions, connFunc grav.ConnectFunc) error {
+	t.opts = opts
+	t.log = opts.Logger
+	t.connectionFunc = connFunc
+
+	// if the transport is not standalone, the service must be registered by the caller
+	if t.standalone {
+		if err := t.serve(); err != nil {
+			return errors.Wrap(err, "[transport-grpc] failed to serve")
+		}
+	}
+
+	return nil
+}
+
+// Register registers the transport's Mesh service on a gRPC server, such as one shared with other services.
+// The server should be configured with transport credentials matching the Grav instance's TLS options.
+func (t *Transport) Register(server grpc.ServiceRegistrar) {
+	meshpb.RegisterMeshServer(server, &meshService{transport: t})
+}
+
+// serve starts the standalone server in the background
+func (t *Transport) serve() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", t.opts.Port))
+	if err != nil {
+		return errors.Wrap(err, "failed to Listen")
+	}
+
+	serverOpts := []grpc.ServerOption{}
+	if t.opts.TLS != nil && t.opts.TLS.Config != nil {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(t.opts.TLS.Config.Clone())))
+	}
+
+	t.server = grpc.NewServer(serverOpts...)
+	t.Register(t.server)
+
+	t.log.Debug("[transport-grpc] serving on", listener.Addr().String())
+
+	go func() {
+		if err := t.server.Serve(listener); err != nil {
+			t.log.Error(errors.Wrap(err, "[transport-grpc] standalone server failed"))
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops the standalone server, if one is running
+func (t *Transport) Stop() error {
+	if t.server == nil {
+		return nil
+	}
+
+	// mesh streams never end on their own, so waiting for them with GracefulStop would block forever
+	t.server.Stop()
+
+	return nil
+}
+
+// Connect opens a stream to a gRPC endpoint in the form host:port
+func (t *Transport) Connect(endpoint string) (grav.Connection, error) {
+	address := strings.TrimPrefix(endpoint, "grpc://")
+
+	// discovery plugins may advertise a path along with the address, which is meaningless for gRPC
+	if idx := strings.Index(address, "/"); idx >= 0 {
+		address = address[:idx]
+	}
+
+	creds := insecure.NewCredentials()
+	if t.opts.TLS != nil && t.opts.TLS.Config != nil {
+		creds = credentials.NewTLS(t.opts.TLS.Config.Clone())
+	}
+
+	cc, err := grpc.Dial(address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, errors.Wrap(err, "[transport-grpc] failed to Dial endpoint")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s, err := meshpb.NewMeshClient(cc).Connect(ctx)
+	if err != nil {
+		cancel()
+		cc.Close()
+
+		return nil, errors.Wrap(err, "[transport-grpc] failed to Connect stream")
+	}
+
+	conn := newConn(s, t.log, t.opts.TLS)
+	conn.closeFunc = func() {
+		s.CloseSend()
+		cancel()
+		cc.Close()
+	}
+
+	return conn, nil
+}
+
+// connect handles an incoming stream, which lives until the connection is closed
+func (t *Transport) connect(stream meshpb.Mesh_ConnectServer) error {
+	if t.connectionFunc == nil {
+		t.log.ErrorString("[transport-grpc] incoming connection received, but no connFunc configured")
+		return status.Error(codes.Unavailable, "mesh transport is not set up")
+	}
+
+	conn := newConn(stream, t.log, t.opts.TLS)
+
+	if t.opts.TLS != nil && conn.tlsState() == nil {
+		t.log.ErrorString("[transport-grpc] TLS is configured, rejecting incoming plaintext connection")
+		return status.Error(codes.PermissionDenied, "TLS is required")
+	}
+
+	t.log.Debug("[transport-grpc] accepted stream")
+
+	t.connectionFunc(conn)
+
+	select {
+	case <-conn.done:
+	case <-stream.Context().Done():
+	}
+
+	return nil
+}
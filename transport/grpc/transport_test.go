@@ -0,0 +1,267 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/grav/testutil"
+	"github.com/suborbital/grav/testutil/gravtest"
+	"github.com/suborbital/grav/transport/grpc/meshpb"
+	"github.com/suborbital/vektor/vlog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMsgRoundTrip(t *testing.T) {
+	msg := grav.NewMsgWithParentID("grpc.test", "parent", []byte("hello"))
+	msg.SetReplyTo("original")
+	grav.SetMsgBridges(msg, []string{"events"})
+
+	encoded, err := proto.Marshal(&meshpb.Frame{Kind: meshpb.Frame_KIND_MESSAGE, Message: encodeMsg(msg)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &meshpb.Frame{}
+	if err := proto.Unmarshal(encoded, decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.Kind != meshpb.Frame_KIND_MESSAGE {
+		t.Fatalf("expected message frame, got kind %s", decoded.Kind)
+	}
+
+	got := decodeMsg(decoded.Message)
+	if got.UUID() != msg.UUID() || got.ParentID() != "parent" || got.ReplyTo() != "original" || got.Type() != "grpc.test" {
+		t.Errorf("message metadata was not preserved: %+v", got)
+	}
+
+	if !got.Timestamp().Equal(msg.Timestamp()) {
+		t.Errorf("expected timestamp %s, got %s", msg.Timestamp(), got.Timestamp())
+	}
+
+	if string(got.Data()) != "hello" {
+		t.Errorf("expected hello, got %s", string(got.Data()))
+	}
+
+	if bridges := grav.MsgBridges(got); len(bridges) != 1 || bridges[0] != "events" {
+		t.Errorf("expected bridges [events], got %v", bridges)
+	}
+
+	if err := proto.Unmarshal([]byte{0x0a, 0xff}, &meshpb.Frame{}); err == nil {
+		t.Error("expected malformed frame to fail to decode")
+	}
+}
+
+func TestGeneratedClient(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport := New()
+
+	server := grpc.NewServer()
+	transport.Register(server)
+
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	g := grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseMeshTransport(transport),
+	)
+
+	cc, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer cc.Close()
+
+	// a peer using code generated from grav.proto and the standard codec, as one written in another language would
+	stream, err := meshpb.NewMeshClient(cc).Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handshakeJSON, err := json.Marshal(grav.TransportHandshake{UUID: "peer", BelongsTo: g.BelongsTo, Version: grav.ProtocolVersion})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stream.Send(&meshpb.Frame{Kind: meshpb.Frame_KIND_HANDSHAKE, Payload: handshakeJSON}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ack := grav.TransportHandshakeAck{}
+	if err := json.Unmarshal(f.Payload, &ack); err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Kind != meshpb.Frame_KIND_HANDSHAKE_ACK || !ack.Accept {
+		t.Fatalf("expected handshake to be accepted, got %s %+v", f.Kind, ack)
+	}
+
+	received := gravtest.Receiver(g.Connect())
+
+	msg := grav.NewMsg(grav.MsgTypeDefault, []byte("hello from another language"))
+	if err := stream.Send(&meshpb.Frame{Kind: meshpb.Frame_KIND_MESSAGE, Message: encodeMsg(msg)}); err != nil {
+		t.Fatal(err)
+	}
+
+	gravtest.ReceiveOne(t, received, "hello from another language")
+}
+
+func TestRegisteredTransport(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transportB := New()
+
+	// the transport shares a server with other services, just like HTTPHandlerFunc shares a router
+	server := grpc.NewServer()
+	transportB.Register(server)
+
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	gA := grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseMeshTransport(New()),
+	)
+
+	gB := grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseMeshTransport(transportB),
+	)
+
+	podA := gA.Connect()
+	receivedA := gravtest.Receiver(podA)
+	podB := gB.Connect()
+	receivedB := gravtest.Receiver(podB)
+
+	if err := gA.ConnectEndpoint(listener.Addr().String()); err != nil {
+		t.Fatalf("expected connection to succeed, got %s", err)
+	}
+
+	sent := grav.NewMsgWithParentID(grav.MsgTypeDefault, "parent", []byte("hello from A"))
+	podA.Send(sent)
+
+	if msg := gravtest.ReceiveOne(t, receivedB, "hello from A"); msg != nil && (msg.UUID() != sent.UUID() || msg.ParentID() != "parent") {
+		t.Error("expected message metadata to be preserved across the stream")
+	}
+
+	podB.Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello from B")))
+	gravtest.ReceiveOne(t, receivedA, "hello from B")
+}
+
+func TestStandalone(t *testing.T) {
+	portB := testutil.FreePort(t)
+
+	gA := grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseMeshTransport(New()),
+	)
+
+	gB := grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseMeshTransport(NewStandalone()),
+		grav.UseEndpoint(portB, ""),
+	)
+
+	receivedB := gravtest.Receiver(gB.Connect())
+
+	endpointB := fmt.Sprintf("127.0.0.1:%s", portB)
+
+	// the server starts in the background, so give it a moment to begin listening
+	var err error
+	for i := 0; i < 10; i++ {
+		if err = gA.ConnectEndpoint(endpointB); err == nil {
+			break
+		}
+
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	if err != nil {
+		t.Fatalf("expected connection to succeed, got %s", err)
+	}
+
+	gA.Connect().Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello, standalone")))
+	gravtest.ReceiveOne(t, receivedB, "hello, standalone")
+
+	if err := gB.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gA.ConnectEndpoint(endpointB); err == nil {
+		t.Error("expected connection to a stopped server to fail")
+	}
+}
+
+// newTLSNode creates a Grav instance whose standalone server requires TLS and returns it along with its endpoint
+func newTLSNode(t *testing.T, nodeUUID string, cfg *tls.Config) (*grav.Grav, string) {
+	port := testutil.FreePort(t)
+
+	g := grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseNodeUUID(nodeUUID),
+		grav.UseMeshTransport(NewStandalone()),
+		grav.UseEndpoint(port, ""),
+		grav.UseTLS(&grav.TLSOptions{Config: cfg, VerifyPeerUUID: true}),
+	)
+
+	t.Cleanup(func() { g.Stop() })
+
+	return g, fmt.Sprintf("127.0.0.1:%s", port)
+}
+
+func TestTLSIdentityMismatch(t *testing.T) {
+	ca := testutil.NewCA(t)
+
+	// one of the nodes presents a valid certificate, but it was issued for a different node
+	for _, mismatched := range []string{"dialing", "accepting"} {
+		t.Run(mismatched, func(t *testing.T) {
+			uuidA, uuidB := uuid.New().String(), uuid.New().String()
+
+			certA, certB := ca.Issue(t, uuidA), ca.Issue(t, uuidB)
+			if mismatched == "dialing" {
+				certA = ca.Issue(t, uuid.New().String())
+			} else {
+				certB = ca.Issue(t, uuid.New().String())
+			}
+
+			gA, _ := newTLSNode(t, uuidA, ca.Config(certA))
+			_, endpointB := newTLSNode(t, uuidB, ca.Config(certB))
+
+			// the server starts in the background, so connecting is retried until the handshake is reached
+			var err error
+			for i := 0; i < 10; i++ {
+				if err = gA.ConnectEndpoint(endpointB); errors.Is(err, grav.ErrPeerIdentityMismatch) {
+					return
+				}
+
+				time.Sleep(time.Millisecond * 100)
+			}
+
+			t.Errorf("expected ErrPeerIdentityMismatch, got %v", err)
+		})
+	}
+}
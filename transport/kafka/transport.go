@@ -2,39 +2,120 @@ package kafka
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/suborbital/grav/grav"
 	"github.com/suborbital/vektor/vlog"
+	"github.com/twmb/franz-go/pkg/kerr"
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
+const (
+	// closeTimeout is how long closing a connection waits to flush buffered records and commit offsets
+	closeTimeout = time.Second * 10
+
+	// defaultProduceTimeout is used when Options.ProduceTimeout is not set
+	defaultProduceTimeout = time.Second * 10
+
+	// defaultDeliveryTimeout is used when Options.DeliveryTimeout is not set
+	defaultDeliveryTimeout = time.Second * 10
+)
+
+// ErrProduceFailed is returned from the bridge's handler when a message could not be produced
+var ErrProduceFailed = errors.New("failed to produce message")
+
+// Options are the options for a Kafka transport
+type Options struct {
+	// Group is the consumer group that the transport joins. Offsets are committed once records have been handled,
+	// so consumption resumes where it left off. When empty, every node consumes every record.
+	Group string
+	// StartOffset is where consumption begins when the group has no committed offset (or when there is no group).
+	// Defaults to the end of each partition, so only new records are received.
+	StartOffset *kgo.Offset
+	// Key extracts the key of the record produced for a message, giving messages with the same key partition affinity.
+	// Defaults to no key, such that records are spread across partitions.
+	Key func(grav.Message) []byte
+	// Linger is how long produced records wait to be batched with others. Defaults to 0 (no lingering).
+	Linger time.Duration
+	// ProduceTimeout is how long producing a message waits for the broker to acknowledge it before the message
+	// is treated as failed and replayed by Grav. Defaults to 10s.
+	ProduceTimeout time.Duration
+	// DeliveryTimeout is how long a record waits for a pod to handle it before its offset is committed anyway, so that
+	// records no pod consumes (such as those only relayed to the mesh) don't hold back the partition. Defaults to 10s.
+	DeliveryTimeout time.Duration
+}
+
 // Transport is a transport that connects Grav nodes via kafka
 type Transport struct {
 	opts *grav.BridgeOptions
 	log  *vlog.Logger
 
-	endpoint string
+	endpoint  string
+	kafkaOpts Options
 }
 
 // Conn implements transport.TopicConnection and represents a subscribe/send pair for a Kafka topic
 type Conn struct {
-	topic string
-	log   *vlog.Logger
-	pod   *grav.Pod
+	topic     string
+	mapping   grav.TopicMapping
+	opts      *grav.BridgeOptions
+	kafkaOpts Options
+	log       *vlog.Logger
+	pod       *grav.Pod
 
 	conn *kgo.Client
+
+	// pending holds the records of each partition that have been received but not yet committed, in order
+	pending     map[int32][]*pendingRecord
+	pendingLock sync.Mutex
+}
+
+// pendingRecord is a record that is waiting to be handled before its offset can be committed
+type pendingRecord struct {
+	record  *kgo.Record
+	handled bool
 }
 
 // New creates a new Kafka transport
 func New(endpoint string) (*Transport, error) {
+	return NewWithOptions(endpoint, Options{})
+}
+
+// NewWithOptions creates a new Kafka transport with the provided options
+func NewWithOptions(endpoint string, kafkaOpts Options) (*Transport, error) {
+	if kafkaOpts.ProduceTimeout == 0 {
+		kafkaOpts.ProduceTimeout = defaultProduceTimeout
+	}
+
+	if kafkaOpts.DeliveryTimeout == 0 {
+		kafkaOpts.DeliveryTimeout = defaultDeliveryTimeout
+	}
+
 	t := &Transport{}
 
 	t.endpoint = endpoint
+	t.kafkaOpts = kafkaOpts
 
 	return t, nil
 }
 
+// KeyByParentID is a key extractor that gives messages with the same parent ID (such as those belonging to the same
+// request) partition affinity, and therefore ordering. Messages without a parent ID are produced without a key.
+func KeyByParentID(msg grav.Message) []byte {
+	if msg.ParentID() == "" {
+		return nil
+	}
+
+	return []byte(msg.ParentID())
+}
+
+// KeyByType is a key extractor that produces all messages of the same type to the same partition
+func KeyByType(msg grav.Message) []byte {
+	return []byte(msg.Type())
+}
+
 // Setup sets up the transport
 func (t *Transport) Setup(opts *grav.BridgeOptions) error {
 	t.opts = opts
@@ -45,49 +126,51 @@ func (t *Transport) Setup(opts *grav.BridgeOptions) error {
 
 // ConnectTopic connects to a topic if the transport is a bridge
 func (t *Transport) ConnectTopic(topic string) (grav.BridgeConnection, error) {
-	client, err := kgo.NewClient(
-		kgo.SeedBrokers(t.endpoint),
-		kgo.ConsumeTopics(topic),
-		kgo.ConsumeResetOffset(kgo.NewOffset().AtEnd()),
-	)
+	return t.ConnectTopicWithMapping(topic, grav.DefaultTopicMapping(topic))
+}
 
+// ConnectTopicWithMapping connects to a topic using the provided mapping. The mapping's TypeHeader is set as a record header.
+func (t *Transport) ConnectTopicWithMapping(topic string, mapping grav.TopicMapping) (grav.BridgeConnection, error) {
+	client, err := kgo.NewClient(t.kafkaOpts.clientConfig(t.endpoint, topic).opts()...)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to NewClient")
 	}
 
 	conn := &Conn{
-		topic: topic,
-		log:   t.log,
-		conn:  client,
+		topic:     topic,
+		mapping:   mapping,
+		opts:      t.opts,
+		kafkaOpts: t.kafkaOpts,
+		log:       t.log,
+		conn:      client,
+		pending:   map[int32][]*pendingRecord{},
 	}
 
 	return conn, nil
 }
 
-// Start begins the receiving of messages
+// Start begins the receiving of messages. Producing a message waits for the broker to acknowledge it, so an error is returned
+// from the bridge's handler if producing fails, and Grav holds and replays the message until producing recovers. Since the
+// handler is called concurrently for each message, records produced at the same time are still batched together.
+// When consuming as part of a group, a record's offset is committed once a pod has handled it (and every record before it
+// in the partition), and a record that fails to be handled restarts the connection so that it is consumed again.
 func (c *Conn) Start(pod *grav.Pod) {
 	c.pod = pod
 
-	c.pod.OnType(c.topic, func(msg grav.Message) error {
-		msgBytes, err := msg.Marshal()
-		if err != nil {
-			return errors.Wrap(err, "failed to Marshal message")
-		}
-
-		record := &kgo.Record{Topic: c.topic, Value: msgBytes}
-		if err := c.conn.ProduceSync(context.Background(), record).FirstErr(); err != nil {
-			return errors.Wrap(err, "failed to ProduceSync")
-		}
-
-		return nil
-	})
+	c.pod.On(c.mapping.Filter(c.produce))
 
 	go func() {
 		for {
 			fetches := c.conn.PollFetches(context.Background())
-			if errs := fetches.Errors(); len(errs) > 0 {
-				c.log.Error(errors.Wrap(errs[0].Err, "failed to PollFetches"))
-				continue
+			if fetches.IsClientClosed() {
+				return
+			}
+
+			if err := c.checkFetchErrs(fetches.Errors()); err != nil {
+				c.log.Error(errors.Wrap(err, "[bridge-kafka] failed to PollFetches, reporting failure"))
+				c.opts.Failed(c, err)
+
+				return
 			}
 
 			iter := fetches.RecordIter()
@@ -96,23 +179,231 @@ func (c *Conn) Start(pod *grav.Pod) {
 
 				c.log.Debug("[bridge-kafka] recieved message via", c.topic)
 
-				msg, err := grav.MsgFromBytes(record.Value)
-				if err != nil {
-					c.log.Debug(errors.Wrap(err, "[bridge-kafka] failed to MsgFromBytes, falling back to raw data").Error())
-
-					msg = grav.NewMsg(c.topic, record.Value)
-				}
-
-				// send to the Grav instance
-				c.pod.Send(msg)
+				c.handleRecord(record)
 			}
 		}
 	}()
 }
 
-// Close closes the underlying connection
+// produce produces a record for a message and waits for the broker to acknowledge it
+func (c *Conn) produce(msg grav.Message) error {
+	msgBytes, err := msg.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "failed to Marshal message")
+	}
+
+	msgBytes, err = c.opts.Seal(msgBytes)
+	if err != nil {
+		return errors.Wrap(err, "failed to Seal message")
+	}
+
+	record := &kgo.Record{Topic: c.topic, Value: msgBytes}
+	if c.kafkaOpts.Key != nil {
+		record.Key = c.kafkaOpts.Key(msg)
+	}
+
+	if c.mapping.TypeHeader != "" {
+		record.Headers = []kgo.RecordHeader{{Key: c.mapping.TypeHeader, Value: []byte(msg.Type())}}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.kafkaOpts.ProduceTimeout)
+	defer cancel()
+
+	errChan := make(chan error, 1)
+
+	// the record is buffered and batched with any others being produced, and the promise is called once the broker
+	// has acknowledged it or producing it has failed (including when the context is cancelled)
+	c.conn.Produce(ctx, record, func(_ *kgo.Record, err error) {
+		errChan <- err
+	})
+
+	if err := <-errChan; err != nil {
+		return errors.Wrap(ErrProduceFailed, err.Error())
+	}
+
+	return nil
+}
+
+// Close flushes any buffered records, commits the offsets of handled records and closes the underlying connection
 func (c *Conn) Close() {
 	c.log.Debug("[bridge-kafka] connection for", c.topic, "is closing")
 
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+
+	if err := c.conn.Flush(ctx); err != nil {
+		c.log.Error(errors.Wrapf(err, "[bridge-kafka] connection for %s failed to Flush", c.topic))
+	}
+
+	if c.kafkaOpts.Group != "" {
+		// only the offsets of records that have been handled are committed, so the rest are consumed again
+		if err := c.conn.CommitMarkedOffsets(ctx); err != nil {
+			c.log.Error(errors.Wrapf(err, "[bridge-kafka] connection for %s failed to CommitMarkedOffsets", c.topic))
+		}
+	}
+
 	c.conn.Close()
 }
+
+// handleRecord sends a record to the Grav instance
+func (c *Conn) handleRecord(record *kgo.Record) {
+	pending := c.track(record)
+
+	data, err := c.opts.Open(record.Value)
+	if err != nil {
+		// the record is committed since it would fail again if consumed again
+		c.log.Error(errors.Wrap(err, "[bridge-kafka] failed to Open message, discarding"))
+		c.settle(pending, nil)
+
+		return
+	}
+
+	msg, err := grav.MsgFromBytes(data)
+	if err != nil {
+		c.log.Debug(errors.Wrap(err, "[bridge-kafka] failed to MsgFromBytes, falling back to raw data").Error())
+
+		msg = grav.NewMsg(c.mapping.MsgType(c.typeHeader(record), c.topic), data)
+	}
+
+	settle := sync.Once{}
+
+	grav.TrackDelivery(msg, c.kafkaOpts.DeliveryTimeout, func(err error) {
+		settle.Do(func() { c.settle(pending, err) })
+	})
+
+	// send to the Grav instance
+	if receipt := c.pod.Send(msg); receipt == nil {
+		settle.Do(func() { c.settle(pending, grav.ErrConnectionClosed) })
+	}
+}
+
+// track adds a record to those pending in its partition. Records are only tracked when consuming as part of a group.
+func (c *Conn) track(record *kgo.Record) *pendingRecord {
+	pending := &pendingRecord{record: record}
+
+	if c.kafkaOpts.Group == "" {
+		return pending
+	}
+
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+
+	c.pending[record.Partition] = append(c.pending[record.Partition], pending)
+
+	return pending
+}
+
+// settle marks a record that was handled (or that no pod handled within the delivery timeout) for commit along with those
+// before it in its partition. If handling it failed, the connection is reported as failed without committing the record,
+// so that the group resumes consuming from it when the topic is reconnected.
+func (c *Conn) settle(pending *pendingRecord, err error) {
+	if c.kafkaOpts.Group == "" {
+		if err != nil && err != grav.ErrDeliveryTimeout {
+			c.log.Debug("[bridge-kafka] failed to handle message via", c.topic+":", err.Error())
+		}
+
+		return
+	}
+
+	if err != nil && err != grav.ErrDeliveryTimeout {
+		c.log.Debug("[bridge-kafka] failed to handle message via", c.topic, "reconnecting to consume it again:", err.Error())
+		c.opts.Failed(c, errors.Wrap(err, "failed to handle message"))
+
+		return
+	}
+
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+
+	pending.handled = true
+
+	// offsets are committed in order, so only the records up to the first that is still being handled are marked
+	partition := pending.record.Partition
+	records := c.pending[partition]
+
+	var handled []*kgo.Record
+	for len(records) > 0 && records[0].handled {
+		handled = append(handled, records[0].record)
+		records = records[1:]
+	}
+
+	c.pending[partition] = records
+
+	if len(handled) > 0 {
+		c.conn.MarkCommitRecords(handled...)
+	}
+}
+
+// typeHeader returns the value of the mapping's type header from a record, if any
+func (c *Conn) typeHeader(record *kgo.Record) string {
+	if c.mapping.TypeHeader == "" {
+		return ""
+	}
+
+	for _, header := range record.Headers {
+		if header.Key == c.mapping.TypeHeader {
+			return string(header.Value)
+		}
+	}
+
+	return ""
+}
+
+// checkFetchErrs logs the errors returned from polling, and returns the first that requires the connection to be restarted.
+// Kafka errors are returned, while data loss (which the client recovers from) and batch parsing errors are only logged.
+func (c *Conn) checkFetchErrs(fetchErrs []kgo.FetchError) error {
+	for _, fetchErr := range fetchErrs {
+		var kafkaErr *kerr.Error
+		if errors.As(fetchErr.Err, &kafkaErr) {
+			return fetchErr.Err
+		}
+
+		c.log.Error(errors.Wrapf(fetchErr.Err, "[bridge-kafka] fetch from %s partition %d failed", fetchErr.Topic, fetchErr.Partition))
+	}
+
+	return nil
+}
+
+// clientConfig is the configuration of a client that consumes and produces a topic
+type clientConfig struct {
+	seedBroker  string
+	topic       string
+	startOffset kgo.Offset
+	linger      time.Duration
+	group       string
+}
+
+// clientConfig returns the configuration of a client that consumes and produces a topic
+func (o Options) clientConfig(endpoint, topic string) clientConfig {
+	startOffset := kgo.NewOffset().AtEnd()
+	if o.StartOffset != nil {
+		startOffset = *o.StartOffset
+	}
+
+	c := clientConfig{
+		seedBroker:  endpoint,
+		topic:       topic,
+		startOffset: startOffset,
+		linger:      o.Linger,
+		group:       o.Group,
+	}
+
+	return c
+}
+
+// opts returns the options used to create the client
+func (c clientConfig) opts() []kgo.Opt {
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(c.seedBroker),
+		kgo.ConsumeTopics(c.topic),
+		kgo.ConsumeResetOffset(c.startOffset),
+		kgo.ProducerLinger(c.linger),
+	}
+
+	if c.group != "" {
+		// offsets are only committed for records that have been handled by the Grav instance
+		opts = append(opts, kgo.ConsumerGroup(c.group), kgo.AutoCommitMarks())
+	}
+
+	return opts
+}
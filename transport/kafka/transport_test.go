@@ -0,0 +1,274 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/grav/testutil/gravtest"
+	"github.com/suborbital/vektor/vlog"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestKeyExtractors(t *testing.T) {
+	msg := grav.NewMsgWithParentID("orders.created", "request-1", []byte("{}"))
+
+	if key := KeyByParentID(msg); string(key) != "request-1" {
+		t.Errorf("expected request-1, got %s", string(key))
+	}
+
+	if key := KeyByParentID(grav.NewMsg("orders.created", nil)); key != nil {
+		t.Errorf("expected no key for a message without a parent ID, got %s", string(key))
+	}
+
+	if key := KeyByType(msg); string(key) != "orders.created" {
+		t.Errorf("expected orders.created, got %s", string(key))
+	}
+}
+
+func TestProduce(t *testing.T) {
+	cluster := newCluster(t, "orders")
+
+	transportA, err := New(cluster.ListenAddrs()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gA := gravtest.BridgeNode(t, transportA, "orders")
+
+	msg := grav.NewMsg("orders", []byte("hello over kafka"))
+	gA.Connect().Send(msg)
+
+	// the message is produced as a record, which a client reading the topic from the start receives
+	client := newClient(t, cluster, kgo.ConsumeTopics("orders"), kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()))
+
+	records := poll(t, client, 1)
+
+	received, err := grav.MsgFromBytes(records[0].Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if received.UUID() != msg.UUID() || string(received.Data()) != "hello over kafka" {
+		t.Errorf("expected %s 'hello over kafka', got %s '%s'", msg.UUID(), received.UUID(), string(received.Data()))
+	}
+}
+
+func TestStartOffset(t *testing.T) {
+	cluster := newCluster(t, "orders")
+	produce(t, cluster, "orders", "first", "second")
+
+	start := kgo.NewOffset().At(1)
+
+	transport, err := NewWithOptions(cluster.ListenAddrs()[0], Options{StartOffset: &start})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := gravtest.BridgeNode(t, transport, "orders")
+	received := gravtest.Receiver(g.Connect())
+
+	// records before the start offset are not consumed
+	gravtest.ReceiveOne(t, received, "second")
+
+	select {
+	case msg := <-received:
+		t.Errorf("expected no more messages, got %s", string(msg.Data()))
+	case <-time.After(time.Millisecond * 500):
+	}
+}
+
+func TestGroupResume(t *testing.T) {
+	cluster := newCluster(t, "orders")
+	produce(t, cluster, "orders", "first", "second")
+
+	start := kgo.NewOffset().AtStart()
+	opts := Options{Group: "billing", StartOffset: &start}
+
+	transportA, err := NewWithOptions(cluster.ListenAddrs()[0], opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gA := gravtest.BridgeNode(t, transportA, "orders")
+
+	received := make(chan grav.Message, 10)
+	failed := false
+	lock := sync.Mutex{}
+
+	// the second record fails to be handled the first time, so the connection is restarted and it is consumed again
+	gA.Connect().On(func(msg grav.Message) error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		received <- msg
+
+		if string(msg.Data()) == "second" && !failed {
+			failed = true
+			return errors.New("database unavailable")
+		}
+
+		return nil
+	})
+
+	gravtest.ReceiveAll(t, received, "first", "second")
+
+	// the group resumes from the offset committed for the first record. Since the pod also replays the message that
+	// failed once it handles another, the second record may be received again, but the first is not.
+	gravtest.ReceiveOne(t, received, "second")
+
+	timeout := time.After(time.Millisecond * 500)
+
+	for done := false; !done; {
+		select {
+		case msg := <-received:
+			if string(msg.Data()) != "second" {
+				t.Errorf("expected only second to be received again, got %s", string(msg.Data()))
+			}
+		case <-timeout:
+			done = true
+		}
+	}
+
+	if err := gA.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	produce(t, cluster, "orders", "third")
+
+	// a new member of the group resumes after the records that were handled
+	transportB, err := NewWithOptions(cluster.ListenAddrs()[0], opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gB := gravtest.BridgeNode(t, transportB, "orders")
+	receivedB := gravtest.Receiver(gB.Connect())
+
+	gravtest.ReceiveOne(t, receivedB, "third")
+}
+
+func TestProduceFailed(t *testing.T) {
+	client, err := kgo.NewClient(kgo.SeedBrokers("127.0.0.1:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	c := &Conn{
+		topic:     "orders",
+		opts:      &grav.BridgeOptions{},
+		kafkaOpts: Options{ProduceTimeout: time.Millisecond * 200},
+		conn:      client,
+	}
+
+	// the error is returned for the message that failed, so that Grav replays it
+	if err := c.produce(grav.NewMsg("orders", []byte("{}"))); !errors.Is(err, ErrProduceFailed) {
+		t.Errorf("expected ErrProduceFailed, got %v", err)
+	}
+}
+
+func TestTypeHeader(t *testing.T) {
+	record := &kgo.Record{Headers: []kgo.RecordHeader{{Key: "grav-type", Value: []byte("user.login")}}}
+
+	if msgType := (&Conn{}).typeHeader(record); msgType != "" {
+		t.Errorf("expected no type without a TypeHeader, got %s", msgType)
+	}
+
+	c := &Conn{mapping: grav.TopicMapping{TypeHeader: "grav-type"}}
+
+	if msgType := c.typeHeader(record); msgType != "user.login" {
+		t.Errorf("expected user.login, got %s", msgType)
+	}
+
+	if msgType := c.typeHeader(&kgo.Record{}); msgType != "" {
+		t.Errorf("expected no type for a record without the header, got %s", msgType)
+	}
+}
+
+func TestCheckFetchErrs(t *testing.T) {
+	c := &Conn{log: vlog.Default(vlog.Level(vlog.LogLevelNull))}
+
+	if err := c.checkFetchErrs(nil); err != nil {
+		t.Errorf("expected no error, got %s", err)
+	}
+
+	// data loss is recovered from by the client, so it does not fail the connection
+	dataLoss := kgo.FetchError{Topic: "orders", Err: &kgo.ErrDataLoss{Topic: "orders"}}
+	if err := c.checkFetchErrs([]kgo.FetchError{dataLoss}); err != nil {
+		t.Errorf("expected data loss to be ignored, got %s", err)
+	}
+
+	authFailed := kgo.FetchError{Topic: "orders", Err: kerr.TopicAuthorizationFailed}
+	if err := c.checkFetchErrs([]kgo.FetchError{dataLoss, authFailed}); !errors.Is(err, kerr.TopicAuthorizationFailed) {
+		t.Errorf("expected TopicAuthorizationFailed, got %v", err)
+	}
+}
+
+// newCluster starts a fake Kafka cluster with a single partition for each of the topics
+func newCluster(t *testing.T, topics ...string) *kfake.Cluster {
+	t.Helper()
+
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, topics...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(cluster.Close)
+
+	return cluster
+}
+
+// newClient creates a client connected to the cluster
+func newClient(t *testing.T, cluster *kfake.Cluster, opts ...kgo.Opt) *kgo.Client {
+	t.Helper()
+
+	client, err := kgo.NewClient(append([]kgo.Opt{kgo.SeedBrokers(cluster.ListenAddrs()...)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(client.Close)
+
+	return client
+}
+
+// produce produces a raw record for each of the values
+func produce(t *testing.T, cluster *kfake.Cluster, topic string, values ...string) {
+	t.Helper()
+
+	client := newClient(t, cluster)
+
+	for _, value := range values {
+		if err := client.ProduceSync(context.Background(), &kgo.Record{Topic: topic, Value: []byte(value)}).FirstErr(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// poll polls the client until it has received the expected number of records
+func poll(t *testing.T, client *kgo.Client, expected int) []*kgo.Record {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	records := []*kgo.Record{}
+
+	for len(records) < expected {
+		fetches := client.PollFetches(ctx)
+		if err := ctx.Err(); err != nil {
+			t.Fatalf("timed out waiting for %d records, got %d", expected, len(records))
+		}
+
+		records = append(records, fetches.Records()...)
+	}
+
+	return records
+}
@@ -0,0 +1,157 @@
+package memory
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+// Bridge is a bridge transport that connects Grav instances in the same process to topics on an in-memory Network,
+// behaving like a centralized broker. Messages published to a topic are delivered to every other connection to it.
+type Bridge struct {
+	network *Network
+
+	opts *grav.BridgeOptions
+	log  *vlog.Logger
+}
+
+// BridgeConn implements transport.BridgeConnection and represents a subscription to a topic on the network
+type BridgeConn struct {
+	topic   string
+	mapping grav.TopicMapping
+	network *Network
+	opts    *grav.BridgeOptions
+	log     *vlog.Logger
+	pod     *grav.Pod
+
+	inbox     chan frame
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewBridge creates a new memory bridge transport on the network
+func NewBridge(network *Network) *Bridge {
+	b := &Bridge{
+		network: network,
+	}
+
+	return b
+}
+
+// Setup sets up the bridge transport
+func (b *Bridge) Setup(opts *grav.BridgeOptions) error {
+	b.opts = opts
+	b.log = opts.Logger
+
+	return nil
+}
+
+// ConnectTopic subscribes to a topic on the network
+func (b *Bridge) ConnectTopic(topic string) (grav.BridgeConnection, error) {
+	return b.ConnectTopicWithMapping(topic, grav.DefaultTopicMapping(topic))
+}
+
+// ConnectTopicWithMapping subscribes to a topic on the network using the provided mapping.
+// The network does not carry headers, so the mapping's TypeHeader is ignored.
+func (b *Bridge) ConnectTopicWithMapping(topic string, mapping grav.TopicMapping) (grav.BridgeConnection, error) {
+	conn := &BridgeConn{
+		topic:     topic,
+		mapping:   mapping,
+		network:   b.network,
+		opts:      b.opts,
+		log:       b.log,
+		inbox:     make(chan frame, inboxSize),
+		closed:    make(chan struct{}),
+		closeOnce: sync.Once{},
+	}
+
+	b.network.subscribe(topic, conn)
+
+	return conn, nil
+}
+
+// Start begins the receiving of messages
+func (c *BridgeConn) Start(pod *grav.Pod) {
+	c.pod = pod
+
+	c.pod.On(c.mapping.Filter(func(msg grav.Message) error {
+		msgBytes, err := msg.Marshal()
+		if err != nil {
+			return errors.Wrap(err, "failed to Marshal message")
+		}
+
+		msgBytes, err = c.opts.Seal(msgBytes)
+		if err != nil {
+			return errors.Wrap(err, "failed to Seal message")
+		}
+
+		c.publish(msgBytes)
+
+		return nil
+	}))
+
+	go func() {
+		for {
+			var f frame
+
+			select {
+			case f = <-c.inbox:
+				f.wait(c.closed)
+			case <-c.closed:
+				return
+			}
+
+			c.log.Debug("[bridge-memory] recieved message via", c.topic)
+
+			data, err := c.opts.Open(f.data)
+			if err != nil {
+				c.log.Error(errors.Wrap(err, "[bridge-memory] failed to Open message, discarding"))
+				continue
+			}
+
+			msg, err := grav.MsgFromBytes(data)
+			if err != nil {
+				c.log.Debug(errors.Wrap(err, "[bridge-memory] failed to MsgFromBytes, falling back to raw data").Error())
+
+				msg = grav.NewMsg(c.mapping.MsgType("", c.topic), data)
+			}
+
+			// send to the Grav instance
+			c.pod.Send(msg)
+		}
+	}()
+}
+
+// Close unsubscribes from the topic
+func (c *BridgeConn) Close() {
+	c.log.Debug("[bridge-memory] connection for", c.topic, "is closing")
+
+	c.network.unsubscribe(c.topic, c)
+
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+}
+
+// publish delivers data to every other connection subscribed to the topic
+func (c *BridgeConn) publish(data []byte) {
+	for _, sub := range c.network.subscribers(c.topic, c) {
+		// bridge connections have no address, so only the drop rate applies
+		if c.network.drop("", "") {
+			continue
+		}
+
+		f := frame{
+			kind:      frameMessage,
+			data:      data,
+			deliverAt: c.network.deliverAt(),
+		}
+
+		select {
+		case sub.inbox <- f:
+		case <-sub.closed:
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package memory
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrAddressInUse and others are errors returned by the in-memory network
+var (
+	ErrAddressInUse = errors.New("address is already in use")
+	ErrUnreachable  = errors.New("address is unreachable")
+	ErrTopicFailed  = errors.New("topic subscription failed")
+)
+
+// Network is a shared in-process network that memory transports and bridges use to connect multiple
+// Grav instances to one another. Latency, dropped messages and partitions can be injected to test
+// how the mesh behaves when the network misbehaves. Faults only affect messages; handshakes and
+// withdraws are always delivered (but are subject to latency) so that connections can be established.
+type Network struct {
+	nodes      map[string]*Transport
+	topics     map[string]map[*BridgeConn]bool
+	partitions map[string]map[string]bool
+
+	latency  time.Duration
+	dropRate float64
+	echo     bool
+
+	lock sync.RWMutex
+}
+
+// NewNetwork creates a new in-memory network with no faults
+func NewNetwork() *Network {
+	n := &Network{
+		nodes:      map[string]*Transport{},
+		topics:     map[string]map[*BridgeConn]bool{},
+		partitions: map[string]map[string]bool{},
+		lock:       sync.RWMutex{},
+	}
+
+	return n
+}
+
+// SetLatency sets the delay before each frame sent over the network is delivered
+func (n *Network) SetLatency(latency time.Duration) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.latency = latency
+}
+
+// SetDropRate sets the fraction (between 0 and 1) of messages that are silently dropped
+func (n *Network) SetDropRate(rate float64) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.dropRate = rate
+}
+
+// SetEcho sets whether messages published to a bridge topic are also delivered back to the connection that published them,
+// as brokers such as NATS and Redis do
+func (n *Network) SetEcho(echo bool) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.echo = echo
+}
+
+// Partition severs the link between the two addresses. Messages between them are dropped
+// and new connections between them fail, until the partition is healed.
+func (n *Network) Partition(a, b string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for _, pair := range [][2]string{{a, b}, {b, a}} {
+		if _, exists := n.partitions[pair[0]]; !exists {
+			n.partitions[pair[0]] = map[string]bool{}
+		}
+
+		n.partitions[pair[0]][pair[1]] = true
+	}
+}
+
+// Heal restores the link between the two addresses
+func (n *Network) Heal(a, b string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	delete(n.partitions[a], b)
+	delete(n.partitions[b], a)
+}
+
+// HealAll restores every link in the network
+func (n *Network) HealAll() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.partitions = map[string]map[string]bool{}
+}
+
+// FailTopic drops every subscription to a topic, as a broker might when it restarts. Each bridge connection to the topic
+// reports the failure to its Grav instance, which reconnects to the topic with backoff.
+func (n *Network) FailTopic(topic string) {
+	n.lock.Lock()
+	conns := n.topics[topic]
+	delete(n.topics, topic)
+	n.lock.Unlock()
+
+	for conn := range conns {
+		conn.opts.Failed(conn, ErrTopicFailed)
+	}
+}
+
+// register adds a mesh transport to the network at its address
+func (n *Network) register(t *Transport) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if _, exists := n.nodes[t.address]; exists {
+		return ErrAddressInUse
+	}
+
+	n.nodes[t.address] = t
+
+	return nil
+}
+
+// unregister removes a mesh transport from the network
+func (n *Network) unregister(t *Transport) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.nodes[t.address] == t {
+		delete(n.nodes, t.address)
+	}
+}
+
+// find returns the transport listening at the address, if it is reachable from the other address
+func (n *Network) find(from, address string) (*Transport, error) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	t, exists := n.nodes[address]
+	if !exists || n.partitions[from][address] {
+		return nil, ErrUnreachable
+	}
+
+	return t, nil
+}
+
+// subscribe adds a bridge connection to a topic
+func (n *Network) subscribe(topic string, conn *BridgeConn) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if _, exists := n.topics[topic]; !exists {
+		n.topics[topic] = map[*BridgeConn]bool{}
+	}
+
+	n.topics[topic][conn] = true
+}
+
+// unsubscribe removes a bridge connection from a topic
+func (n *Network) unsubscribe(topic string, conn *BridgeConn) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	delete(n.topics[topic], conn)
+}
+
+// subscribers returns every connection subscribed to the topic, other than the publisher unless echo is enabled
+func (n *Network) subscribers(topic string, publisher *BridgeConn) []*BridgeConn {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	conns := []*BridgeConn{}
+	for conn := range n.topics[topic] {
+		if conn != publisher || n.echo {
+			conns = append(conns, conn)
+		}
+	}
+
+	return conns
+}
+
+// deliverAt returns the time at which a frame sent now should be delivered
+func (n *Network) deliverAt() time.Time {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	return time.Now().Add(n.latency)
+}
+
+// drop returns true if a message sent between the two addresses should be dropped
+func (n *Network) drop(from, to string) bool {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	if n.partitions[from][to] {
+		return true
+	}
+
+	return n.dropRate > 0 && rand.Float64() < n.dropRate
+}
+
+// frame is a unit of data sent over the network
+type frame struct {
+	kind      frameKind
+	data      []byte
+	deliverAt time.Time
+}
+
+type frameKind int
+
+const (
+	frameMessage frameKind = iota
+	frameHandshake
+	frameHandshakeAck
+	frameWithdraw
+	frameWithdrawAck
+)
+
+// wait blocks until the frame is due to be delivered, or the done channel is closed
+func (f frame) wait(done chan struct{}) {
+	delay := time.Until(f.deliverAt)
+	if delay <= 0 {
+		return
+	}
+
+	select {
+	case <-time.After(delay):
+	case <-done:
+	}
+}
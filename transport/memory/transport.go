@@ -0,0 +1,285 @@
+package memory
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+const (
+	MsgTypeMemoryMessage = "memory.message"
+
+	// inboxSize is the number of frames that can be waiting to be read by a connection
+	inboxSize = 256
+)
+
+// ErrUnexpectedFrame is returned when a connection receives a frame it was not expecting
+var ErrUnexpectedFrame = errors.New("unexpected frame")
+
+// Transport is a mesh transport that connects Grav instances in the same process over an in-memory Network
+type Transport struct {
+	network *Network
+	address string
+
+	opts *grav.MeshOptions
+	log  *vlog.Logger
+
+	connectionFunc grav.ConnectFunc
+}
+
+// Conn implements transport.Connection and represents one side of an in-memory connection
+type Conn struct {
+	nodeUUID string
+	log      *vlog.Logger
+
+	network *Network
+	local   string
+	remote  string
+	peer    *Conn
+
+	inbox     chan frame
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// New creates a new memory transport that listens on the network at address.
+// Other instances connect to it by passing the address to ConnectEndpoint.
+func New(network *Network, address string) *Transport {
+	t := &Transport{
+		network: network,
+		address: address,
+	}
+
+	return t
+}
+
+// Setup sets up the transport and registers it on the network
+func (t *Transport) Setup(opts *grav.MeshOptions, connFunc grav.ConnectFunc) error {
+	t.opts = opts
+	t.log = opts.Logger
+	t.connectionFunc = connFunc
+
+	if err := t.network.register(t); err != nil {
+		return errors.Wrapf(err, "[transport-memory] failed to register %s", t.address)
+	}
+
+	return nil
+}
+
+// Connect connects to the transport listening on the network at endpoint
+func (t *Transport) Connect(endpoint string) (grav.Connection, error) {
+	remote, err := t.network.find(t.address, endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[transport-memory] failed to connect to %s", endpoint)
+	}
+
+	local := newConn(t.network, t.log, t.address, endpoint)
+	peer := newConn(t.network, remote.log, endpoint, t.address)
+
+	local.peer = peer
+	peer.peer = local
+
+	go remote.connectionFunc(peer)
+
+	return local, nil
+}
+
+// Stop removes the transport from the network
+func (t *Transport) Stop() error {
+	t.network.unregister(t)
+
+	return nil
+}
+
+func newConn(network *Network, log *vlog.Logger, local, remote string) *Conn {
+	c := &Conn{
+		log:       log,
+		network:   network,
+		local:     local,
+		remote:    remote,
+		inbox:     make(chan frame, inboxSize),
+		closed:    make(chan struct{}),
+		closeOnce: sync.Once{},
+	}
+
+	return c
+}
+
+// SendMsg sends a message to the connection
+func (c *Conn) SendMsg(msg grav.Message) error {
+	msgBytes, err := msg.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "[transport-memory] failed to Marshal message")
+	}
+
+	if c.network.drop(c.local, c.remote) {
+		c.log.Debug("[transport-memory] dropping message", msg.UUID(), "to connection", c.nodeUUID)
+		return nil
+	}
+
+	if err := c.send(frameMessage, msgBytes); err != nil {
+		return err
+	}
+
+	c.log.Debug("[transport-memory] sent message", msg.UUID(), "to connection", c.nodeUUID)
+
+	return nil
+}
+
+// ReadMsg reads the next message or withdraw from the connection
+func (c *Conn) ReadMsg() (grav.Message, *grav.Withdraw, error) {
+	f, err := c.read()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "[transport-memory] failed to read, closing")
+	}
+
+	switch f.kind {
+	case frameWithdraw:
+		return nil, &grav.Withdraw{Ack: false}, nil
+	case frameWithdrawAck:
+		return nil, &grav.Withdraw{Ack: true}, nil
+	case frameMessage:
+		// handled below
+	default:
+		return nil, nil, ErrUnexpectedFrame
+	}
+
+	msg, err := grav.MsgFromBytes(f.data)
+	if err != nil {
+		c.log.Debug(errors.Wrap(err, "[transport-memory] failed to MsgFromBytes, falling back to raw data").Error())
+
+		msg = grav.NewMsg(MsgTypeMemoryMessage, f.data)
+	}
+
+	c.log.Debug("[transport-memory] received message", msg.UUID(), "via", c.nodeUUID)
+
+	return msg, nil, nil
+}
+
+// OutgoingHandshake performs a connection handshake and returns the UUID of the node that we're connected to
+func (c *Conn) OutgoingHandshake(handshake *grav.TransportHandshake) (*grav.TransportHandshakeAck, error) {
+	handshakeJSON, err := json.Marshal(handshake)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Marshal handshake JSON")
+	}
+
+	if err := c.send(frameHandshake, handshakeJSON); err != nil {
+		return nil, errors.Wrap(err, "failed to send handshake")
+	}
+
+	f, err := c.read()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read handshake ack, terminating connection")
+	}
+
+	if f.kind != frameHandshakeAck {
+		return nil, errors.Wrap(ErrUnexpectedFrame, "first frame recieved was not handshake ack")
+	}
+
+	ack := grav.TransportHandshakeAck{}
+	if err := json.Unmarshal(f.data, &ack); err != nil {
+		return nil, errors.Wrap(err, "failed to Unmarshal handshake ack")
+	}
+
+	c.nodeUUID = ack.UUID
+
+	return &ack, nil
+}
+
+// IncomingHandshake waits for a handshake and replies with the ack provided by the callback
+func (c *Conn) IncomingHandshake(handshakeCallback grav.HandshakeCallback) error {
+	f, err := c.read()
+	if err != nil {
+		return errors.Wrap(err, "failed to read handshake, terminating connection")
+	}
+
+	if f.kind != frameHandshake {
+		return errors.Wrap(ErrUnexpectedFrame, "first frame recieved was not handshake")
+	}
+
+	handshake := &grav.TransportHandshake{}
+	if err := json.Unmarshal(f.data, handshake); err != nil {
+		return errors.Wrap(err, "failed to Unmarshal handshake")
+	}
+
+	ackJSON, err := json.Marshal(handshakeCallback(handshake))
+	if err != nil {
+		return errors.Wrap(err, "failed to Marshal handshake ack JSON")
+	}
+
+	if err := c.send(frameHandshakeAck, ackJSON); err != nil {
+		return errors.Wrap(err, "failed to send handshake ack")
+	}
+
+	c.nodeUUID = handshake.UUID
+
+	return nil
+}
+
+// SendWithdraw sends a withdraw message to the peer
+func (c *Conn) SendWithdraw(withdraw *grav.Withdraw) error {
+	kind := frameWithdraw
+	if withdraw.Ack {
+		kind = frameWithdrawAck
+	}
+
+	if err := c.send(kind, nil); err != nil {
+		return errors.Wrap(err, "[transport-memory] failed to send withdraw")
+	}
+
+	return nil
+}
+
+// Close closes the connection, causing reads and writes on both sides to fail
+func (c *Conn) Close() error {
+	c.log.Debug("[transport-memory] connection for", c.nodeUUID, "is closing")
+
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+
+	return nil
+}
+
+// send places a frame in the peer's inbox
+func (c *Conn) send(kind frameKind, data []byte) error {
+	f := frame{
+		kind:      kind,
+		data:      data,
+		deliverAt: c.network.deliverAt(),
+	}
+
+	select {
+	case <-c.closed:
+		return grav.ErrConnectionClosed
+	case <-c.peer.closed:
+		return grav.ErrConnectionClosed
+	default:
+		// continue
+	}
+
+	select {
+	case c.peer.inbox <- f:
+		return nil
+	case <-c.closed:
+		return grav.ErrConnectionClosed
+	case <-c.peer.closed:
+		return grav.ErrConnectionClosed
+	}
+}
+
+// read waits for the next frame to be delivered to the connection
+func (c *Conn) read() (frame, error) {
+	select {
+	case f := <-c.inbox:
+		f.wait(c.closed)
+		return f, nil
+	case <-c.closed:
+		return frame{}, grav.ErrConnectionClosed
+	case <-c.peer.closed:
+		return frame{}, grav.ErrConnectionClosed
+	}
+}
@@ -0,0 +1,608 @@
+package memory
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/suborbital/grav/auth"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+func newMeshNode(network *Network, address string) *grav.Grav {
+	return grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseMeshTransport(New(network, address)),
+	)
+}
+
+func receiver(g *grav.Grav) chan string {
+	received := make(chan string, 16)
+
+	pod := g.Connect()
+	pod.On(func(msg grav.Message) error {
+		received <- string(msg.Data())
+		return nil
+	})
+
+	return received
+}
+
+func expectMsg(t *testing.T, ch chan string, expected string) {
+	t.Helper()
+
+	select {
+	case data := <-ch:
+		if data != expected {
+			t.Errorf("expected %s, got %s", expected, data)
+		}
+	case <-time.After(time.Second * 2):
+		t.Errorf("timed out waiting for %s", expected)
+	}
+}
+
+func expectNoMsg(t *testing.T, ch chan string) {
+	t.Helper()
+
+	select {
+	case data := <-ch:
+		t.Errorf("expected no message, got %s", data)
+	case <-time.After(time.Millisecond * 300):
+		// good
+	}
+}
+
+func TestMemoryMesh(t *testing.T) {
+	network := NewNetwork()
+
+	gA, gB := newMeshNode(network, "a"), newMeshNode(network, "b")
+	receivedB := receiver(gB)
+
+	// B registers on the network in the background
+	time.Sleep(time.Millisecond * 50)
+
+	if err := gA.ConnectEndpoint("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	podA := gA.Connect()
+
+	podA.Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello")))
+	expectMsg(t, receivedB, "hello")
+
+	network.SetLatency(time.Millisecond * 200)
+	start := time.Now()
+
+	podA.Send(grav.NewMsg(grav.MsgTypeDefault, []byte("slow")))
+	expectMsg(t, receivedB, "slow")
+
+	if time.Since(start) < time.Millisecond*200 {
+		t.Error("expected message to be delayed by latency")
+	}
+
+	network.SetLatency(0)
+	network.Partition("a", "b")
+
+	podA.Send(grav.NewMsg(grav.MsgTypeDefault, []byte("partitioned")))
+	expectNoMsg(t, receivedB)
+
+	network.HealAll()
+	network.SetDropRate(1)
+
+	podA.Send(grav.NewMsg(grav.MsgTypeDefault, []byte("dropped")))
+	expectNoMsg(t, receivedB)
+
+	network.SetDropRate(0)
+
+	podA.Send(grav.NewMsg(grav.MsgTypeDefault, []byte("healed")))
+	expectMsg(t, receivedB, "healed")
+}
+
+func TestMemoryMeshUnreachable(t *testing.T) {
+	network := NewNetwork()
+
+	gA := newMeshNode(network, "a")
+	newMeshNode(network, "b")
+
+	time.Sleep(time.Millisecond * 50)
+
+	if err := gA.ConnectEndpoint("c"); err == nil {
+		t.Error("expected connection to unknown address to fail")
+	}
+
+	network.Partition("a", "b")
+
+	if err := gA.ConnectEndpoint("b"); err == nil {
+		t.Error("expected connection across a partition to fail")
+	}
+
+	if err := gA.ConnectEndpoint("a"); err != grav.ErrConnectedToSelf {
+		t.Errorf("expected ErrConnectedToSelf connecting to own address, got %v", err)
+	}
+}
+
+func TestMemoryMeshAuthentication(t *testing.T) {
+	network := NewNetwork()
+
+	newNode := func(address string, authenticator grav.Authenticator) *grav.Grav {
+		mods := []grav.OptionsModifier{
+			grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+			grav.UseMeshTransport(New(network, address)),
+		}
+
+		if authenticator != nil {
+			mods = append(mods, grav.UseAuthenticator(authenticator))
+		}
+
+		return grav.New(mods...)
+	}
+
+	gA := newNode("a", auth.NewPSK([]byte("secret"), "mesh"))
+	receivedA := receiver(gA)
+
+	// B registers on the network in the background
+	time.Sleep(time.Millisecond * 50)
+
+	tests := []struct {
+		name          string
+		authenticator grav.Authenticator
+		accepted      bool
+	}{
+		{"same key", auth.NewPSK([]byte("secret"), "mesh"), true},
+		{"wrong key", auth.NewPSK([]byte("guessed"), "mesh"), false},
+		{"no authenticator", nil, false},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := newNode(string(rune('b'+i)), test.authenticator)
+			time.Sleep(time.Millisecond * 50)
+
+			// the peer's UUID is not known, so it is learned before authenticating
+			err := g.ConnectEndpoint("a")
+			if test.accepted && err != nil {
+				t.Fatalf("expected connection to be accepted, got %s", err)
+			} else if !test.accepted && !errors.Is(err, grav.ErrAuthFailed) {
+				t.Fatalf("expected ErrAuthFailed, got %v", err)
+			}
+
+			g.Connect().Send(grav.NewMsg(grav.MsgTypeDefault, []byte(test.name)))
+
+			if test.accepted {
+				expectMsg(t, receivedA, test.name)
+			} else {
+				expectNoMsg(t, receivedA)
+			}
+		})
+	}
+}
+
+func TestMemoryMeshACL(t *testing.T) {
+	network := NewNetwork()
+
+	acl := &grav.ACL{
+		Rules: []grav.ACLRule{
+			{Publish: []string{"public.*"}, Receive: []string{"public.*"}},
+		},
+	}
+
+	gA := grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseMeshTransport(New(network, "a")),
+		grav.UseACL(acl),
+	)
+	gB := newMeshNode(network, "b")
+
+	// each node sends with the pod it receives on, which doesn't receive its own messages
+	podA, podB := gA.Connect(), gB.Connect()
+	receivedA, receivedB := make(chan string, 16), make(chan string, 16)
+
+	podA.On(func(msg grav.Message) error {
+		receivedA <- string(msg.Data())
+		return nil
+	})
+
+	podB.On(func(msg grav.Message) error {
+		receivedB <- string(msg.Data())
+		return nil
+	})
+
+	// B registers on the network in the background
+	time.Sleep(time.Millisecond * 50)
+
+	if err := gA.ConnectEndpoint("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	// types denied by A's ACL are dropped in both directions
+	podB.Send(grav.NewMsg("secret.created", []byte("secret from b")))
+	podB.Send(grav.NewMsg("public.created", []byte("public from b")))
+	expectMsg(t, receivedA, "public from b")
+	expectNoMsg(t, receivedA)
+
+	podA.Send(grav.NewMsg("secret.created", []byte("secret from a")))
+	podA.Send(grav.NewMsg("public.created", []byte("public from a")))
+	expectMsg(t, receivedB, "public from a")
+	expectNoMsg(t, receivedB)
+
+	if stats := acl.Stats(); stats.PublishDenied != 1 || stats.ReceiveDenied != 1 {
+		t.Errorf("expected one message denied each way, got %+v", stats)
+	}
+}
+
+func TestMemoryBridge(t *testing.T) {
+	network := NewNetwork()
+
+	newBridgeNode := func() *grav.Grav {
+		g := grav.New(
+			grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+			grav.UseBridgeTransport(NewBridge(network)),
+		)
+
+		if err := g.ConnectBridgeTopic(grav.MsgTypeDefault); err != nil {
+			t.Fatal(err)
+		}
+
+		return g
+	}
+
+	gA, gB := newBridgeNode(), newBridgeNode()
+	receivedB := receiver(gB)
+
+	gA.Connect().Send(grav.NewMsg(grav.MsgTypeDefault, []byte("via the bridge")))
+	expectMsg(t, receivedB, "via the bridge")
+
+	gA.Connect().Send(grav.NewMsg("other.type", []byte("not bridged")))
+	expectNoMsg(t, receivedB)
+}
+
+func TestMemoryBridgeReconnect(t *testing.T) {
+	network := NewNetwork()
+
+	newBridgeNode := func() *grav.Grav {
+		g := grav.New(
+			grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+			grav.UseBridgeTransport(NewBridge(network)),
+		)
+
+		if err := g.ConnectBridgeTopic(grav.MsgTypeDefault); err != nil {
+			t.Fatal(err)
+		}
+
+		return g
+	}
+
+	gA, gB := newBridgeNode(), newBridgeNode()
+	receivedB := receiver(gB)
+
+	network.FailTopic(grav.MsgTypeDefault)
+
+	waitForState := func(state grav.BridgeState) {
+		t.Helper()
+
+		deadline := time.Now().Add(time.Second * 5)
+		for gA.BridgeTopicState(grav.MsgTypeDefault) != state || gB.BridgeTopicState(grav.MsgTypeDefault) != state {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for the topic to be %s", state)
+			}
+
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+
+	// both nodes reconnect to the topic after a backoff
+	waitForState(grav.BridgeStateReconnecting)
+	waitForState(grav.BridgeStateConnected)
+
+	gA.Connect().Send(grav.NewMsg(grav.MsgTypeDefault, []byte("after reconnecting")))
+	expectMsg(t, receivedB, "after reconnecting")
+}
+
+func TestMemoryBridgeMapping(t *testing.T) {
+	network := NewNetwork()
+
+	mapping := grav.TopicMapping{
+		Types: []string{"user.*", "order.created"},
+		Type:  "event.raw",
+	}
+
+	newBridgeNode := func() *grav.Grav {
+		g := grav.New(
+			grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+			grav.UseBridgeTransport(NewBridge(network)),
+		)
+
+		if err := g.ConnectBridgeTopicWithMapping("events", mapping); err != nil {
+			t.Fatal(err)
+		}
+
+		return g
+	}
+
+	gA, gB := newBridgeNode(), newBridgeNode()
+
+	receivedTypes := make(chan string, 16)
+
+	gB.Connect().On(func(msg grav.Message) error {
+		receivedTypes <- msg.Type()
+		return nil
+	})
+
+	podA := gA.Connect()
+
+	podA.Send(grav.NewMsg("user.login", []byte("login")))
+	expectMsg(t, receivedTypes, "user.login")
+
+	podA.Send(grav.NewMsg("order.created", []byte("order")))
+	expectMsg(t, receivedTypes, "order.created")
+
+	podA.Send(grav.NewMsg("order.shipped", []byte("not mapped")))
+	expectNoMsg(t, receivedTypes)
+
+	// raw data published by something other than Grav takes the mapping's type
+	rawBridge := NewBridge(network)
+	rawBridge.Setup(&grav.BridgeOptions{Logger: vlog.Default(vlog.Level(vlog.LogLevelNull))})
+
+	raw, err := rawBridge.ConnectTopic("events")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer raw.Close()
+
+	raw.(*BridgeConn).publish([]byte("raw data"))
+	expectMsg(t, receivedTypes, "event.raw")
+}
+
+func TestBridgeRelay(t *testing.T) {
+	// newMeshedPair creates two nodes that are meshed together and connected to the same bridge topic
+	newMeshedPair := func(network *Network, relay grav.BridgeRelay) (*grav.Grav, *grav.Grav) {
+		newNode := func(address string) *grav.Grav {
+			g := grav.New(
+				grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+				grav.UseMeshTransport(New(network, address)),
+				grav.UseBridgeTransport(NewBridge(network)),
+				grav.UseBridgeRelay(relay),
+			)
+
+			if err := g.ConnectBridgeTopic(grav.MsgTypeDefault); err != nil {
+				t.Fatal(err)
+			}
+
+			return g
+		}
+
+		gA, gB := newNode("a"), newNode("b")
+
+		// B registers on the network in the background
+		time.Sleep(time.Millisecond * 50)
+
+		if err := gA.ConnectEndpoint("b"); err != nil {
+			t.Fatal(err)
+		}
+
+		return gA, gB
+	}
+
+	// observer counts the copies of messages published to the bridge topic
+	observer := func(network *Network) chan string {
+		g := grav.New(
+			grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+			grav.UseBridgeTransport(NewBridge(network)),
+		)
+
+		if err := g.ConnectBridgeTopic(grav.MsgTypeDefault); err != nil {
+			t.Fatal(err)
+		}
+
+		return receiver(g)
+	}
+
+	t.Run("default", func(t *testing.T) {
+		network := NewNetwork()
+		gA, _ := newMeshedPair(network, grav.BridgeRelay{ToMesh: true, FromMesh: true})
+		observed := observer(network)
+
+		gA.Connect().Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello")))
+
+		// A publishes the message, and B does not publish the copy it received from A over the mesh
+		// since A is connected to the same topic, nor does either publish it again once it arrives back from the topic
+		expectMsg(t, observed, "hello")
+		expectNoMsg(t, observed)
+	})
+
+	t.Run("default from topic", func(t *testing.T) {
+		network := NewNetwork()
+		gA, gB := newMeshedPair(network, grav.BridgeRelay{ToMesh: true, FromMesh: true})
+		receivedA, receivedB := receiver(gA), receiver(gB)
+
+		publisher := grav.New(
+			grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+			grav.UseBridgeTransport(NewBridge(network)),
+		)
+
+		if err := publisher.ConnectBridgeTopic(grav.MsgTypeDefault); err != nil {
+			t.Fatal(err)
+		}
+
+		observed := observer(network)
+
+		publisher.Connect().Send(grav.NewMsg(grav.MsgTypeDefault, []byte("from the topic")))
+
+		// A and B receive the message from the topic and relay it to each other, but neither publishes it back to the topic
+		expectMsg(t, receivedA, "from the topic")
+		expectMsg(t, receivedB, "from the topic")
+		expectMsg(t, observed, "from the topic")
+		expectNoMsg(t, observed)
+	})
+
+	t.Run("echo", func(t *testing.T) {
+		network := NewNetwork()
+		network.SetEcho(true)
+
+		gA, _ := newMeshedPair(network, grav.BridgeRelay{ToMesh: true, FromMesh: true})
+		receivedA := receiver(gA)
+
+		// the broker delivers A's message back to it, which must not reach A's pods a second time
+		gA.Connect().Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello")))
+
+		expectMsg(t, receivedA, "hello")
+		expectNoMsg(t, receivedA)
+	})
+
+	t.Run("not from mesh", func(t *testing.T) {
+		network := NewNetwork()
+		gA, _ := newMeshedPair(network, grav.BridgeRelay{ToMesh: true, FromMesh: false})
+		observed := observer(network)
+
+		gA.Connect().Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello")))
+
+		expectMsg(t, observed, "hello")
+		expectNoMsg(t, observed)
+	})
+
+	t.Run("not to mesh", func(t *testing.T) {
+		network := NewNetwork()
+		gA, gB := newMeshedPair(network, grav.BridgeRelay{ToMesh: false, FromMesh: true})
+		receivedA, receivedB := receiver(gA), receiver(gB)
+
+		// a message published to the topic by another node reaches A and B from the topic, but is not relayed between them
+		publisher := grav.New(
+			grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+			grav.UseBridgeTransport(NewBridge(network)),
+		)
+
+		if err := publisher.ConnectBridgeTopic(grav.MsgTypeDefault); err != nil {
+			t.Fatal(err)
+		}
+
+		publisher.Connect().Send(grav.NewMsg(grav.MsgTypeDefault, []byte("from the topic")))
+
+		expectMsg(t, receivedA, "from the topic")
+		expectMsg(t, receivedB, "from the topic")
+		expectNoMsg(t, receivedA)
+		expectNoMsg(t, receivedB)
+	})
+}
+
+// lossDiscovery is a discovery plugin that reports a single endpoint and allows it to be reported lost
+type lossDiscovery struct {
+	endpoint string
+	lostFunc grav.LostFunc
+	started  chan struct{}
+}
+
+func (l *lossDiscovery) Start(opts *grav.DiscoveryOpts, discoveryFunc grav.DiscoveryFunc) error {
+	discoveryFunc(l.endpoint, "")
+	close(l.started)
+
+	return nil
+}
+
+func (l *lossDiscovery) UseLostFunc(lostFunc grav.LostFunc) {
+	l.lostFunc = lostFunc
+}
+
+func (l *lossDiscovery) Stop() error {
+	return nil
+}
+
+func TestDiscoveryLostPeer(t *testing.T) {
+	network := NewNetwork()
+
+	gB := newMeshNode(network, "b")
+	receivedB := receiver(gB)
+
+	time.Sleep(time.Millisecond * 50)
+
+	discovery := &lossDiscovery{endpoint: "b", started: make(chan struct{})}
+
+	gA := grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseMeshTransport(New(network, "a")),
+		grav.UseDiscovery(discovery),
+	)
+
+	<-discovery.started
+
+	podA := gA.Connect()
+
+	podA.Send(grav.NewMsg(grav.MsgTypeDefault, []byte("found")))
+	expectMsg(t, receivedB, "found")
+
+	// the peer is only known by the endpoint it was discovered at
+	discovery.lostFunc("b", "")
+
+	podA.Send(grav.NewMsg(grav.MsgTypeDefault, []byte("lost")))
+	expectNoMsg(t, receivedB)
+}
+
+func TestDiscoveryLostPeerWhileSending(t *testing.T) {
+	network := NewNetwork()
+
+	gB := newMeshNode(network, "b")
+	gC := newMeshNode(network, "c")
+
+	receivedC := make(chan string, 16)
+	gC.Connect().OnType(grav.MsgTypeDefault, func(msg grav.Message) error {
+		receivedC <- string(msg.Data())
+		return nil
+	})
+
+	time.Sleep(time.Millisecond * 50)
+
+	discovery := &lossDiscovery{endpoint: "b", started: make(chan struct{})}
+
+	gA := grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseMeshTransport(New(network, "a")),
+		grav.UseDiscovery(discovery),
+	)
+
+	<-discovery.started
+
+	podA := gA.Connect()
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// keep sending, so that sends to B fail repeatedly while it is torn down
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				podA.Send(grav.NewMsg("flood", []byte("flood")))
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+
+	time.Sleep(time.Millisecond * 50)
+
+	gB.Stop()
+
+	time.Sleep(time.Millisecond * 50)
+
+	lost := make(chan struct{})
+	go func() {
+		discovery.lostFunc("b", "")
+		close(lost)
+	}()
+
+	select {
+	case <-lost:
+	case <-time.After(time.Second * 2):
+		t.Fatal("timed out tearing down lost peer")
+	}
+
+	// new connections can still be added and sent to
+	if err := gA.ConnectEndpoint("c"); err != nil {
+		t.Fatal(err)
+	}
+
+	podA.Send(grav.NewMsg(grav.MsgTypeDefault, []byte("after")))
+	expectMsg(t, receivedC, "after")
+}
@@ -0,0 +1,277 @@
+package mqtt
+
+import (
+	"strings"
+	"sync"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+// inboxSize is the number of received messages buffered for each topic before the broker connection is blocked
+const inboxSize = 256
+
+// ErrInvalidQoS is returned when a QoS level other than 0, 1 or 2 is configured
+var ErrInvalidQoS = errors.New("QoS must be 0, 1 or 2")
+
+// Options are the options for an MQTT transport
+type Options struct {
+	// QoS is the quality of service level used when publishing and subscribing (0, 1 or 2)
+	QoS byte
+	// Retain sets the retain flag on published messages, so that the broker delivers the last message on a topic to new subscribers
+	Retain bool
+	// SkipRetained discards retained messages, which the broker delivers when a topic is first connected
+	SkipRetained bool
+	// MsgType returns the Grav message type for raw (non-Grav) payloads received on an MQTT topic. Defaults to the topic itself.
+	MsgType func(mqttTopic string) string
+	// ClientID is the MQTT client ID, which must be unique on the broker. Defaults to a random ID.
+	ClientID string
+}
+
+// Transport is a transport that connects Grav nodes and MQTT clients such as IoT devices via an MQTT broker
+type Transport struct {
+	opts *grav.BridgeOptions
+	log  *vlog.Logger
+
+	mqttOpts Options
+	client   mqtt.Client
+
+	conns map[string]*Conn
+	lock  sync.RWMutex
+}
+
+// Conn implements transport.TopicConnection and represents a subscribe/send pair for an MQTT topic
+type Conn struct {
+	topic    string
+	mapping  grav.TopicMapping
+	opts     *grav.BridgeOptions
+	mqttOpts Options
+	log      *vlog.Logger
+	pod      *grav.Pod
+
+	client mqtt.Client
+	inbox  chan mqtt.Message
+	done   chan struct{}
+
+	// removeFunc stops the transport from resubscribing to the topic after a reconnect. It returns false if
+	// the topic has since been connected again, in which case the subscription belongs to the newer connection.
+	removeFunc func() bool
+}
+
+// New creates a new MQTT transport connected to the broker, publishing and subscribing with QoS 1
+func New(broker string) (*Transport, error) {
+	return NewWithOptions(broker, Options{QoS: 1})
+}
+
+// NewWithOptions creates a new MQTT transport connected to the broker with the provided options
+func NewWithOptions(broker string, mqttOpts Options) (*Transport, error) {
+	if mqttOpts.QoS > 2 {
+		return nil, ErrInvalidQoS
+	}
+
+	if mqttOpts.ClientID == "" {
+		mqttOpts.ClientID = "grav-" + uuid.New().String()
+	}
+
+	t := &Transport{
+		mqttOpts: mqttOpts,
+		conns:    map[string]*Conn{},
+		lock:     sync.RWMutex{},
+	}
+
+	clientOpts := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(mqttOpts.ClientID).
+		SetAutoReconnect(true).
+		SetOnConnectHandler(t.resubscribe)
+
+	t.client = mqtt.NewClient(clientOpts)
+
+	token := t.client.Connect()
+	if token.Wait() && token.Error() != nil {
+		return nil, errors.Wrap(token.Error(), "failed to Connect")
+	}
+
+	return t, nil
+}
+
+// Setup sets up the transport
+func (t *Transport) Setup(opts *grav.BridgeOptions) error {
+	t.opts = opts
+	t.log = opts.Logger
+
+	return nil
+}
+
+// ConnectTopic connects to a topic if the transport is a bridge. The topic may contain MQTT wildcards,
+// in which case the connection only receives messages since it is not possible to publish to a wildcard.
+func (t *Transport) ConnectTopic(topic string) (grav.BridgeConnection, error) {
+	return t.ConnectTopicWithMapping(topic, grav.DefaultTopicMapping(topic))
+}
+
+// ConnectTopicWithMapping connects to a topic using the provided mapping. The mapping's Type takes precedence over Options.MsgType,
+// and its TypeHeader is ignored since MQTT 3.1.1 messages do not have headers.
+func (t *Transport) ConnectTopicWithMapping(topic string, mapping grav.TopicMapping) (grav.BridgeConnection, error) {
+	conn := &Conn{
+		topic:    topic,
+		mapping:  mapping,
+		opts:     t.opts,
+		mqttOpts: t.mqttOpts,
+		log:      t.log,
+		client:   t.client,
+		inbox:    make(chan mqtt.Message, inboxSize),
+		done:     make(chan struct{}),
+	}
+
+	if err := conn.subscribe(); err != nil {
+		return nil, errors.Wrap(err, "failed to subscribe")
+	}
+
+	conn.removeFunc = func() bool {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+
+		// the hub connects a topic again before closing the connection being replaced
+		if t.conns[topic] != conn {
+			return false
+		}
+
+		delete(t.conns, topic)
+
+		return true
+	}
+
+	t.lock.Lock()
+	t.conns[topic] = conn
+	t.lock.Unlock()
+
+	return conn, nil
+}
+
+// resubscribe restores the subscriptions of every connected topic after the client reconnects to the broker
+func (t *Transport) resubscribe(client mqtt.Client) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	for topic, conn := range t.conns {
+		if err := conn.subscribe(); err != nil {
+			t.log.Error(errors.Wrapf(err, "[bridge-mqtt] failed to resubscribe to %s, reporting failure", topic))
+			t.opts.Failed(conn, err)
+		}
+	}
+}
+
+// Start begins the receiving of messages
+func (c *Conn) Start(pod *grav.Pod) {
+	c.pod = pod
+
+	if isWildcard(c.topic) {
+		c.log.Debug("[bridge-mqtt] topic", c.topic, "contains wildcards, messages will only be received")
+	} else {
+		c.pod.On(c.mapping.Filter(func(msg grav.Message) error {
+			msgBytes, err := msg.Marshal()
+			if err != nil {
+				return errors.Wrap(err, "failed to Marshal message")
+			}
+
+			msgBytes, err = c.opts.Seal(msgBytes)
+			if err != nil {
+				return errors.Wrap(err, "failed to Seal message")
+			}
+
+			token := c.client.Publish(c.topic, c.mqttOpts.QoS, c.mqttOpts.Retain, msgBytes)
+			if token.Wait() && token.Error() != nil {
+				return errors.Wrap(token.Error(), "failed to Publish")
+			}
+
+			return nil
+		}))
+	}
+
+	go func() {
+		for {
+			var message mqtt.Message
+
+			select {
+			case message = <-c.inbox:
+			case <-c.done:
+				return
+			}
+
+			if message.Retained() && c.mqttOpts.SkipRetained {
+				c.log.Debug("[bridge-mqtt] skipping retained message via", message.Topic())
+				continue
+			}
+
+			c.log.Debug("[bridge-mqtt] recieved message via", message.Topic())
+
+			data, err := c.opts.Open(message.Payload())
+			if err != nil {
+				c.log.Error(errors.Wrap(err, "[bridge-mqtt] failed to Open message, discarding"))
+				continue
+			}
+
+			msg, err := grav.MsgFromBytes(data)
+			if err != nil {
+				c.log.Debug(errors.Wrap(err, "[bridge-mqtt] failed to MsgFromBytes, falling back to raw data").Error())
+
+				msg = grav.NewMsg(c.mapping.MsgType("", c.msgType(message.Topic())), data)
+			}
+
+			// send to the Grav instance
+			c.pod.Send(msg)
+		}
+	}()
+}
+
+// Close closes the underlying connection
+func (c *Conn) Close() {
+	c.log.Debug("[bridge-mqtt] connection for", c.topic, "is closing")
+
+	owned := c.removeFunc()
+	close(c.done)
+
+	if !owned {
+		c.log.Debug("[bridge-mqtt] topic", c.topic, "has been connected again, leaving its subscription in place")
+		return
+	}
+
+	token := c.client.Unsubscribe(c.topic)
+	if token.Wait() && token.Error() != nil {
+		c.log.Error(errors.Wrapf(token.Error(), "[bridge-mqtt] connection for %s failed to close", c.topic))
+	}
+}
+
+// subscribe subscribes to the connection's topic, passing received messages to the inbox
+func (c *Conn) subscribe() error {
+	handler := func(_ mqtt.Client, message mqtt.Message) {
+		select {
+		case c.inbox <- message:
+		case <-c.done:
+		}
+	}
+
+	token := c.client.Subscribe(c.topic, c.mqttOpts.QoS, handler)
+	if token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+
+	return nil
+}
+
+// msgType returns the message type for a raw payload received on an MQTT topic
+func (c *Conn) msgType(mqttTopic string) string {
+	if c.mqttOpts.MsgType != nil {
+		return c.mqttOpts.MsgType(mqttTopic)
+	}
+
+	return mqttTopic
+}
+
+// isWildcard returns true if the topic is an MQTT topic filter containing wildcards
+func isWildcard(topic string) bool {
+	return strings.ContainsAny(topic, "+#")
+}
@@ -0,0 +1,141 @@
+package mqtt
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	server "github.com/mochi-co/mqtt/server"
+	"github.com/mochi-co/mqtt/server/listeners"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/grav/testutil/gravtest"
+)
+
+// startBroker runs an embedded MQTT broker and returns its address
+func startBroker(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := listener.Addr().String()
+	listener.Close()
+
+	broker := server.NewServer(nil)
+	if err := broker.AddListener(listeners.NewTCP("test", address), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := broker.Serve(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { broker.Close() })
+
+	return fmt.Sprintf("tcp://%s", address)
+}
+
+func newNode(t *testing.T, broker string, opts Options, topic string) *grav.Grav {
+	transport, err := NewWithOptions(broker, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return gravtest.BridgeNode(t, transport, topic)
+}
+
+// devicePublish publishes a raw payload the way an IoT device would
+func devicePublish(t *testing.T, broker, topic string, payload string, retained bool) {
+	client := paho.NewClient(paho.NewClientOptions().AddBroker(broker).SetClientID("device"))
+
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+
+	defer client.Disconnect(100)
+
+	if token := client.Publish(topic, 1, retained, payload); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+}
+
+func TestMQTTBridge(t *testing.T) {
+	broker := startBroker(t)
+
+	gA := newNode(t, broker, Options{QoS: 1}, "grav/test")
+	gB := newNode(t, broker, Options{QoS: 1}, "grav/test")
+
+	receivedB := gravtest.Receiver(gB.Connect())
+
+	sent := grav.NewMsg("grav/test", []byte("hello over mqtt"))
+	gA.Connect().Send(sent)
+
+	if msg := gravtest.ReceiveOne(t, receivedB, "hello over mqtt"); msg != nil && msg.UUID() != sent.UUID() {
+		t.Error("expected the Grav message to be preserved across the broker")
+	}
+}
+
+func TestMQTTDeviceTopics(t *testing.T) {
+	broker := startBroker(t)
+
+	g := newNode(t, broker, Options{QoS: 1}, "devices/+/temperature")
+	received := gravtest.Receiver(g.Connect())
+
+	devicePublish(t, broker, "devices/42/temperature", "21.5", false)
+
+	// raw payloads take the type of the concrete topic they were published to
+	if msg := gravtest.ReceiveOne(t, received, "21.5"); msg != nil && msg.Type() != "devices/42/temperature" {
+		t.Errorf("expected type devices/42/temperature, got %s", msg.Type())
+	}
+}
+
+func TestMQTTReconnectTopic(t *testing.T) {
+	broker := startBroker(t)
+
+	g := newNode(t, broker, Options{QoS: 1}, "devices/status")
+	received := gravtest.Receiver(g.Connect())
+
+	// connecting the topic again replaces its connection, which must not take the new subscription with it
+	if err := g.ConnectBridgeTopic("devices/status"); err != nil {
+		t.Fatal(err)
+	}
+
+	devicePublish(t, broker, "devices/status", "online", false)
+	gravtest.ReceiveOne(t, received, "online")
+
+	if err := g.ConnectBridgeTopicWithMapping("devices/status", grav.TopicMapping{Type: "device.status"}); err != nil {
+		t.Fatal(err)
+	}
+
+	devicePublish(t, broker, "devices/status", "offline", false)
+
+	if msg := gravtest.ReceiveOne(t, received, "offline"); msg != nil && msg.Type() != "device.status" {
+		t.Errorf("expected type device.status, got %s", msg.Type())
+	}
+}
+
+func TestMQTTRetained(t *testing.T) {
+	broker := startBroker(t)
+
+	devicePublish(t, broker, "devices/status", "online", true)
+
+	received := gravtest.Receiver(newNode(t, broker, Options{QoS: 1}, "devices/status").Connect())
+	gravtest.ReceiveOne(t, received, "online")
+
+	skipped := gravtest.Receiver(newNode(t, broker, Options{QoS: 1, SkipRetained: true}, "devices/status").Connect())
+
+	select {
+	case msg := <-skipped:
+		t.Errorf("expected retained message to be skipped, got %s", string(msg.Data()))
+	case <-time.After(time.Millisecond * 300):
+		// good
+	}
+}
+
+func TestInvalidQoS(t *testing.T) {
+	if _, err := NewWithOptions("tcp://127.0.0.1:1", Options{QoS: 3}); err != ErrInvalidQoS {
+		t.Errorf("expected ErrInvalidQoS, got %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package nats
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultDurable is the durable consumer name used when JetStreamOptions.Durable is not set
+	defaultDurable = "grav"
+
+	// defaultDeliveryTimeout is used when JetStreamOptions.DeliveryTimeout is not set
+	defaultDeliveryTimeout = time.Second * 10
+)
+
+// JetStreamOptions are the options for a transport using NATS JetStream
+type JetStreamOptions struct {
+	// Stream is the stream that topics are stored in. When empty, each topic is stored in its own stream named after it.
+	Stream string
+	// DisableProvisioning prevents streams from being created, or updated to include a topic, when a topic is connected
+	DisableProvisioning bool
+	// Durable is the name of the durable consumer used to read each topic. Grav nodes with the same durable name share
+	// a topic's messages between them, and resume where they left off when reconnecting. Defaults to "grav".
+	Durable string
+	// Deliver is the policy for the first message delivered when a durable consumer is created. Defaults to DeliverAllPolicy.
+	Deliver nats.DeliverPolicy
+	// StartSequence is the first sequence delivered when using DeliverByStartSequencePolicy
+	StartSequence uint64
+	// StartTime is the time of the first message delivered when using DeliverByStartTimePolicy
+	StartTime time.Time
+	// Replay is the rate at which stored messages are replayed: as fast as possible (ReplayInstantPolicy, the default)
+	// or at the rate they were originally published (ReplayOriginalPolicy)
+	Replay nats.ReplayPolicy
+	// DeliveryTimeout is how long a message waits for a pod to handle it before it is acknowledged anyway, so that messages
+	// no pod consumes (such as those only relayed to the mesh) are not redelivered. It should be shorter than the consumer's
+	// ack wait (30s by default). Defaults to 10s.
+	DeliveryTimeout time.Duration
+}
+
+// NewJetStream creates a new NATS transport using JetStream, which persists messages in streams and reads them using
+// durable consumers. Messages are acknowledged once a pod has handled them, and are redelivered if handling them fails.
+func NewJetStream(endpoint string, jsOpts JetStreamOptions) (*Transport, error) {
+	t, err := New(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := t.serverConn.JetStream()
+	if err != nil {
+		t.serverConn.Close()
+		return nil, errors.Wrap(err, "failed to JetStream")
+	}
+
+	if jsOpts.Durable == "" {
+		jsOpts.Durable = defaultDurable
+	}
+
+	if jsOpts.DeliveryTimeout == 0 {
+		jsOpts.DeliveryTimeout = defaultDeliveryTimeout
+	}
+
+	t.js = js
+	t.jsOpts = &jsOpts
+
+	return t, nil
+}
+
+// subscribeStream provisions the topic's stream if needed and subscribes to it with a durable consumer
+func (t *Transport) subscribeStream(topic string) (*nats.Subscription, error) {
+	stream := t.jsOpts.Stream
+	if stream == "" {
+		stream = streamName(topic)
+	}
+
+	if !t.jsOpts.DisableProvisioning {
+		if err := t.provisionStream(stream, topic); err != nil {
+			return nil, errors.Wrap(err, "failed to provisionStream")
+		}
+	}
+
+	if err := t.ensureConsumer(stream, topic); err != nil {
+		return nil, errors.Wrap(err, "failed to ensureConsumer")
+	}
+
+	consumer := t.jsOpts.consumerName(topic)
+
+	// the consumer name is used as the queue so that nodes sharing it share a single consumer
+	sub, err := t.js.QueueSubscribeSync(topic, consumer, nats.Bind(stream, consumer), nats.ManualAck())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to QueueSubscribeSync")
+	}
+
+	return sub, nil
+}
+
+// ensureConsumer creates the durable consumer for a topic if it does not exist. The consumer is created here rather than
+// by subscribing, since consumers created while subscribing are deleted when unsubscribing, losing their position.
+func (t *Transport) ensureConsumer(stream, topic string) error {
+	_, err := t.js.ConsumerInfo(stream, t.jsOpts.consumerName(topic))
+	if err == nil {
+		return nil
+	} else if !errors.Is(err, nats.ErrConsumerNotFound) {
+		return errors.Wrap(err, "failed to ConsumerInfo")
+	}
+
+	if _, err := t.js.AddConsumer(stream, t.jsOpts.consumerConfig(stream, topic)); err != nil {
+		return errors.Wrap(err, "failed to AddConsumer")
+	}
+
+	return nil
+}
+
+// provisionStream creates the stream if it does not exist, or adds the topic to its subjects if it is missing
+func (t *Transport) provisionStream(stream, topic string) error {
+	info, err := t.js.StreamInfo(stream)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		if _, err := t.js.AddStream(&nats.StreamConfig{Name: stream, Subjects: []string{topic}}); err != nil {
+			return errors.Wrap(err, "failed to AddStream")
+		}
+
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "failed to StreamInfo")
+	}
+
+	for _, subject := range info.Config.Subjects {
+		if subject == topic {
+			return nil
+		}
+	}
+
+	config := info.Config
+	config.Subjects = append(config.Subjects, topic)
+
+	if _, err := t.js.UpdateStream(&config); err != nil {
+		return errors.Wrap(err, "failed to UpdateStream")
+	}
+
+	return nil
+}
+
+// consumerConfig returns the configuration of a durable push consumer for a topic
+func (o *JetStreamOptions) consumerConfig(stream, topic string) *nats.ConsumerConfig {
+	consumer := o.consumerName(topic)
+
+	config := &nats.ConsumerConfig{
+		Durable:        consumer,
+		DeliverSubject: fmt.Sprintf("_GRAV_DELIVER.%s.%s", stream, consumer),
+		DeliverGroup:   consumer,
+		DeliverPolicy:  o.Deliver,
+		AckPolicy:      nats.AckExplicitPolicy,
+		FilterSubject:  topic,
+		ReplayPolicy:   o.Replay,
+	}
+
+	switch o.Deliver {
+	case nats.DeliverByStartSequencePolicy:
+		config.OptStartSeq = o.StartSequence
+	case nats.DeliverByStartTimePolicy:
+		startTime := o.StartTime
+		config.OptStartTime = &startTime
+	}
+
+	return config
+}
+
+// consumerName returns the name of the durable consumer for a topic. A stream shared by several
+// topics has a consumer for each of them, so the topic is included in the name.
+func (o *JetStreamOptions) consumerName(topic string) string {
+	if o.Stream == "" {
+		return o.Durable
+	}
+
+	return o.Durable + "_" + nameToken(topic)
+}
+
+// streamName returns the name of the stream for a topic
+func streamName(topic string) string {
+	return "GRAV_" + nameToken(topic)
+}
+
+// nameToken converts a topic into a form that can be used in stream and consumer names, which cannot contain subject tokens or wildcards
+func nameToken(topic string) string {
+	return strings.NewReplacer(".", "_", "*", "_", ">", "_").Replace(topic)
+}
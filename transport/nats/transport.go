@@ -1,6 +1,7 @@
 package nats
 
 import (
+	"sync"
 	"time"
 
 	"github.com/nats-io/nats.go"
@@ -16,17 +17,31 @@ type Transport struct {
 
 	serverConn *nats.Conn
 
+	// js and jsOpts are nil unless the transport uses JetStream
+	js     nats.JetStreamContext
+	jsOpts *JetStreamOptions
+
 	connectionFunc func(grav.Connection)
 }
 
 // Conn implements transport.TopicConnection and represents a subscribe/send pair for a NATS topic
 type Conn struct {
-	topic string
-	log   *vlog.Logger
-	pod   *grav.Pod
+	topic   string
+	mapping grav.TopicMapping
+	opts    *grav.BridgeOptions
+	log     *vlog.Logger
+	pod     *grav.Pod
+
+	serverConn *nats.Conn
+	sub        *nats.Subscription
+	pubFn      func(msg *nats.Msg) error
+
+	// jetstream is set for connections that acknowledge messages, waiting up to deliveryTimeout for them to be handled
+	jetstream       bool
+	deliveryTimeout time.Duration
 
-	sub   *nats.Subscription
-	pubFn func(data []byte) error
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 // New creates a new NATS transport
@@ -51,22 +66,72 @@ func (t *Transport) Setup(opts *grav.BridgeOptions) error {
 	return nil
 }
 
+// Stop closes the connection to the NATS server
+func (t *Transport) Stop() error {
+	t.serverConn.Close()
+
+	return nil
+}
+
 // ConnectTopic connects to a topic if the transport is a bridge
 func (t *Transport) ConnectTopic(topic string) (grav.BridgeConnection, error) {
+	return t.ConnectTopicWithMapping(topic, grav.DefaultTopicMapping(topic))
+}
+
+// ConnectTopicWithMapping connects to a topic using the provided mapping. The mapping's TypeHeader is set as a NATS message header.
+func (t *Transport) ConnectTopicWithMapping(topic string, mapping grav.TopicMapping) (grav.BridgeConnection, error) {
+	if t.js != nil {
+		return t.connectStream(topic, mapping)
+	}
+
 	sub, err := t.serverConn.SubscribeSync(topic)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to SubscribeSync")
 	}
 
-	pubFn := func(data []byte) error {
-		return t.serverConn.Publish(topic, data)
+	// ensure the server has processed the subscription before messages are published to it
+	if err := t.serverConn.Flush(); err != nil {
+		return nil, errors.Wrap(err, "failed to Flush")
+	}
+
+	conn := &Conn{
+		topic:      topic,
+		mapping:    mapping,
+		opts:       t.opts,
+		log:        t.log,
+		serverConn: t.serverConn,
+		sub:        sub,
+		pubFn:      t.serverConn.PublishMsg,
+		done:       make(chan struct{}),
+	}
+
+	return conn, nil
+}
+
+// connectStream connects to a topic stored in a JetStream stream
+func (t *Transport) connectStream(topic string, mapping grav.TopicMapping) (grav.BridgeConnection, error) {
+	sub, err := t.subscribeStream(topic)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to subscribeStream")
+	}
+
+	// publishing waits for the stream to acknowledge the message, so failures are returned from the bridge's handler
+	pubFn := func(msg *nats.Msg) error {
+		_, err := t.js.PublishMsg(msg)
+		return err
 	}
 
 	conn := &Conn{
-		topic: topic,
-		log:   t.log,
-		sub:   sub,
-		pubFn: pubFn,
+		topic:           topic,
+		mapping:         mapping,
+		opts:            t.opts,
+		log:             t.log,
+		serverConn:      t.serverConn,
+		sub:             sub,
+		pubFn:           pubFn,
+		jetstream:       true,
+		deliveryTimeout: t.jsOpts.DeliveryTimeout,
+		done:            make(chan struct{}),
 	}
 
 	return conn, nil
@@ -76,18 +141,33 @@ func (t *Transport) ConnectTopic(topic string) (grav.BridgeConnection, error) {
 func (c *Conn) Start(pod *grav.Pod) {
 	c.pod = pod
 
-	c.pod.OnType(c.topic, func(msg grav.Message) error {
+	c.pod.On(c.mapping.Filter(func(msg grav.Message) error {
 		msgBytes, err := msg.Marshal()
 		if err != nil {
 			return errors.Wrap(err, "failed to Marshal message")
 		}
 
-		if err := c.pubFn(msgBytes); err != nil {
+		msgBytes, err = c.opts.Seal(msgBytes)
+		if err != nil {
+			return errors.Wrap(err, "failed to Seal message")
+		}
+
+		natsMsg := &nats.Msg{
+			Subject: c.topic,
+			Data:    msgBytes,
+		}
+
+		if c.mapping.TypeHeader != "" {
+			natsMsg.Header = nats.Header{}
+			natsMsg.Header.Set(c.mapping.TypeHeader, msg.Type())
+		}
+
+		if err := c.pubFn(natsMsg); err != nil {
 			return errors.Wrap(err, "failed to pubFn")
 		}
 
 		return nil
-	})
+	}))
 
 	go func() {
 		for {
@@ -97,30 +177,107 @@ func (c *Conn) Start(pod *grav.Pod) {
 					continue
 				}
 
-				c.log.Error(errors.Wrap(err, "[bridge-nats] failed to ReadMessage, terminating connection"))
-				break
+				// errors are expected once the connection has been closed
+				select {
+				case <-c.done:
+					return
+				default:
+				}
+
+				c.log.Error(errors.Wrap(err, "[bridge-nats] failed to NextMsg, reporting failure"))
+				c.opts.Failed(c, err)
+
+				return
 			}
 
 			c.log.Debug("[bridge-nats] recieved message via", c.topic)
 
-			msg, err := grav.MsgFromBytes(message.Data)
+			data, err := c.opts.Open(message.Data)
+			if err != nil {
+				c.log.Error(errors.Wrap(err, "[bridge-nats] failed to Open message, discarding"))
+				c.ack(message.Term)
+				continue
+			}
+
+			msg, err := grav.MsgFromBytes(data)
 			if err != nil {
 				c.log.Debug(errors.Wrap(err, "[bridge-nats] failed to MsgFromBytes, falling back to raw data").Error())
 
-				msg = grav.NewMsg(c.topic, message.Data)
+				msg = grav.NewMsg(c.mapping.MsgType(c.typeHeader(message), c.topic), data)
 			}
 
-			// send to the Grav instance
-			c.pod.Send(msg)
+			c.send(message, msg)
 		}
 	}()
 }
 
+// send sends a message to the Grav instance. JetStream messages are acknowledged once a pod has handled them (or no pod
+// has within the delivery timeout), and redelivered if the pod handling them returns an error or the instance cannot accept them.
+func (c *Conn) send(message *nats.Msg, msg grav.Message) {
+	if !c.jetstream {
+		c.pod.Send(msg)
+		return
+	}
+
+	settle := sync.Once{}
+
+	grav.TrackDelivery(msg, c.deliveryTimeout, func(err error) {
+		settle.Do(func() { c.settle(message, err) })
+	})
+
+	if receipt := c.pod.Send(msg); receipt == nil {
+		settle.Do(func() { c.settle(message, grav.ErrConnectionClosed) })
+	}
+}
+
+// settle acknowledges a message that was handled, or asks for it to be redelivered if handling it failed
+func (c *Conn) settle(message *nats.Msg, err error) {
+	if err != nil && err != grav.ErrDeliveryTimeout {
+		c.log.Debug("[bridge-nats] failed to handle message via", c.topic, "asking for redelivery:", err.Error())
+		c.ack(message.Nak)
+
+		return
+	}
+
+	c.ack(message.Ack)
+}
+
+// typeHeader returns the value of the mapping's type header from a NATS message, if any
+func (c *Conn) typeHeader(message *nats.Msg) string {
+	if c.mapping.TypeHeader == "" {
+		return ""
+	}
+
+	return message.Header.Get(c.mapping.TypeHeader)
+}
+
+// ack calls one of a JetStream message's acknowledgement methods. Core NATS messages are not acknowledged.
+func (c *Conn) ack(ackFn func(...nats.AckOpt) error) {
+	if !c.jetstream {
+		return
+	}
+
+	if err := ackFn(); err != nil {
+		c.log.Error(errors.Wrap(err, "[bridge-nats] failed to acknowledge message"))
+	}
+}
+
 // Close closes the underlying connection
 func (c *Conn) Close() {
 	c.log.Debug("[bridge-nats] connection for", c.topic, "is closing")
 
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+
 	if err := c.sub.Unsubscribe(); err != nil {
 		c.log.Error(errors.Wrapf(err, "[bridge-nats] connection for %s failed to close", c.topic))
+		return
+	}
+
+	// wait for the server to process the unsubscribe, otherwise JetStream may deliver messages to the closed
+	// subscription that are then not redelivered until their ack wait has passed
+	if err := c.serverConn.Flush(); err != nil {
+		c.log.Error(errors.Wrapf(err, "[bridge-nats] connection for %s failed to Flush", c.topic))
 	}
 }
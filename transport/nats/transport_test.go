@@ -0,0 +1,257 @@
+package nats
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/grav/testutil/gravtest"
+	"github.com/suborbital/vektor/vlog"
+)
+
+func runServer(t *testing.T) *server.Server {
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Start()
+
+	if !s.ReadyForConnections(time.Second * 5) {
+		t.Fatal("server failed to start")
+	}
+
+	t.Cleanup(s.Shutdown)
+
+	return s
+}
+
+func TestCore(t *testing.T) {
+	s := runServer(t)
+
+	transportA, err := New(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transportB, err := New(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gA := gravtest.BridgeNode(t, transportA, grav.MsgTypeDefault)
+	gB := gravtest.BridgeNode(t, transportB, grav.MsgTypeDefault)
+	receivedB := gravtest.Receiver(gB.Connect())
+
+	gA.Connect().Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello over nats")))
+	gravtest.ReceiveOne(t, receivedB, "hello over nats")
+}
+
+func TestJetStreamResume(t *testing.T) {
+	s := runServer(t)
+
+	transportA, err := NewJetStream(s.ClientURL(), JetStreamOptions{Durable: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transportB, err := NewJetStream(s.ClientURL(), JetStreamOptions{Durable: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gA := gravtest.BridgeNode(t, transportA, grav.MsgTypeDefault)
+	gB := gravtest.BridgeNode(t, transportB, grav.MsgTypeDefault)
+	receivedB := gravtest.Receiver(gB.Connect())
+
+	podA := gA.Connect()
+
+	podA.Send(grav.NewMsg(grav.MsgTypeDefault, []byte("first")))
+	gravtest.ReceiveOne(t, receivedB, "first")
+
+	if err := gB.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	// sent while B is down, so it must be delivered from the stream once B returns
+	podA.Send(grav.NewMsg(grav.MsgTypeDefault, []byte("second")))
+
+	transportB, err = NewJetStream(s.ClientURL(), JetStreamOptions{Durable: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gB = grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseBridgeTransport(transportB),
+	)
+
+	// the stored message is delivered as soon as the topic is connected, so the receiver must exist first
+	receivedB = gravtest.Receiver(gB.Connect())
+
+	if err := gB.ConnectBridgeTopic(grav.MsgTypeDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	gravtest.ReceiveOne(t, receivedB, "second")
+
+	info, err := transportA.js.StreamInfo(streamName(grav.MsgTypeDefault))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.State.Msgs != 2 {
+		t.Errorf("expected 2 messages in the stream, got %d", info.State.Msgs)
+	}
+}
+
+func TestJetStreamRedelivery(t *testing.T) {
+	s := runServer(t)
+
+	transportA, err := NewJetStream(s.ClientURL(), JetStreamOptions{Durable: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transportB, err := NewJetStream(s.ClientURL(), JetStreamOptions{Durable: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gA := gravtest.BridgeNode(t, transportA, grav.MsgTypeDefault)
+	gB := gravtest.BridgeNode(t, transportB, grav.MsgTypeDefault)
+
+	received := make(chan grav.Message, 10)
+	failed := false
+	lock := sync.Mutex{}
+
+	// B fails to handle the message the first time, so it is redelivered from the stream
+	gB.Connect().On(func(msg grav.Message) error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		received <- msg
+
+		if !failed {
+			failed = true
+			return errors.New("database unavailable")
+		}
+
+		return nil
+	})
+
+	gA.Connect().Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello")))
+
+	gravtest.ReceiveOne(t, received, "hello")
+	gravtest.ReceiveOne(t, received, "hello")
+
+	// once handled, the message is acknowledged and not delivered again
+	select {
+	case msg := <-received:
+		t.Errorf("expected no more messages, got %s", string(msg.Data()))
+	case <-time.After(time.Millisecond * 500):
+	}
+}
+
+func TestSharedStream(t *testing.T) {
+	s := runServer(t)
+
+	transport, err := NewJetStream(s.ClientURL(), JetStreamOptions{Stream: "GRAV"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := gravtest.BridgeNode(t, transport, "orders.created")
+	if err := g.ConnectBridgeTopic("orders.shipped"); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := transport.js.StreamInfo("GRAV")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(info.Config.Subjects) != 2 {
+		t.Errorf("expected 2 subjects, got %v", info.Config.Subjects)
+	}
+
+	for _, topic := range []string{"orders.created", "orders.shipped"} {
+		if _, err := transport.js.ConsumerInfo("GRAV", transport.jsOpts.consumerName(topic)); err != nil {
+			t.Errorf("expected consumer for %s, got %s", topic, err)
+		}
+	}
+}
+
+func TestTypeHeader(t *testing.T) {
+	s := runServer(t)
+
+	transport, err := New(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseBridgeTransport(transport),
+	)
+
+	pod := g.Connect()
+	received := gravtest.Receiver(pod)
+
+	if err := g.ConnectBridgeTopicWithMapping("events", grav.TopicMapping{Types: []string{"user.*"}, TypeHeader: "Grav-Type"}); err != nil {
+		t.Fatal(err)
+	}
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("events")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// published messages carry their type in the header
+	pod.Send(grav.NewMsg("user.login", []byte("login")))
+
+	published, err := sub.NextMsg(time.Second * 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msgType := published.Header.Get("Grav-Type"); msgType != "user.login" {
+		t.Errorf("expected header user.login, got %s", msgType)
+	}
+
+	// raw data takes its type from the header, or the topic if it is missing
+	raw := nats.NewMsg("events")
+	raw.Header.Set("Grav-Type", "device.reading")
+	raw.Data = []byte("42")
+
+	if err := nc.PublishMsg(raw); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg := gravtest.ReceiveOne(t, received, "42"); msg != nil && msg.Type() != "device.reading" {
+		t.Errorf("expected type device.reading, got %s", msg.Type())
+	}
+
+	if err := nc.Publish("events", []byte("43")); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg := gravtest.ReceiveOne(t, received, "43"); msg != nil && msg.Type() != "events" {
+		t.Errorf("expected type events, got %s", msg.Type())
+	}
+}
@@ -0,0 +1,75 @@
+package redis
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+// ErrSubscriptionClosed is reported when a Pub/Sub subscription is closed other than by closing its connection
+var ErrSubscriptionClosed = errors.New("subscription closed unexpectedly")
+
+// PubSubConn implements transport.TopicConnection and represents a subscribe/publish pair for a Redis Pub/Sub channel
+type PubSubConn struct {
+	topic   string
+	mapping grav.TopicMapping
+	opts    *grav.BridgeOptions
+	log     *vlog.Logger
+	pod     *grav.Pod
+
+	client *redis.Client
+	sub    *redis.PubSub
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Start begins the receiving of messages
+func (c *PubSubConn) Start(pod *grav.Pod) {
+	c.pod = pod
+
+	c.pod.On(c.mapping.Filter(publishFunc(c.opts, func(_ grav.Message, data []byte) error {
+		return c.client.Publish(context.Background(), c.topic, data).Err()
+	})))
+
+	go func() {
+		// the client re-subscribes by itself when its connection to Redis is lost, so the channel is only closed
+		// when the subscription is closed. If that happens without Close being called, the failure is reported.
+		for message := range c.sub.Channel() {
+			c.log.Debug("[bridge-redis] recieved message via", c.topic)
+
+			msg, err := toMsg(c.opts, c.log, c.mapping.MsgType("", c.topic), []byte(message.Payload))
+			if err != nil {
+				c.log.Error(errors.Wrap(err, "[bridge-redis] failed to toMsg, discarding"))
+				continue
+			}
+
+			// send to the Grav instance
+			c.pod.Send(msg)
+		}
+
+		select {
+		case <-c.closed:
+		default:
+			c.log.ErrorString("[bridge-redis] subscription to", c.topic, "closed unexpectedly, reporting failure")
+			c.opts.Failed(c, ErrSubscriptionClosed)
+		}
+	}()
+}
+
+// Close closes the subscription
+func (c *PubSubConn) Close() {
+	c.log.Debug("[bridge-redis] connection for", c.topic, "is closing")
+
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+
+	if err := c.sub.Close(); err != nil {
+		c.log.Error(errors.Wrapf(err, "[bridge-redis] connection for %s failed to close", c.topic))
+	}
+}
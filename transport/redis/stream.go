@@ -0,0 +1,189 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+// StreamConn implements transport.TopicConnection and represents a consumer group reader and publisher for a Redis Stream
+type StreamConn struct {
+	topic      string
+	mapping    grav.TopicMapping
+	opts       *grav.BridgeOptions
+	streamOpts *StreamOptions
+	log        *vlog.Logger
+	pod        *grav.Pod
+
+	client *redis.Client
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// inflight holds the IDs of entries that have been sent to the Grav instance but not yet settled,
+	// so that they are not sent again when the pending entries are read
+	inflight map[string]bool
+	lock     sync.Mutex
+
+	// replay is signalled when an entry has failed, to read the consumer's pending entries again
+	replay chan struct{}
+}
+
+// Start begins the receiving of messages
+func (c *StreamConn) Start(pod *grav.Pod) {
+	c.pod = pod
+
+	c.pod.On(c.mapping.Filter(publishFunc(c.opts, func(msg grav.Message, data []byte) error {
+		values := map[string]interface{}{dataField: data}
+		if c.mapping.TypeHeader != "" {
+			values[c.mapping.TypeHeader] = msg.Type()
+		}
+
+		args := &redis.XAddArgs{
+			Stream: c.topic,
+			Values: values,
+		}
+
+		if c.streamOpts.MaxLen > 0 {
+			args.MaxLen = c.streamOpts.MaxLen
+			args.Approx = true
+		}
+
+		return c.client.XAdd(c.ctx, args).Err()
+	})))
+
+	go func() {
+		// messages that were delivered to this consumer but never acknowledged are replayed first
+		lastID := "0"
+
+		for {
+			select {
+			case <-c.replay:
+				lastID = "0"
+			default:
+			}
+
+			streams, err := c.client.XReadGroup(c.ctx, &redis.XReadGroupArgs{
+				Group:    c.streamOpts.Group,
+				Consumer: c.streamOpts.Consumer,
+				Streams:  []string{c.topic, lastID},
+				Count:    defaultCount,
+				Block:    c.streamOpts.Block,
+			}).Result()
+
+			if c.ctx.Err() != nil {
+				return
+			} else if err == redis.Nil {
+				continue
+			} else if err != nil {
+				c.log.Error(errors.Wrap(err, "[bridge-redis] failed to XReadGroup, reporting failure"))
+				c.opts.Failed(c, err)
+
+				return
+			}
+
+			entries := 0
+			for _, stream := range streams {
+				entries += len(stream.Messages)
+
+				for _, message := range stream.Messages {
+					c.handleEntry(message)
+
+					// pending entries are read page by page, continuing after the last one that was read
+					if lastID != ">" {
+						lastID = message.ID
+					}
+				}
+			}
+
+			// once the pending messages have all been replayed, begin reading new ones
+			if lastID != ">" && entries == 0 {
+				lastID = ">"
+			}
+		}
+	}()
+}
+
+// Close stops reading from the stream
+func (c *StreamConn) Close() {
+	c.log.Debug("[bridge-redis] connection for", c.topic, "is closing")
+
+	c.cancel()
+}
+
+// handleEntry sends a stream entry to the Grav instance, and it is acknowledged once a pod has handled it. Entries that
+// cannot be decoded are acknowledged immediately, since they would otherwise be replayed forever.
+func (c *StreamConn) handleEntry(message redis.XMessage) {
+	c.lock.Lock()
+	if c.inflight[message.ID] {
+		c.lock.Unlock()
+		return
+	}
+
+	c.inflight[message.ID] = true
+	c.lock.Unlock()
+
+	c.log.Debug("[bridge-redis] recieved entry", message.ID, "via", c.topic)
+
+	data, ok := message.Values[dataField].(string)
+	if !ok {
+		c.log.ErrorString("[bridge-redis] entry", message.ID, "has no data field, discarding")
+		c.settle(message.ID, nil)
+
+		return
+	}
+
+	// raw entries take their type from the mapping's TypeHeader field if it is present
+	var header string
+	if c.mapping.TypeHeader != "" {
+		header, _ = message.Values[c.mapping.TypeHeader].(string)
+	}
+
+	msg, err := toMsg(c.opts, c.log, c.mapping.MsgType(header, c.topic), []byte(data))
+	if err != nil {
+		c.log.Error(errors.Wrap(err, "[bridge-redis] failed to toMsg, discarding"))
+		c.settle(message.ID, nil)
+
+		return
+	}
+
+	settle := sync.Once{}
+
+	grav.TrackDelivery(msg, c.streamOpts.DeliveryTimeout, func(err error) {
+		settle.Do(func() { c.settle(message.ID, err) })
+	})
+
+	// send to the Grav instance
+	if receipt := c.pod.Send(msg); receipt == nil {
+		settle.Do(func() { c.settle(message.ID, grav.ErrConnectionClosed) })
+	}
+}
+
+// settle acknowledges an entry that was handled, or leaves it pending to be read again if handling it failed
+func (c *StreamConn) settle(id string, err error) {
+	c.lock.Lock()
+	delete(c.inflight, id)
+	c.lock.Unlock()
+
+	if err != nil && err != grav.ErrDeliveryTimeout {
+		c.log.Debug("[bridge-redis] failed to handle entry", id, "via", c.topic, "leaving it pending:", err.Error())
+
+		time.AfterFunc(c.streamOpts.RedeliveryDelay, func() {
+			select {
+			case c.replay <- struct{}{}:
+			default:
+			}
+		})
+
+		return
+	}
+
+	// the entry is acknowledged even if the connection has since been closed, since it has been handled
+	if err := c.client.XAck(context.Background(), c.topic, c.streamOpts.Group, id).Err(); err != nil {
+		c.log.Error(errors.Wrapf(err, "[bridge-redis] failed to XAck %s", id))
+	}
+}
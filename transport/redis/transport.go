@@ -0,0 +1,247 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+const (
+	// dataField is the field of a stream entry that holds the message
+	dataField = "data"
+
+	// defaultGroup and others are the defaults for StreamOptions
+	defaultGroup           = "grav"
+	defaultStartID         = "$"
+	defaultBlock           = time.Second
+	defaultCount           = 64
+	defaultDeliveryTimeout = time.Second * 10
+	defaultRedeliveryDelay = time.Second
+)
+
+// StreamOptions are the options for a transport using Redis Streams
+type StreamOptions struct {
+	// Group is the consumer group used to read each stream. Grav nodes in the same group share the
+	// stream's messages between them, and nodes in different groups each receive every message. Defaults to "grav".
+	Group string
+	// Consumer is the name of this node within the group. Defaults to the node's UUID, so it should
+	// be set to a stable name for messages that were delivered but not acknowledged to be replayed after a restart.
+	Consumer string
+	// StartID is the ID the group starts reading from when it is created: "$" for new messages only (the default),
+	// "0" to replay the entire stream, or the ID of a specific entry
+	StartID string
+	// MaxLen caps the approximate length of each stream when publishing. Defaults to 0 (no limit).
+	MaxLen int64
+	// Block is how long each read waits for new messages. Defaults to one second.
+	Block time.Duration
+	// DeliveryTimeout is how long an entry waits for a pod to handle it before it is acknowledged anyway, so that entries
+	// which are only relayed to the mesh (and never handled by a local pod) don't stay pending forever. Defaults to 10s.
+	DeliveryTimeout time.Duration
+	// RedeliveryDelay is how long the consumer waits before reading entries that a pod failed to handle again. Defaults to one second.
+	RedeliveryDelay time.Duration
+}
+
+// Transport is a transport that connects Grav nodes via Redis, using either Pub/Sub or Streams
+type Transport struct {
+	opts *grav.BridgeOptions
+	log  *vlog.Logger
+
+	client *redis.Client
+
+	// streamOpts is nil when the transport uses Pub/Sub
+	streamOpts *StreamOptions
+}
+
+// New creates a new Redis transport using Pub/Sub, which delivers messages to the nodes that are connected
+// when they are published (fire-and-forget)
+func New(address string) (*Transport, error) {
+	client, err := connect(address)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect")
+	}
+
+	t := &Transport{
+		client: client,
+	}
+
+	return t, nil
+}
+
+// NewStreams creates a new Redis transport using Streams, which persists messages and reads them using consumer groups.
+// Messages are acknowledged once a pod has handled them, and are read again if handling them fails.
+func NewStreams(address string, streamOpts StreamOptions) (*Transport, error) {
+	client, err := connect(address)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect")
+	}
+
+	if streamOpts.Group == "" {
+		streamOpts.Group = defaultGroup
+	}
+
+	if streamOpts.StartID == "" {
+		streamOpts.StartID = defaultStartID
+	}
+
+	if streamOpts.Block == 0 {
+		streamOpts.Block = defaultBlock
+	}
+
+	if streamOpts.DeliveryTimeout == 0 {
+		streamOpts.DeliveryTimeout = defaultDeliveryTimeout
+	}
+
+	if streamOpts.RedeliveryDelay == 0 {
+		streamOpts.RedeliveryDelay = defaultRedeliveryDelay
+	}
+
+	t := &Transport{
+		client:     client,
+		streamOpts: &streamOpts,
+	}
+
+	return t, nil
+}
+
+// Setup sets up the transport
+func (t *Transport) Setup(opts *grav.BridgeOptions) error {
+	t.opts = opts
+	t.log = opts.Logger
+
+	if t.streamOpts != nil && t.streamOpts.Consumer == "" {
+		t.streamOpts.Consumer = opts.NodeUUID
+	}
+
+	return nil
+}
+
+// ConnectTopic connects to a topic if the transport is a bridge
+func (t *Transport) ConnectTopic(topic string) (grav.BridgeConnection, error) {
+	return t.ConnectTopicWithMapping(topic, grav.DefaultTopicMapping(topic))
+}
+
+// ConnectTopicWithMapping connects to a topic using the provided mapping. In Streams mode the mapping's TypeHeader is
+// stored as a field of each entry, and in Pub/Sub mode it is ignored since Pub/Sub messages do not have headers.
+func (t *Transport) ConnectTopicWithMapping(topic string, mapping grav.TopicMapping) (grav.BridgeConnection, error) {
+	if t.streamOpts != nil {
+		return t.connectStream(topic, mapping)
+	}
+
+	return t.connectChannel(topic, mapping)
+}
+
+// Stop closes the connection to Redis
+func (t *Transport) Stop() error {
+	if err := t.client.Close(); err != nil {
+		return errors.Wrap(err, "[bridge-redis] failed to Close client")
+	}
+
+	return nil
+}
+
+// connectChannel subscribes to a Pub/Sub channel
+func (t *Transport) connectChannel(topic string, mapping grav.TopicMapping) (grav.BridgeConnection, error) {
+	sub := t.client.Subscribe(context.Background(), topic)
+
+	// wait for the subscription to be confirmed so that no messages published after ConnectTopic are missed
+	if _, err := sub.Receive(context.Background()); err != nil {
+		sub.Close()
+		return nil, errors.Wrap(err, "failed to Subscribe")
+	}
+
+	conn := &PubSubConn{
+		topic:     topic,
+		mapping:   mapping,
+		opts:      t.opts,
+		log:       t.log,
+		client:    t.client,
+		sub:       sub,
+		closed:    make(chan struct{}),
+		closeOnce: sync.Once{},
+	}
+
+	return conn, nil
+}
+
+// connectStream ensures the consumer group exists for a stream, creating the stream if needed
+func (t *Transport) connectStream(topic string, mapping grav.TopicMapping) (grav.BridgeConnection, error) {
+	ctx := context.Background()
+
+	err := t.client.XGroupCreateMkStream(ctx, topic, t.streamOpts.Group, t.streamOpts.StartID).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, errors.Wrap(err, "failed to XGroupCreateMkStream")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	conn := &StreamConn{
+		topic:      topic,
+		mapping:    mapping,
+		opts:       t.opts,
+		streamOpts: t.streamOpts,
+		log:        t.log,
+		client:     t.client,
+		ctx:        ctx,
+		cancel:     cancel,
+		inflight:   map[string]bool{},
+		lock:       sync.Mutex{},
+		replay:     make(chan struct{}, 1),
+	}
+
+	return conn, nil
+}
+
+func connect(address string) (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{Addr: address})
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, errors.Wrap(err, "failed to Ping")
+	}
+
+	return client, nil
+}
+
+// publishFunc returns a message handler that marshals and seals messages before passing them to pubFn
+func publishFunc(opts *grav.BridgeOptions, pubFn func(msg grav.Message, data []byte) error) grav.MsgFunc {
+	return func(msg grav.Message) error {
+		msgBytes, err := msg.Marshal()
+		if err != nil {
+			return errors.Wrap(err, "failed to Marshal message")
+		}
+
+		msgBytes, err = opts.Seal(msgBytes)
+		if err != nil {
+			return errors.Wrap(err, "failed to Seal message")
+		}
+
+		if err := pubFn(msg, msgBytes); err != nil {
+			return errors.Wrap(err, "failed to pubFn")
+		}
+
+		return nil
+	}
+}
+
+// toMsg opens and decodes data received on a topic, falling back to a message of the provided type for raw data
+func toMsg(opts *grav.BridgeOptions, log *vlog.Logger, msgType string, data []byte) (grav.Message, error) {
+	data, err := opts.Open(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Open message")
+	}
+
+	msg, err := grav.MsgFromBytes(data)
+	if err != nil {
+		log.Debug(errors.Wrap(err, "[bridge-redis] failed to MsgFromBytes, falling back to raw data").Error())
+
+		msg = grav.NewMsg(msgType, data)
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,243 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/grav/testutil/gravtest"
+	"github.com/suborbital/vektor/vlog"
+)
+
+func TestPubSub(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	transportA, err := New(server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transportB, err := New(server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gA := gravtest.BridgeNode(t, transportA, grav.MsgTypeDefault)
+	gB := gravtest.BridgeNode(t, transportB, grav.MsgTypeDefault)
+	receivedB := gravtest.Receiver(gB.Connect())
+
+	gA.Connect().Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello over pubsub")))
+	gravtest.ReceiveOne(t, receivedB, "hello over pubsub")
+}
+
+func TestPubSubRestart(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	transportA, err := New(server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transportB, err := New(server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gA := gravtest.BridgeNode(t, transportA, grav.MsgTypeDefault)
+	gB := gravtest.BridgeNode(t, transportB, grav.MsgTypeDefault)
+	receivedB := gravtest.Receiver(gB.Connect())
+
+	server.Close()
+
+	if err := server.Restart(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the client re-subscribes in the background, and messages published before it has are lost
+	deadline := time.After(time.Second * 5)
+
+	for {
+		gA.Connect().Send(grav.NewMsg(grav.MsgTypeDefault, []byte("after restart")))
+
+		select {
+		case msg := <-receivedB:
+			if string(msg.Data()) != "after restart" {
+				t.Errorf("expected 'after restart', got %s", string(msg.Data()))
+			}
+
+			return
+		case <-time.After(time.Millisecond * 100):
+		case <-deadline:
+			t.Fatal("timed out waiting for the subscription to be restored")
+		}
+	}
+}
+
+func TestStreams(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	transportA, err := NewStreams(server.Addr(), StreamOptions{Group: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transportB, err := NewStreams(server.Addr(), StreamOptions{Group: "b", Consumer: "b", Block: time.Millisecond * 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gA := gravtest.BridgeNode(t, transportA, grav.MsgTypeDefault)
+	gB := gravtest.BridgeNode(t, transportB, grav.MsgTypeDefault)
+	receivedB := gravtest.Receiver(gB.Connect())
+
+	gA.Connect().Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello over streams")))
+	gravtest.ReceiveOne(t, receivedB, "hello over streams")
+
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	// once delivered, the entry should be acknowledged and no longer pending for the group
+	time.Sleep(time.Millisecond * 100)
+
+	pending, err := client.XPending(context.Background(), grav.MsgTypeDefault, "b").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pending.Count != 0 {
+		t.Errorf("expected no pending entries, got %d", pending.Count)
+	}
+}
+
+func TestStreamsRedelivery(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	transportA, err := NewStreams(server.Addr(), StreamOptions{Group: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transportB, err := NewStreams(server.Addr(), StreamOptions{Group: "b", Block: time.Millisecond * 100, RedeliveryDelay: time.Millisecond * 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gA := gravtest.BridgeNode(t, transportA, grav.MsgTypeDefault)
+	gB := gravtest.BridgeNode(t, transportB, grav.MsgTypeDefault)
+
+	received := make(chan grav.Message, 10)
+	failed := false
+	lock := sync.Mutex{}
+
+	// B fails to handle the entry the first time, so it stays pending and is read again
+	gB.Connect().On(func(msg grav.Message) error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		received <- msg
+
+		if !failed {
+			failed = true
+			return errors.New("database unavailable")
+		}
+
+		return nil
+	})
+
+	gA.Connect().Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello")))
+
+	gravtest.ReceiveOne(t, received, "hello")
+	gravtest.ReceiveOne(t, received, "hello")
+
+	// once handled, the entry is acknowledged and not delivered again
+	select {
+	case msg := <-received:
+		t.Errorf("expected no more messages, got %s", string(msg.Data()))
+	case <-time.After(time.Millisecond * 500):
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	pending, err := client.XPending(context.Background(), grav.MsgTypeDefault, "b").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pending.Count != 0 {
+		t.Errorf("expected no pending entries, got %d", pending.Count)
+	}
+}
+
+func TestStreamsReplay(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	// entries added before the group exists are replayed when starting from the beginning of the stream
+	for _, data := range []string{"first", "second"} {
+		if err := client.XAdd(context.Background(), &redis.XAddArgs{Stream: "events", Values: map[string]interface{}{dataField: data}}).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	transport, err := NewStreams(server.Addr(), StreamOptions{Group: "replay", StartID: "0", Block: time.Millisecond * 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := gravtest.Receiver(gravtest.BridgeNode(t, transport, "events").Connect())
+
+	gravtest.ReceiveAll(t, received, "first", "second")
+}
+
+func TestStreamsTypeHeader(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	entries := []map[string]interface{}{
+		{dataField: "21.5", "type": "sensor.temperature"},
+		{dataField: "unknown"},
+	}
+
+	for _, values := range entries {
+		if err := client.XAdd(context.Background(), &redis.XAddArgs{Stream: "sensors", Values: values}).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	transport, err := NewStreams(server.Addr(), StreamOptions{StartID: "0", Block: time.Millisecond * 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseBridgeTransport(transport),
+	)
+
+	received := gravtest.Receiver(g.Connect())
+
+	// the receiver must exist before connecting, since the entries are replayed immediately
+	if err := g.ConnectBridgeTopicWithMapping("sensors", grav.TopicMapping{Type: "sensor.raw", TypeHeader: "type"}); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := gravtest.ReceiveAll(t, received, "21.5", "unknown")
+
+	if msg, ok := msgs["21.5"]; ok && msg.Type() != "sensor.temperature" {
+		t.Errorf("expected type sensor.temperature, got %s", msg.Type())
+	}
+
+	if msg, ok := msgs["unknown"]; ok && msg.Type() != "sensor.raw" {
+		t.Errorf("expected type sensor.raw, got %s", msg.Type())
+	}
+}
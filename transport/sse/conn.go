@@ -0,0 +1,395 @@
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+// frameSession and others are the kinds of frame exchanged over a connection. They are used as the event name of
+// frames sent by the accepting node over the event stream, and as the frame header of frames POSTed by the dialing node.
+const (
+	frameSession      = "session"
+	frameMessage      = "message"
+	frameHandshake    = "handshake"
+	frameHandshakeAck = "handshake-ack"
+	frameWithdraw     = "withdraw"
+	frameWithdrawAck  = "withdraw-ack"
+)
+
+// ErrUnexpectedFrame and others are errors related to the event stream
+var (
+	ErrUnexpectedFrame = errors.New("unexpected frame kind")
+	ErrSessionClosed   = errors.New("session closed")
+)
+
+// frame is a single unit sent over a connection
+type frame struct {
+	kind    string
+	payload []byte
+}
+
+// Conn implements transport.Connection using an event stream for frames sent by the accepting
+// node and POST requests for frames sent by the dialing node, with one Conn type serving both sides
+type Conn struct {
+	nodeUUID string
+	log      *vlog.Logger
+
+	sendFrame func(frame) error
+	readFrame func() (frame, error)
+	closeFunc func()
+	closeOnce sync.Once
+
+	tlsOpts  *grav.TLSOptions
+	tlsState *tls.ConnectionState
+}
+
+// SendMsg sends a message to the connection
+func (c *Conn) SendMsg(msg grav.Message) error {
+	msgBytes, err := msg.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "[transport-sse] failed to Marshal message")
+	}
+
+	c.log.Debug("[transport-sse] sending message", msg.UUID(), "to connection", c.nodeUUID)
+
+	if err := c.sendFrame(frame{kind: frameMessage, payload: msgBytes}); err != nil {
+		if errors.Is(err, ErrSessionClosed) {
+			return grav.ErrConnectionClosed
+		}
+
+		return errors.Wrap(err, "[transport-sse] failed to sendFrame")
+	}
+
+	c.log.Debug("[transport-sse] sent message", msg.UUID(), "to connection", c.nodeUUID)
+
+	return nil
+}
+
+// ReadMsg reads the next message or withdraw from the connection
+func (c *Conn) ReadMsg() (grav.Message, *grav.Withdraw, error) {
+	f, err := c.readFrame()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "[transport-sse] failed to readFrame, closing")
+	}
+
+	switch f.kind {
+	case frameWithdraw:
+		// let Grav know this message was a withdraw
+		return nil, &grav.Withdraw{Ack: false}, nil
+	case frameWithdrawAck:
+		// let Grav know the peer acknowledged our withdraw
+		return nil, &grav.Withdraw{Ack: true}, nil
+	case frameMessage:
+		// handled below
+	default:
+		return nil, nil, errors.Wrapf(ErrUnexpectedFrame, "[transport-sse] received frame kind %s", f.kind)
+	}
+
+	msg, err := grav.MsgFromBytes(f.payload)
+	if err != nil {
+		c.log.Debug(errors.Wrap(err, "[transport-sse] failed to MsgFromBytes, falling back to raw data").Error())
+
+		msg = grav.NewMsg(MsgTypeSSEMessage, f.payload)
+	}
+
+	c.log.Debug("[transport-sse] received message", msg.UUID(), "via", c.nodeUUID)
+
+	return msg, nil, nil
+}
+
+// OutgoingHandshake performs a connection handshake and returns the UUID of the node that we're connected to
+// so that it can be validated against the UUID that was provided in discovery (or if none was provided)
+func (c *Conn) OutgoingHandshake(handshake *grav.TransportHandshake) (*grav.TransportHandshakeAck, error) {
+	handshakeJSON, err := json.Marshal(handshake)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Marshal handshake JSON")
+	}
+
+	c.log.Debug("[transport-sse] sending handshake")
+
+	if err := c.sendFrame(frame{kind: frameHandshake, payload: handshakeJSON}); err != nil {
+		return nil, errors.Wrap(err, "failed to sendFrame handshake")
+	}
+
+	f, err := c.readFrame()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to readFrame for handshake ack, terminating connection")
+	}
+
+	if f.kind != frameHandshakeAck {
+		return nil, errors.Wrap(ErrUnexpectedFrame, "first frame recieved was not handshake ack")
+	}
+
+	c.log.Debug("[transport-sse] recieved handshake ack")
+
+	ack := grav.TransportHandshakeAck{}
+	if err := json.Unmarshal(f.payload, &ack); err != nil {
+		return nil, errors.Wrap(err, "failed to Unmarshal handshake ack")
+	}
+
+	if ack.Accept {
+		// the peer's certificate must belong to the node that it claims to be
+		if err := c.tlsOpts.VerifyPeer(c.tlsState, ack.UUID); err != nil {
+			return nil, errors.Wrapf(err, "failed to VerifyPeer for %s", ack.UUID)
+		}
+	}
+
+	c.nodeUUID = ack.UUID
+
+	return &ack, nil
+}
+
+// IncomingHandshake performs a connection handshake and returns the UUID of the node that we're connected to
+// so that it can be validated against the UUID that was provided in discovery (or if none was provided)
+func (c *Conn) IncomingHandshake(handshakeCallback grav.HandshakeCallback) error {
+	f, err := c.readFrame()
+	if err != nil {
+		return errors.Wrap(err, "failed to readFrame for handshake, terminating connection")
+	}
+
+	if f.kind != frameHandshake {
+		return errors.Wrap(ErrUnexpectedFrame, "first frame recieved was not handshake")
+	}
+
+	c.log.Debug("[transport-sse] recieved handshake")
+
+	handshake := &grav.TransportHandshake{}
+	if err := json.Unmarshal(f.payload, handshake); err != nil {
+		return errors.Wrap(err, "failed to Unmarshal handshake")
+	}
+
+	var ack *grav.TransportHandshakeAck
+
+	// the peer's certificate must belong to the node that it claims to be, otherwise the hub is never consulted
+	verifyErr := c.tlsOpts.VerifyPeer(c.tlsState, handshake.UUID)
+	if verifyErr != nil {
+		ack = &grav.TransportHandshakeAck{Accept: false, Reason: verifyErr.Error()}
+	} else {
+		ack = handshakeCallback(handshake)
+	}
+
+	ackJSON, err := json.Marshal(ack)
+	if err != nil {
+		return errors.Wrap(err, "failed to Marshal handshake ack JSON")
+	}
+
+	c.log.Debug("[transport-sse] sending handshake ack")
+
+	if err := c.sendFrame(frame{kind: frameHandshakeAck, payload: ackJSON}); err != nil {
+		return errors.Wrap(err, "failed to sendFrame handshake ack")
+	}
+
+	c.log.Debug("[transport-sse] sent handshake ack")
+
+	if verifyErr != nil {
+		return errors.Wrapf(verifyErr, "failed to VerifyPeer for %s", handshake.UUID)
+	}
+
+	c.nodeUUID = handshake.UUID
+
+	return nil
+}
+
+// SendWithdraw sends a withdraw message to the peer
+func (c *Conn) SendWithdraw(withdraw *grav.Withdraw) error {
+	kind := frameWithdraw
+	if withdraw.Ack {
+		kind = frameWithdrawAck
+	}
+
+	if err := c.sendFrame(frame{kind: kind}); err != nil {
+		return errors.Wrap(err, "[transport-sse] failed to sendFrame for withdraw")
+	}
+
+	return nil
+}
+
+// Close ends the event stream
+func (c *Conn) Close() error {
+	c.log.Debug("[transport-sse] connection for", c.nodeUUID, "is closing")
+
+	c.closeOnce.Do(c.closeFunc)
+
+	return nil
+}
+
+// session is the accepting side of a connection. Frames are written to the event stream
+// of the dialing node's GET request, and frames POSTed by the dialing node arrive in the inbox.
+type session struct {
+	id string
+
+	w       http.ResponseWriter
+	flusher http.Flusher
+	lock    sync.Mutex
+	closed  bool
+
+	inbox chan frame
+	done  chan struct{}
+}
+
+func newSession(id string, w http.ResponseWriter, flusher http.Flusher) *session {
+	s := &session{
+		id:      id,
+		w:       w,
+		flusher: flusher,
+		lock:    sync.Mutex{},
+		inbox:   make(chan frame),
+		done:    make(chan struct{}),
+	}
+
+	return s
+}
+
+// writeEvent writes a frame to the event stream. The payload is base64 encoded since event data must be text.
+func (s *session) writeEvent(f frame) error {
+	return s.write(fmt.Sprintf("event: %s\ndata: %s\n\n", f.kind, base64.StdEncoding.EncodeToString(f.payload)))
+}
+
+// writeKeepalive writes a comment to the event stream to prevent proxies from closing an idle connection
+func (s *session) writeKeepalive() error {
+	return s.write(": keepalive\n\n")
+}
+
+func (s *session) write(event string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// the ResponseWriter must not be used once the handler that owns it has returned
+	if s.closed {
+		return ErrSessionClosed
+	}
+
+	if _, err := io.WriteString(s.w, event); err != nil {
+		return err
+	}
+
+	s.flusher.Flush()
+
+	return nil
+}
+
+// readFrame returns the next frame POSTed by the dialing node
+func (s *session) readFrame() (frame, error) {
+	select {
+	case f := <-s.inbox:
+		return f, nil
+	case <-s.done:
+		return frame{}, ErrSessionClosed
+	}
+}
+
+// close prevents any further writes and causes the event stream handler to return
+func (s *session) close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+}
+
+// stream is the dialing side of a connection. Frames are read from the event stream
+// returned by the accepting node, and frames are sent as POST requests.
+type stream struct {
+	endpoint  string
+	sessionID string
+	client    *http.Client
+
+	body   io.ReadCloser
+	reader *bufio.Reader
+	cancel context.CancelFunc
+
+	// POSTs are sent one at a time so that the accepting node receives frames in order
+	lock sync.Mutex
+}
+
+// post sends a single frame to the accepting node
+func (s *stream) post(f frame) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), postTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(f.payload))
+	if err != nil {
+		return errors.Wrap(err, "failed to NewRequest")
+	}
+
+	req.Header.Set(headerSession, s.sessionID)
+	req.Header.Set(headerFrame, f.kind)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to POST frame")
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusAccepted:
+		return nil
+	case http.StatusNotFound, http.StatusGone:
+		return ErrSessionClosed
+	}
+
+	return fmt.Errorf("frame rejected with status %d", resp.StatusCode)
+}
+
+// readFrame reads the next event from the event stream. It must only be called from one goroutine at a time.
+func (s *stream) readFrame() (frame, error) {
+	f := frame{}
+	data := ""
+
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return frame{}, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "":
+			// a blank line dispatches the event, unless nothing but comments have been read
+			if f.kind == "" {
+				continue
+			}
+
+			payload, err := base64.StdEncoding.DecodeString(data)
+			if err != nil {
+				return frame{}, errors.Wrap(err, "failed to decode event data")
+			}
+
+			f.payload = payload
+
+			return f, nil
+		case strings.HasPrefix(line, ":"):
+			// comments are used as keepalives
+		case strings.HasPrefix(line, "event:"):
+			f.kind = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+}
+
+// close ends the event stream
+func (s *stream) close() {
+	s.cancel()
+	s.body.Close()
+}
@@ -0,0 +1,285 @@
+package sse
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+const (
+	MsgTypeSSEMessage = "sse.message"
+
+	// headerSession and headerFrame identify the session and kind of frames POSTed by the dialing node
+	headerSession = "X-Grav-Session"
+	headerFrame   = "X-Grav-Frame"
+
+	// keepaliveInterval is how often an idle event stream receives a comment so that proxies keep it open
+	keepaliveInterval = time.Second * 15
+
+	// postTimeout is how long the dialing node waits for a single frame to be accepted
+	postTimeout = time.Second * 10
+
+	// maxFrameSize protects against reading huge request bodies
+	maxFrameSize = 64 * 1024 * 1024
+)
+
+// Transport is a transport that connects Grav nodes using plain HTTP requests, for networks where
+// proxies prevent websocket upgrades. The accepting node sends frames using Server-Sent Events,
+// and the dialing node sends frames using POST requests to the same endpoint.
+type Transport struct {
+	opts *grav.MeshOptions
+	log  *vlog.Logger
+
+	sessions map[string]*session
+	lock     sync.RWMutex
+
+	connectionFunc grav.ConnectFunc
+}
+
+// New creates a new SSE transport
+func New() *Transport {
+	t := &Transport{
+		sessions: map[string]*session{},
+		lock:     sync.RWMutex{},
+	}
+
+	return t
+}
+
+// Setup sets up the transport
+func (t *Transport) Setup(opts *grav.MeshOptions, connFunc grav.ConnectFunc) error {
+	t.opts = opts
+	t.log = opts.Logger
+	t.connectionFunc = connFunc
+
+	return nil
+}
+
+// Connect opens an event stream to an HTTP endpoint
+func (t *Transport) Connect(endpoint string) (grav.Connection, error) {
+	if !strings.HasPrefix(endpoint, "http") {
+		scheme := "http"
+		if t.opts.TLS != nil {
+			scheme = "https"
+		}
+
+		endpoint = fmt.Sprintf("%s://%s", scheme, endpoint)
+	}
+
+	httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+	if t.opts.TLS != nil && t.opts.TLS.Config != nil {
+		httpTransport.TLSClientConfig = t.opts.TLS.Config.Clone()
+	}
+
+	client := &http.Client{Transport: httpTransport}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "[transport-sse] failed to NewRequest")
+	}
+
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "[transport-sse] failed to GET endpoint")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+
+		return nil, fmt.Errorf("[transport-sse] endpoint responded with status %d", resp.StatusCode)
+	}
+
+	s := &stream{
+		endpoint: endpoint,
+		client:   client,
+		body:     resp.Body,
+		reader:   bufio.NewReader(resp.Body),
+		cancel:   cancel,
+		lock:     sync.Mutex{},
+	}
+
+	// the first event identifies the session that frames must be POSTed to
+	f, err := s.readFrame()
+	if err != nil || f.kind != frameSession {
+		s.close()
+		return nil, errors.Wrap(ErrUnexpectedFrame, "[transport-sse] first event recieved was not session")
+	}
+
+	s.sessionID = string(f.payload)
+
+	conn := &Conn{
+		log:       t.log,
+		sendFrame: s.post,
+		readFrame: s.readFrame,
+		closeFunc: s.close,
+		tlsOpts:   t.opts.TLS,
+		tlsState:  resp.TLS,
+	}
+
+	return conn, nil
+}
+
+// HTTPHandlerFunc returns an http.HandlerFunc for incoming connections. It serves event streams for GET requests
+// and accepts frames for POST requests, so it must be mounted on a router for both methods.
+func (t *Transport) HTTPHandlerFunc() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if t.connectionFunc == nil {
+			t.log.ErrorString("[transport-sse] incoming connection received, but no connFunc configured")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if t.opts.TLS != nil && r.TLS == nil {
+			t.log.ErrorString("[transport-sse] TLS is configured, rejecting incoming plaintext request")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			t.serveStream(w, r)
+		case http.MethodPost:
+			t.acceptFrame(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// serveStream creates a session and streams its frames until the connection is closed by either side
+func (t *Transport) serveStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		t.log.ErrorString("[transport-sse] ResponseWriter does not support flushing, cannot stream events")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		t.log.Error(errors.Wrap(err, "[transport-sse] failed to newSessionID"))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// prevent proxies such as nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	s := newSession(id, w, flusher)
+
+	t.addSession(s)
+	defer t.removeSession(s)
+
+	if err := s.writeEvent(frame{kind: frameSession, payload: []byte(id)}); err != nil {
+		t.log.Error(errors.Wrap(err, "[transport-sse] failed to writeEvent for session"))
+		return
+	}
+
+	t.log.Debug("[transport-sse] opened session", id)
+
+	conn := &Conn{
+		log:       t.log,
+		sendFrame: s.writeEvent,
+		readFrame: s.readFrame,
+		closeFunc: s.close,
+		tlsOpts:   t.opts.TLS,
+		tlsState:  r.TLS,
+	}
+
+	go t.connectionFunc(conn)
+
+	ticker := time.NewTicker(keepaliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-r.Context().Done():
+			// the dialing node went away
+			s.close()
+			return
+		case <-ticker.C:
+			if err := s.writeKeepalive(); err != nil {
+				s.close()
+				return
+			}
+		}
+	}
+}
+
+// acceptFrame passes a frame POSTed by the dialing node to its session
+func (t *Transport) acceptFrame(w http.ResponseWriter, r *http.Request) {
+	s := t.session(r.Header.Get(headerSession))
+	if s == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxFrameSize))
+	if err != nil {
+		t.log.Error(errors.Wrap(err, "[transport-sse] failed to ReadAll frame"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case s.inbox <- frame{kind: r.Header.Get(headerFrame), payload: payload}:
+		w.WriteHeader(http.StatusAccepted)
+	case <-s.done:
+		w.WriteHeader(http.StatusGone)
+	case <-r.Context().Done():
+	}
+}
+
+func (t *Transport) addSession(s *session) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.sessions[s.id] = s
+}
+
+func (t *Transport) removeSession(s *session) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.sessions, s.id)
+}
+
+func (t *Transport) session(id string) *session {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.sessions[id]
+}
+
+// newSessionID returns a random session ID, which also prevents other clients from POSTing frames to the session
+func newSessionID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,135 @@
+package sse
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/grav/testutil"
+	"github.com/suborbital/grav/testutil/gravtest"
+	"github.com/suborbital/vektor/vlog"
+)
+
+func startNode(t *testing.T) (*grav.Grav, string) {
+	transport := New()
+
+	g := grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseMeshTransport(transport),
+	)
+
+	server := httptest.NewServer(transport.HTTPHandlerFunc())
+	t.Cleanup(func() {
+		// event streams never complete on their own, and Close waits for all outstanding requests
+		server.CloseClientConnections()
+		server.Close()
+	})
+
+	return g, server.URL
+}
+
+func TestSSETransport(t *testing.T) {
+	gA, _ := startNode(t)
+	gB, endpointB := startNode(t)
+
+	podA := gA.Connect()
+	receivedA := gravtest.Receiver(podA)
+	podB := gB.Connect()
+	receivedB := gravtest.Receiver(podB)
+
+	if err := gA.ConnectEndpoint(endpointB); err != nil {
+		t.Fatalf("expected connection to succeed, got %s", err)
+	}
+
+	// A dialed B, so A's messages are POSTed and B's are sent over the event stream
+	podA.Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello from A")))
+	gravtest.ReceiveOne(t, receivedB, "hello from A")
+
+	podB.Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello from B\nwith a newline")))
+	gravtest.ReceiveOne(t, receivedA, "hello from B\nwith a newline")
+
+	// frames are POSTed one at a time, so they must arrive in the order they were sent
+	for i := 0; i < 10; i++ {
+		podA.Send(grav.NewMsg(grav.MsgTypeDefault, []byte(fmt.Sprintf("message %d", i))))
+	}
+
+	for i := 0; i < 10; i++ {
+		gravtest.ReceiveOne(t, receivedB, fmt.Sprintf("message %d", i))
+	}
+}
+
+func TestSSEUnknownSession(t *testing.T) {
+	_, endpoint := startNode(t)
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set(headerSession, "not-a-session")
+	req.Header.Set(headerFrame, frameMessage)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for a POST to an unknown session, got %d", resp.StatusCode)
+	}
+}
+
+// startTLSNode starts a Grav instance whose transport is served over TLS by an httptest server
+func startTLSNode(t *testing.T, nodeUUID string, cfg *tls.Config) (*grav.Grav, string) {
+	transport := New()
+
+	g := grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseNodeUUID(nodeUUID),
+		grav.UseMeshTransport(transport),
+		grav.UseTLS(&grav.TLSOptions{Config: cfg, VerifyPeerUUID: true}),
+	)
+
+	server := httptest.NewUnstartedServer(transport.HTTPHandlerFunc())
+	server.TLS = cfg
+	server.StartTLS()
+
+	t.Cleanup(func() {
+		server.CloseClientConnections()
+		server.Close()
+	})
+
+	return g, server.URL
+}
+
+func TestTLSIdentityMismatch(t *testing.T) {
+	ca := testutil.NewCA(t)
+
+	// one of the nodes presents a valid certificate, but it was issued for a different node
+	for _, mismatched := range []string{"dialing", "accepting"} {
+		t.Run(mismatched, func(t *testing.T) {
+			uuidA, uuidB := uuid.New().String(), uuid.New().String()
+
+			certA, certB := ca.Issue(t, uuidA), ca.Issue(t, uuidB)
+			if mismatched == "dialing" {
+				certA = ca.Issue(t, uuid.New().String())
+			} else {
+				certB = ca.Issue(t, uuid.New().String())
+			}
+
+			gA, _ := startTLSNode(t, uuidA, ca.Config(certA))
+			_, endpointB := startTLSNode(t, uuidB, ca.Config(certB))
+
+			if err := gA.ConnectEndpoint(endpointB); !errors.Is(err, grav.ErrPeerIdentityMismatch) {
+				t.Errorf("expected ErrPeerIdentityMismatch, got %v", err)
+			}
+		})
+	}
+}
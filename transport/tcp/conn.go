@@ -0,0 +1,283 @@
+package tcp
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+// frameMessage and others are the types of frame that can be sent over a connection
+const (
+	frameMessage byte = iota + 1
+	frameHandshake
+	frameHandshakeAck
+	frameWithdraw
+	frameWithdrawAck
+)
+
+// maxFrameSize protects against allocating huge buffers for a corrupt or malicious length prefix
+const maxFrameSize = 64 * 1024 * 1024
+
+// ErrFrameTooLarge and others are errors related to framing
+var (
+	ErrFrameTooLarge   = errors.New("frame exceeds maximum size")
+	ErrUnexpectedFrame = errors.New("unexpected frame type")
+)
+
+// Conn implements transport.Connection over any stream-oriented net.Conn. Each frame is
+// a 4 byte big-endian length, followed by a 1 byte frame type and then the frame's payload.
+type Conn struct {
+	nodeUUID string
+	log      *vlog.Logger
+
+	conn   net.Conn
+	reader *bufio.Reader
+	lock   sync.Mutex
+
+	tlsOpts *grav.TLSOptions
+}
+
+// NewConn creates a Conn that exchanges length-prefixed frames over the provided net.Conn
+func NewConn(conn net.Conn, log *vlog.Logger) *Conn {
+	c := &Conn{
+		log:    log,
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		lock:   sync.Mutex{},
+	}
+
+	return c
+}
+
+// SendMsg sends a message to the connection
+func (c *Conn) SendMsg(msg grav.Message) error {
+	msgBytes, err := msg.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "[transport-tcp] failed to Marshal message")
+	}
+
+	c.log.Debug("[transport-tcp] sending message", msg.UUID(), "to connection", c.nodeUUID)
+
+	if err := c.writeFrame(frameMessage, msgBytes); err != nil {
+		if errors.Is(err, net.ErrClosed) {
+			return grav.ErrConnectionClosed
+		}
+
+		return errors.Wrap(err, "[transport-tcp] failed to writeFrame")
+	}
+
+	c.log.Debug("[transport-tcp] sent message", msg.UUID(), "to connection", c.nodeUUID)
+
+	return nil
+}
+
+// ReadMsg reads the next message or withdraw from the connection
+func (c *Conn) ReadMsg() (grav.Message, *grav.Withdraw, error) {
+	frameType, payload, err := c.readFrame()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "[transport-tcp] failed to readFrame, closing")
+	}
+
+	switch frameType {
+	case frameWithdraw:
+		// let Grav know this message was a withdraw
+		return nil, &grav.Withdraw{Ack: false}, nil
+	case frameWithdrawAck:
+		// let Grav know the peer acknowledged our withdraw
+		return nil, &grav.Withdraw{Ack: true}, nil
+	case frameMessage:
+		// handled below
+	default:
+		return nil, nil, errors.Wrapf(ErrUnexpectedFrame, "[transport-tcp] received frame type %d", frameType)
+	}
+
+	msg, err := grav.MsgFromBytes(payload)
+	if err != nil {
+		c.log.Debug(errors.Wrap(err, "[transport-tcp] failed to MsgFromBytes, falling back to raw data").Error())
+
+		msg = grav.NewMsg(MsgTypeTCPMessage, payload)
+	}
+
+	c.log.Debug("[transport-tcp] received message", msg.UUID(), "via", c.nodeUUID)
+
+	return msg, nil, nil
+}
+
+// OutgoingHandshake performs a connection handshake and returns the UUID of the node that we're connected to
+// so that it can be validated against the UUID that was provided in discovery (or if none was provided)
+func (c *Conn) OutgoingHandshake(handshake *grav.TransportHandshake) (*grav.TransportHandshakeAck, error) {
+	handshakeJSON, err := json.Marshal(handshake)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Marshal handshake JSON")
+	}
+
+	c.log.Debug("[transport-tcp] sending handshake")
+
+	if err := c.writeFrame(frameHandshake, handshakeJSON); err != nil {
+		return nil, errors.Wrap(err, "failed to writeFrame handshake")
+	}
+
+	frameType, payload, err := c.readFrame()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to readFrame for handshake ack, terminating connection")
+	}
+
+	if frameType != frameHandshakeAck {
+		return nil, errors.Wrap(ErrUnexpectedFrame, "first frame recieved was not handshake ack")
+	}
+
+	c.log.Debug("[transport-tcp] recieved handshake ack")
+
+	ack := grav.TransportHandshakeAck{}
+	if err := json.Unmarshal(payload, &ack); err != nil {
+		return nil, errors.Wrap(err, "failed to Unmarshal handshake ack")
+	}
+
+	if ack.Accept {
+		// the peer's certificate must belong to the node that it claims to be
+		if err := c.tlsOpts.VerifyPeer(c.tlsState(), ack.UUID); err != nil {
+			return nil, errors.Wrapf(err, "failed to VerifyPeer for %s", ack.UUID)
+		}
+	}
+
+	c.nodeUUID = ack.UUID
+
+	return &ack, nil
+}
+
+// IncomingHandshake performs a connection handshake and returns the UUID of the node that we're connected to
+// so that it can be validated against the UUID that was provided in discovery (or if none was provided)
+func (c *Conn) IncomingHandshake(handshakeCallback grav.HandshakeCallback) error {
+	frameType, payload, err := c.readFrame()
+	if err != nil {
+		return errors.Wrap(err, "failed to readFrame for handshake, terminating connection")
+	}
+
+	if frameType != frameHandshake {
+		return errors.Wrap(ErrUnexpectedFrame, "first frame recieved was not handshake")
+	}
+
+	c.log.Debug("[transport-tcp] recieved handshake")
+
+	handshake := &grav.TransportHandshake{}
+	if err := json.Unmarshal(payload, handshake); err != nil {
+		return errors.Wrap(err, "failed to Unmarshal handshake")
+	}
+
+	var ack *grav.TransportHandshakeAck
+
+	// the peer's certificate must belong to the node that it claims to be, otherwise the hub is never consulted
+	verifyErr := c.tlsOpts.VerifyPeer(c.tlsState(), handshake.UUID)
+	if verifyErr != nil {
+		ack = &grav.TransportHandshakeAck{Accept: false, Reason: verifyErr.Error()}
+	} else {
+		ack = handshakeCallback(handshake)
+	}
+
+	ackJSON, err := json.Marshal(ack)
+	if err != nil {
+		return errors.Wrap(err, "failed to Marshal handshake ack JSON")
+	}
+
+	c.log.Debug("[transport-tcp] sending handshake ack")
+
+	if err := c.writeFrame(frameHandshakeAck, ackJSON); err != nil {
+		return errors.Wrap(err, "failed to writeFrame handshake ack")
+	}
+
+	c.log.Debug("[transport-tcp] sent handshake ack")
+
+	if verifyErr != nil {
+		return errors.Wrapf(verifyErr, "failed to VerifyPeer for %s", handshake.UUID)
+	}
+
+	c.nodeUUID = handshake.UUID
+
+	return nil
+}
+
+// SendWithdraw sends a withdraw message to the peer
+func (c *Conn) SendWithdraw(withdraw *grav.Withdraw) error {
+	frameType := frameWithdraw
+	if withdraw.Ack {
+		frameType = frameWithdrawAck
+	}
+
+	if err := c.writeFrame(frameType, nil); err != nil {
+		return errors.Wrap(err, "[transport-tcp] failed to writeFrame for withdraw")
+	}
+
+	return nil
+}
+
+// Close closes the underlying connection
+func (c *Conn) Close() error {
+	c.log.Debug("[transport-tcp] connection for", c.nodeUUID, "is closing")
+
+	if err := c.conn.Close(); err != nil {
+		return errors.Wrap(err, "[transport-tcp] failed to Close connection")
+	}
+
+	return nil
+}
+
+// writeFrame is a concurrent-safe way to write a single frame to the connection
+func (c *Conn) writeFrame(frameType byte, payload []byte) error {
+	if len(payload)+1 > maxFrameSize {
+		return ErrFrameTooLarge
+	}
+
+	frame := make([]byte, 5+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)+1))
+	frame[4] = frameType
+	copy(frame[5:], payload)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	_, err := c.conn.Write(frame)
+
+	return err
+}
+
+// readFrame reads a single frame from the connection. It must only be called from one goroutine at a time.
+func (c *Conn) readFrame() (byte, []byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return 0, nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header)
+	if size == 0 {
+		return 0, nil, errors.Wrap(ErrUnexpectedFrame, "received empty frame")
+	} else if size > maxFrameSize {
+		return 0, nil, ErrFrameTooLarge
+	}
+
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(c.reader, frame); err != nil {
+		return 0, nil, err
+	}
+
+	return frame[0], frame[1:], nil
+}
+
+// tlsState returns the TLS state of the underlying connection, if it is a TLS connection
+func (c *Conn) tlsState() *tls.ConnectionState {
+	tlsConn, ok := c.conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	state := tlsConn.ConnectionState()
+
+	return &state
+}
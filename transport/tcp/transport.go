@@ -0,0 +1,129 @@
+package tcp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+const (
+	MsgTypeTCPMessage = "tcp.message"
+)
+
+// Transport is a transport that connects Grav nodes via raw TCP connections
+type Transport struct {
+	opts *grav.MeshOptions
+	log  *vlog.Logger
+
+	listener net.Listener
+
+	connectionFunc grav.ConnectFunc
+}
+
+// New creates a new TCP transport
+func New() *Transport {
+	t := &Transport{}
+
+	return t
+}
+
+// Setup sets up the transport and begins accepting connections on the configured port
+func (t *Transport) Setup(opts *grav.MeshOptions, connFunc grav.ConnectFunc) error {
+	t.opts = opts
+	t.log = opts.Logger
+	t.connectionFunc = connFunc
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", opts.Port))
+	if err != nil {
+		return errors.Wrap(err, "[transport-tcp] failed to Listen")
+	}
+
+	if t.tlsConfig() != nil {
+		listener = tls.NewListener(listener, t.tlsConfig())
+	}
+
+	t.listener = listener
+
+	t.log.Debug("[transport-tcp] listening on", listener.Addr().String())
+
+	go t.accept()
+
+	return nil
+}
+
+// Connect connects to a TCP endpoint in the form host:port
+func (t *Transport) Connect(endpoint string) (grav.Connection, error) {
+	address := strings.TrimPrefix(endpoint, "tcp://")
+
+	// discovery plugins may advertise a path along with the address, which is meaningless for TCP
+	if idx := strings.Index(address, "/"); idx >= 0 {
+		address = address[:idx]
+	}
+
+	var c net.Conn
+	var err error
+
+	if tlsConfig := t.tlsConfig(); tlsConfig != nil {
+		c, err = tls.Dial("tcp", address, tlsConfig)
+	} else {
+		c, err = net.Dial("tcp", address)
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "[transport-tcp] failed to Dial endpoint")
+	}
+
+	conn := NewConn(c, t.log)
+	conn.tlsOpts = t.opts.TLS
+
+	return conn, nil
+}
+
+// Stop stops accepting incoming connections
+func (t *Transport) Stop() error {
+	if t.listener == nil {
+		return nil
+	}
+
+	if err := t.listener.Close(); err != nil {
+		return errors.Wrap(err, "[transport-tcp] failed to Close listener")
+	}
+
+	return nil
+}
+
+// accept runs forever, passing each new incoming connection to Grav
+func (t *Transport) accept() {
+	for {
+		c, err := t.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				t.log.Debug("[transport-tcp] listener closed, no longer accepting connections")
+				return
+			}
+
+			t.log.Error(errors.Wrap(err, "[transport-tcp] failed to Accept connection"))
+			continue
+		}
+
+		t.log.Debug("[transport-tcp] accepted connection from", c.RemoteAddr().String())
+
+		conn := NewConn(c, t.log)
+		conn.tlsOpts = t.opts.TLS
+
+		go t.connectionFunc(conn)
+	}
+}
+
+func (t *Transport) tlsConfig() *tls.Config {
+	if t.opts.TLS == nil || t.opts.TLS.Config == nil {
+		return nil
+	}
+
+	return t.opts.TLS.Config.Clone()
+}
@@ -0,0 +1,117 @@
+package tcp
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/grav/testutil"
+	"github.com/suborbital/grav/testutil/gravtest"
+	"github.com/suborbital/vektor/vlog"
+)
+
+func newNode(port string) *grav.Grav {
+	return grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseMeshTransport(New()),
+		grav.UseEndpoint(port, ""),
+	)
+}
+
+func TestTCPTransport(t *testing.T) {
+	portB := testutil.FreePort(t)
+
+	gA := newNode(testutil.FreePort(t))
+	gB := newNode(portB)
+
+	podA := gA.Connect()
+	receivedA := gravtest.Receiver(podA)
+	podB := gB.Connect()
+	receivedB := gravtest.Receiver(podB)
+
+	// the listener starts in the background, so give it a moment to begin listening
+	var err error
+	for i := 0; i < 10; i++ {
+		if err = gA.ConnectEndpoint(fmt.Sprintf("127.0.0.1:%s", portB)); err == nil {
+			break
+		}
+
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	if err != nil {
+		t.Fatalf("expected connection to succeed, got %s", err)
+	}
+
+	podA.Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello from A")))
+	gravtest.ReceiveOne(t, receivedB, "hello from A")
+
+	podB.Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello from B")))
+	gravtest.ReceiveOne(t, receivedA, "hello from B")
+
+	if err := gA.Withdraw(); err != nil {
+		t.Errorf("expected withdraw to succeed, got %s", err)
+	}
+
+	if err := gB.Stop(); err != nil {
+		t.Errorf("expected stop to succeed, got %s", err)
+	}
+
+	if err := gA.ConnectEndpoint(fmt.Sprintf("127.0.0.1:%s", portB)); err == nil {
+		t.Error("expected connection to a stopped node to fail")
+	}
+}
+
+// newTLSNode creates a Grav instance whose transport requires TLS and returns it along with its endpoint
+func newTLSNode(t *testing.T, nodeUUID string, cfg *tls.Config) (*grav.Grav, string) {
+	port := testutil.FreePort(t)
+
+	g := grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseNodeUUID(nodeUUID),
+		grav.UseMeshTransport(New()),
+		grav.UseEndpoint(port, ""),
+		grav.UseTLS(&grav.TLSOptions{Config: cfg, VerifyPeerUUID: true}),
+	)
+
+	t.Cleanup(func() { g.Stop() })
+
+	return g, fmt.Sprintf("127.0.0.1:%s", port)
+}
+
+func TestTLSIdentityMismatch(t *testing.T) {
+	ca := testutil.NewCA(t)
+
+	// one of the nodes presents a valid certificate, but it was issued for a different node
+	for _, mismatched := range []string{"dialing", "accepting"} {
+		t.Run(mismatched, func(t *testing.T) {
+			uuidA, uuidB := uuid.New().String(), uuid.New().String()
+
+			certA, certB := ca.Issue(t, uuidA), ca.Issue(t, uuidB)
+			if mismatched == "dialing" {
+				certA = ca.Issue(t, uuid.New().String())
+			} else {
+				certB = ca.Issue(t, uuid.New().String())
+			}
+
+			gA, _ := newTLSNode(t, uuidA, ca.Config(certA))
+			_, endpointB := newTLSNode(t, uuidB, ca.Config(certB))
+
+			// the listener starts in the background, so connecting is retried until the handshake is reached
+			var err error
+			for i := 0; i < 10; i++ {
+				if err = gA.ConnectEndpoint(endpointB); errors.Is(err, grav.ErrPeerIdentityMismatch) {
+					return
+				}
+
+				time.Sleep(time.Millisecond * 100)
+			}
+
+			t.Errorf("expected ErrPeerIdentityMismatch, got %v", err)
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package unix
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/grav/transport/tcp"
+	"github.com/suborbital/vektor/vlog"
+)
+
+// SocketExt is the extension given to each node's socket file
+const SocketExt = ".sock"
+
+// defaultMode restricts connecting to a node's socket to processes running as the same user
+const defaultMode os.FileMode = 0600
+
+// Transport is a transport that connects co-located Grav nodes via Unix domain sockets.
+// Each node listens on a socket named for its UUID inside a shared directory, and the
+// connections exchange the same length-prefixed frames as the TCP transport.
+type Transport struct {
+	opts *grav.MeshOptions
+	log  *vlog.Logger
+
+	dir      string
+	mode     os.FileMode
+	listener net.Listener
+
+	connectionFunc grav.ConnectFunc
+}
+
+// New creates a new Unix socket transport that listens in dir, with a socket that only the same user can connect to
+func New(dir string) *Transport {
+	return NewWithMode(dir, defaultMode)
+}
+
+// NewWithMode creates a new Unix socket transport that listens in dir, with the socket's permissions set to mode
+func NewWithMode(dir string, mode os.FileMode) *Transport {
+	t := &Transport{
+		dir:  dir,
+		mode: mode,
+	}
+
+	return t
+}
+
+// SocketPath returns the path of the socket that the node with the given UUID listens on within dir
+func SocketPath(dir, nodeUUID string) string {
+	return filepath.Join(dir, nodeUUID+SocketExt)
+}
+
+// Setup sets up the transport and begins accepting connections on the node's socket
+func (t *Transport) Setup(opts *grav.MeshOptions, connFunc grav.ConnectFunc) error {
+	t.opts = opts
+	t.log = opts.Logger
+	t.connectionFunc = connFunc
+
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return errors.Wrap(err, "[transport-unix] failed to MkdirAll")
+	}
+
+	path := SocketPath(t.dir, opts.NodeUUID)
+
+	// a socket left behind by a previous process with the same UUID would prevent listening
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "[transport-unix] failed to Remove stale socket")
+	}
+
+	listener, err := listen(path, t.mode)
+	if err != nil {
+		return errors.Wrap(err, "[transport-unix] failed to listen")
+	}
+
+	t.listener = listener
+
+	t.log.Debug("[transport-unix] listening on", path)
+
+	go t.accept()
+
+	return nil
+}
+
+// Connect connects to the socket at the path given by endpoint
+func (t *Transport) Connect(endpoint string) (grav.Connection, error) {
+	path := strings.TrimPrefix(endpoint, "unix://")
+
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, errors.Wrap(err, "[transport-unix] failed to Dial endpoint")
+	}
+
+	return tcp.NewConn(c, t.log), nil
+}
+
+// Stop stops accepting incoming connections and removes the node's socket
+func (t *Transport) Stop() error {
+	if t.listener == nil {
+		return nil
+	}
+
+	if err := t.listener.Close(); err != nil {
+		return errors.Wrap(err, "[transport-unix] failed to Close listener")
+	}
+
+	if err := os.Remove(SocketPath(t.dir, t.opts.NodeUUID)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "[transport-unix] failed to Remove socket")
+	}
+
+	return nil
+}
+
+// listen creates a socket at path with the given permissions. The socket is created in a private directory and moved
+// into place once its permissions are set, so that it can't be connected to with the process's default permissions
+// in the meantime.
+func listen(path string, mode os.FileMode) (*net.UnixListener, error) {
+	// the directory's name is kept short, since socket paths are limited to around 100 characters
+	tmpDir, err := os.MkdirTemp(filepath.Dir(path), ".")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to MkdirTemp")
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	tmpPath := filepath.Join(tmpDir, filepath.Base(path))
+
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmpPath, Net: "unix"})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to ListenUnix")
+	}
+
+	// the socket is no longer at the path it was created at, so Stop removes it rather than the listener
+	listener.SetUnlinkOnClose(false)
+
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		listener.Close()
+		return nil, errors.Wrap(err, "failed to Chmod socket")
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		listener.Close()
+		return nil, errors.Wrap(err, "failed to Rename socket")
+	}
+
+	return listener, nil
+}
+
+// accept runs forever, passing each new incoming connection to Grav
+func (t *Transport) accept() {
+	for {
+		c, err := t.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				t.log.Debug("[transport-unix] listener closed, no longer accepting connections")
+				return
+			}
+
+			t.log.Error(errors.Wrap(err, "[transport-unix] failed to Accept connection"))
+			continue
+		}
+
+		t.log.Debug("[transport-unix] accepted connection")
+
+		go t.connectionFunc(tcp.NewConn(c, t.log))
+	}
+}
@@ -0,0 +1,113 @@
+package unix
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/suborbital/grav/discovery/unix"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/vektor/vlog"
+)
+
+func TestUnixTransportWithDiscovery(t *testing.T) {
+	dir := t.TempDir()
+
+	newNode := func() *grav.Grav {
+		return grav.New(
+			grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+			grav.UseMeshTransport(New(dir)),
+			grav.UseDiscovery(unix.New(dir)),
+		)
+	}
+
+	gA, gB := newNode(), newNode()
+
+	received := make(chan string, 10)
+
+	podB := gB.Connect()
+	podB.On(func(msg grav.Message) error {
+		received <- string(msg.Data())
+		return nil
+	})
+
+	podA := gA.Connect()
+
+	// keep sending until discovery has connected the nodes
+	deadline := time.After(time.Second * 10)
+
+	for {
+		podA.Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello, unix")))
+
+		select {
+		case data := <-received:
+			if data != "hello, unix" {
+				t.Errorf("expected 'hello, unix', got %s", data)
+			}
+
+			info, err := os.Stat(SocketPath(dir, gB.NodeUUID))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if info.Mode().Perm() != defaultMode {
+				t.Errorf("expected socket mode %s, got %s", defaultMode, info.Mode().Perm())
+			}
+
+			return
+		case <-time.After(time.Millisecond * 200):
+			// continue
+		case <-deadline:
+			t.Fatal("timed out waiting for nodes to discover each other")
+		}
+	}
+}
+
+func TestSocketMode(t *testing.T) {
+	dir := t.TempDir()
+
+	g := grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseMeshTransport(NewWithMode(dir, 0660)),
+	)
+
+	path := SocketPath(dir, g.NodeUUID)
+
+	// the transport is set up in the background
+	var info os.FileInfo
+	var err error
+
+	for i := 0; i < 20; i++ {
+		if info, err = os.Stat(path); err == nil {
+			break
+		}
+
+		time.Sleep(time.Millisecond * 50)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0660 {
+		t.Errorf("expected socket mode %s, got %s", os.FileMode(0660), info.Mode().Perm())
+	}
+
+	// the private directory the socket was created in is removed
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("expected only the socket in the directory, got %d entries", len(entries))
+	}
+
+	if err := g.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected socket to be removed when stopped, got %v", err)
+	}
+}
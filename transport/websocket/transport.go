@@ -1,12 +1,16 @@
 package websocket
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
@@ -19,15 +23,21 @@ const (
 
 	withdrawMessage    = "WITHDRAW"
 	withdrawAckMessage = "WITHDRAW ACK"
+
+	// shutdownTimeout is how long the standalone server waits for in-flight requests when stopping
+	shutdownTimeout = time.Second * 5
 )
 
-var upgrader = websocket.Upgrader{}
+var upgrader = websocket.Upgrader{EnableCompression: true}
 
 // Transport is a transport that connects Grav nodes via standard websockets
 type Transport struct {
 	opts *grav.MeshOptions
 	log  *vlog.Logger
 
+	standalone bool
+	server     *http.Server
+
 	connectionFunc grav.ConnectFunc
 }
 
@@ -39,6 +49,9 @@ type Conn struct {
 	conn *websocket.Conn
 	lock sync.Mutex
 
+	tlsOpts  *grav.TLSOptions
+	tlsState *tls.ConnectionState
+
 	recvFunc grav.ReceiveFunc
 }
 
@@ -49,21 +62,83 @@ func New() *Transport {
 	return t
 }
 
+// NewStandalone creates a new websocket transport that runs its own HTTP server on the Port and URI
+// of the Grav instance, rather than requiring HTTPHandlerFunc to be mounted on an existing router.
+// The server uses the instance's TLS options if set, and is shut down gracefully when Grav is stopped.
+func NewStandalone() *Transport {
+	t := &Transport{standalone: true}
+
+	return t
+}
+
 // Setup sets up the transport
 func (t *Transport) Setup(opts *grav.MeshOptions, connFunc grav.ConnectFunc) error {
-	// independent serving is not yet implemented, use the HTTP handler
-
 	t.opts = opts
 	t.log = opts.Logger
 	t.connectionFunc = connFunc
 
+	// if the transport is not standalone, the HTTP handler must be mounted by the caller
+	if t.standalone {
+		if err := t.serve(); err != nil {
+			return errors.Wrap(err, "[transport-websocket] failed to serve")
+		}
+	}
+
+	return nil
+}
+
+// serve starts the standalone server in the background
+func (t *Transport) serve() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", t.opts.Port))
+	if err != nil {
+		return errors.Wrap(err, "failed to Listen")
+	}
+
+	if t.opts.TLS != nil && t.opts.TLS.Config != nil {
+		listener = tls.NewListener(listener, t.opts.TLS.Config.Clone())
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(t.opts.URI, t.HTTPHandlerFunc())
+
+	t.server = &http.Server{Handler: mux}
+
+	t.log.Debug("[transport-websocket] serving on", listener.Addr().String(), t.opts.URI)
+
+	go func() {
+		if err := t.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			t.log.Error(errors.Wrap(err, "[transport-websocket] standalone server failed"))
+		}
+	}()
+
+	return nil
+}
+
+// Stop gracefully shuts down the standalone server, if one is running
+func (t *Transport) Stop() error {
+	if t.server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := t.server.Shutdown(ctx); err != nil {
+		return errors.Wrap(err, "[transport-websocket] failed to Shutdown server")
+	}
+
 	return nil
 }
 
 // Connect adds a websocket endpoint to emit messages to
 func (t *Transport) Connect(endpoint string) (grav.Connection, error) {
 	if !strings.HasPrefix(endpoint, "ws") {
-		endpoint = fmt.Sprintf("ws://%s", endpoint)
+		scheme := "ws"
+		if t.opts.TLS != nil {
+			scheme = "wss"
+		}
+
+		endpoint = fmt.Sprintf("%s://%s", scheme, endpoint)
 	}
 
 	endpointURL, err := url.Parse(endpoint)
@@ -71,20 +146,41 @@ func (t *Transport) Connect(endpoint string) (grav.Connection, error) {
 		return nil, err
 	}
 
-	c, _, err := websocket.DefaultDialer.Dial(endpointURL.String(), nil)
+	dialer := *websocket.DefaultDialer
+	dialer.EnableCompression = true
+
+	if t.opts.TLS != nil && t.opts.TLS.Config != nil {
+		dialer.TLSClientConfig = t.opts.TLS.Config.Clone()
+	}
+
+	c, _, err := dialer.Dial(endpointURL.String(), nil)
 	if err != nil {
 		return nil, errors.Wrapf(err, "[transport-websocket] failed to Dial endpoint")
 	}
 
+	// permessage-deflate is always negotiated, but frames are only compressed once the peer has agreed to FeatureCompression
+	c.EnableWriteCompression(false)
+
 	conn := &Conn{
-		log:  t.log,
-		conn: c,
-		lock: sync.Mutex{},
+		log:     t.log,
+		conn:    c,
+		lock:    sync.Mutex{},
+		tlsOpts: t.opts.TLS,
+	}
+
+	if tlsConn, ok := c.UnderlyingConn().(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		conn.tlsState = &state
 	}
 
 	return conn, nil
 }
 
+// Features returns the optional features supported by the transport
+func (t *Transport) Features() []string {
+	return []string{grav.FeatureCompression}
+}
+
 // HTTPHandlerFunc returns an http.HandlerFunc for incoming connections
 func (t *Transport) HTTPHandlerFunc() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -94,6 +190,12 @@ func (t *Transport) HTTPHandlerFunc() http.HandlerFunc {
 			return
 		}
 
+		if t.opts.TLS != nil && r.TLS == nil {
+			t.log.ErrorString("[transport-websocket] TLS is configured, rejecting incoming plaintext connection")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
 		c, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			t.log.Error(errors.Wrap(err, "[transport-websocket] failed to upgrade connection"))
@@ -102,9 +204,13 @@ func (t *Transport) HTTPHandlerFunc() http.HandlerFunc {
 
 		t.log.Debug("[transport-websocket] upgraded connection:", r.URL.String())
 
+		c.EnableWriteCompression(false)
+
 		conn := &Conn{
-			conn: c,
-			log:  t.log,
+			conn:     c,
+			log:      t.log,
+			tlsOpts:  t.opts.TLS,
+			tlsState: r.TLS,
 		}
 
 		t.connectionFunc(conn)
@@ -193,6 +299,13 @@ func (c *Conn) OutgoingHandshake(handshake *grav.TransportHandshake) (*grav.Tran
 		return nil, errors.Wrap(err, "failed to Unmarshal handshake ack")
 	}
 
+	if ack.Accept {
+		// the peer's certificate must belong to the node that it claims to be
+		if err := c.tlsOpts.VerifyPeer(c.tlsState, ack.UUID); err != nil {
+			return nil, errors.Wrapf(err, "failed to VerifyPeer for %s", ack.UUID)
+		}
+	}
+
 	c.nodeUUID = ack.UUID
 
 	return &ack, nil
@@ -217,7 +330,15 @@ func (c *Conn) IncomingHandshake(handshakeCallback grav.HandshakeCallback) error
 		return errors.Wrap(err, "failed to Unmarshal handshake")
 	}
 
-	ack := handshakeCallback(handshake)
+	var ack *grav.TransportHandshakeAck
+
+	// the peer's certificate must belong to the node that it claims to be, otherwise the hub is never consulted
+	verifyErr := c.tlsOpts.VerifyPeer(c.tlsState, handshake.UUID)
+	if verifyErr != nil {
+		ack = &grav.TransportHandshakeAck{Accept: false, Reason: verifyErr.Error()}
+	} else {
+		ack = handshakeCallback(handshake)
+	}
 
 	ackJSON, err := json.Marshal(ack)
 	if err != nil {
@@ -232,6 +353,10 @@ func (c *Conn) IncomingHandshake(handshakeCallback grav.HandshakeCallback) error
 
 	c.log.Debug("[transport-websocket] sent handshake ack")
 
+	if verifyErr != nil {
+		return errors.Wrapf(verifyErr, "failed to VerifyPeer for %s", handshake.UUID)
+	}
+
 	c.nodeUUID = handshake.UUID
 
 	return nil
@@ -251,6 +376,19 @@ func (c *Conn) SendWithdraw(withdraw *grav.Withdraw) error {
 	return nil
 }
 
+// EnableFeatures enables the features that were negotiated with the peer during the handshake
+func (c *Conn) EnableFeatures(features []string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, f := range features {
+		if f == grav.FeatureCompression {
+			// only takes effect if permessage-deflate was negotiated when the connection was upgraded
+			c.conn.EnableWriteCompression(true)
+		}
+	}
+}
+
 // Close closes the underlying connection
 func (c *Conn) Close() error {
 	c.log.Debug("[transport-websocket] connection for", c.nodeUUID, "is closing")
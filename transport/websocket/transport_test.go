@@ -0,0 +1,260 @@
+package websocket
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/grav/testutil"
+	"github.com/suborbital/grav/testutil/gravtest"
+	"github.com/suborbital/vektor/vlog"
+)
+
+// startTLSNode starts a Grav instance whose websocket transport is served over TLS by an httptest server
+func startTLSNode(t *testing.T, nodeUUID string, cfg *tls.Config) (*grav.Grav, string) {
+	transport := New()
+
+	g := grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseNodeUUID(nodeUUID),
+		grav.UseMeshTransport(transport),
+		grav.UseTLS(&grav.TLSOptions{Config: cfg, VerifyPeerUUID: true}),
+	)
+
+	server := httptest.NewUnstartedServer(transport.HTTPHandlerFunc())
+	server.TLS = cfg
+	server.StartTLS()
+
+	t.Cleanup(server.Close)
+
+	return g, strings.Replace(server.URL, "https", "wss", 1)
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := testutil.NewCA(t)
+
+	uuidA, uuidB := uuid.New().String(), uuid.New().String()
+
+	gA, _ := startTLSNode(t, uuidA, ca.Config(ca.Issue(t, uuidA)))
+	gB, endpointB := startTLSNode(t, uuidB, ca.Config(ca.Issue(t, uuidB)))
+
+	received := gravtest.Receiver(gB.Connect())
+
+	if err := gA.ConnectEndpoint(endpointB); err != nil {
+		t.Fatalf("expected connection to succeed, got %s", err)
+	}
+
+	gA.Connect().Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello, tls")))
+
+	gravtest.ReceiveOne(t, received, "hello, tls")
+}
+
+func TestMutualTLSIdentityMismatch(t *testing.T) {
+	ca := testutil.NewCA(t)
+
+	uuidA, uuidB := uuid.New().String(), uuid.New().String()
+
+	// node A presents a valid certificate, but it was issued for a different node
+	gA, _ := startTLSNode(t, uuidA, ca.Config(ca.Issue(t, uuid.New().String())))
+	_, endpointB := startTLSNode(t, uuidB, ca.Config(ca.Issue(t, uuidB)))
+
+	if err := gA.ConnectEndpoint(endpointB); !errors.Is(err, grav.ErrPeerIdentityMismatch) {
+		t.Errorf("expected ErrPeerIdentityMismatch, got %v", err)
+	}
+}
+
+func TestMutualTLSUntrustedCA(t *testing.T) {
+	caA, caB := testutil.NewCA(t), testutil.NewCA(t)
+
+	uuidA, uuidB := uuid.New().String(), uuid.New().String()
+
+	gA, _ := startTLSNode(t, uuidA, caA.Config(caA.Issue(t, uuidA)))
+	_, endpointB := startTLSNode(t, uuidB, caB.Config(caB.Issue(t, uuidB)))
+
+	if err := gA.ConnectEndpoint(endpointB); err == nil {
+		t.Error("expected connection to a peer with an untrusted certificate to fail")
+	}
+}
+
+func TestStandalone(t *testing.T) {
+	portB := testutil.FreePort(t)
+
+	gA := grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseMeshTransport(NewStandalone()),
+		grav.UseEndpoint(testutil.FreePort(t), ""),
+	)
+
+	gB := grav.New(
+		grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+		grav.UseMeshTransport(NewStandalone()),
+		grav.UseEndpoint(portB, "/meta/message"),
+	)
+
+	received := gravtest.Receiver(gB.Connect())
+
+	endpointB := fmt.Sprintf("127.0.0.1:%s/meta/message", portB)
+
+	// the server starts in the background, so give it a moment to begin listening
+	var err error
+	for i := 0; i < 10; i++ {
+		if err = gA.ConnectEndpoint(endpointB); err == nil {
+			break
+		}
+
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	if err != nil {
+		t.Fatalf("expected connection to succeed, got %s", err)
+	}
+
+	gA.Connect().Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello, standalone")))
+
+	gravtest.ReceiveOne(t, received, "hello, standalone")
+
+	if err := gB.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gA.ConnectEndpoint(endpointB); err == nil {
+		t.Error("expected connection to a stopped server to fail")
+	}
+}
+
+// recordingConn records the bytes read from a connection so that the raw frames can be inspected
+type recordingConn struct {
+	net.Conn
+
+	lock sync.Mutex
+	read []byte
+}
+
+func (r *recordingConn) Read(b []byte) (int, error) {
+	n, err := r.Conn.Read(b)
+
+	r.lock.Lock()
+	r.read = append(r.read, b[:n]...)
+	r.lock.Unlock()
+
+	return n, err
+}
+
+// reset discards the bytes read so far
+func (r *recordingConn) reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.read = nil
+}
+
+// firstFrameCompressed returns true if the first frame read since the last reset has the RSV1 bit set,
+// which marks a frame compressed with permessage-deflate
+func (r *recordingConn) firstFrameCompressed(t *testing.T) bool {
+	t.Helper()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(r.read) == 0 {
+		t.Fatal("no frame was read")
+	}
+
+	return r.read[0]&0x40 != 0
+}
+
+func TestCompressionFeature(t *testing.T) {
+	for _, features := range [][]string{nil, {grav.FeatureCompression}} {
+		t.Run(fmt.Sprintf("%v", features), func(t *testing.T) {
+			transport := New()
+
+			g := grav.New(
+				grav.UseLogger(vlog.Default(vlog.Level(vlog.LogLevelNull))),
+				grav.UseMeshTransport(transport),
+			)
+
+			server := httptest.NewServer(transport.HTTPHandlerFunc())
+			t.Cleanup(server.Close)
+
+			var recorder *recordingConn
+
+			// the peer supports permessage-deflate, so it is negotiated whether or not FeatureCompression is sent
+			dialer := websocket.Dialer{
+				EnableCompression: true,
+				NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					c, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+					recorder = &recordingConn{Conn: c}
+
+					return recorder, err
+				},
+			}
+
+			c, _, err := dialer.Dial(strings.Replace(server.URL, "http", "ws", 1), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer c.Close()
+
+			recorder.reset()
+
+			handshake, _ := json.Marshal(&grav.TransportHandshake{
+				UUID:      uuid.New().String(),
+				BelongsTo: "*",
+				Version:   grav.ProtocolVersion,
+				Features:  features,
+			})
+
+			if err := c.WriteMessage(websocket.BinaryMessage, handshake); err != nil {
+				t.Fatal(err)
+			}
+
+			c.SetReadDeadline(time.Now().Add(time.Second * 3))
+
+			if _, _, err := c.ReadMessage(); err != nil {
+				t.Fatal(err)
+			}
+
+			if recorder.firstFrameCompressed(t) {
+				t.Error("expected handshake ack to be uncompressed")
+			}
+
+			// messages are sent once the hub has added the connection, so they are sent until one arrives
+			recorder.reset()
+
+			received := make(chan struct{})
+			go func() {
+				c.ReadMessage()
+				close(received)
+			}()
+
+			pod := g.Connect()
+
+		send:
+			for {
+				pod.Send(grav.NewMsg(grav.MsgTypeDefault, []byte("hello, compression")))
+
+				select {
+				case <-received:
+					break send
+				case <-time.After(time.Millisecond * 100):
+				}
+			}
+
+			if compressed := recorder.firstFrameCompressed(t); compressed != (features != nil) {
+				t.Errorf("expected message compressed to be %t, got %t", features != nil, compressed)
+			}
+		})
+	}
+}